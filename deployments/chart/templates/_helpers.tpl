@@ -14,3 +14,15 @@ We truncate at 63 chars because some Kubernetes name fields are limited to this
 {{- $name := default .Chart.Name .Values.nameOverride -}}
 {{- printf "%s-%s" .Release.Name $name | trunc 63 | trimSuffix "-" -}}
 {{- end -}}
+
+{{/*
+Name of the Secret with the grafana credentials: the existing one given in
+authSecret.name, or the one created by the chart from auth.
+*/}}
+{{- define "grafana-config-operator.authSecretName" -}}
+{{- if .Values.config.grafana.authSecret.name -}}
+{{- .Values.config.grafana.authSecret.name -}}
+{{- else if .Values.config.grafana.auth -}}
+{{- printf "%s-auth" (include "grafana-config-operator.fullname" .) -}}
+{{- end -}}
+{{- end -}}
@@ -0,0 +1,301 @@
+package v1alpha1
+
+/*
+Copyright [2019] [autonubil System GmbH]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// ConditionType is the type of a condition of a custom resource
+type ConditionType string
+
+const (
+	// ConditionReady is true if the object was applied to grafana
+	ConditionReady ConditionType = "Ready"
+)
+
+// Reasons reported by the conditions
+const (
+	ReasonSynced       = "Synced"
+	ReasonInvalidSpec  = "InvalidSpec"
+	ReasonSourceError  = "SourceError"
+	ReasonGrafanaError = "GrafanaError"
+	ReasonNotEmpty     = "NotEmpty"
+	ReasonExists       = "Exists"
+)
+
+// Condition describes the state of a custom resource at a certain point.
+type Condition struct {
+	Type               ConditionType          `json:"type"`
+	Status             corev1.ConditionStatus `json:"status"`
+	Reason             string                 `json:"reason,omitempty"`
+	Message            string                 `json:"message,omitempty"`
+	LastTransitionTime metav1.Time            `json:"lastTransitionTime,omitempty"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// GrafanaDashboard is a dashboard applied to grafana
+type GrafanaDashboard struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   GrafanaDashboardSpec   `json:"spec"`
+	Status GrafanaDashboardStatus `json:"status,omitempty"`
+}
+
+// GrafanaDashboardSpec declares the dashboard. Exactly one of JSON, ConfigMapRef
+// and URL has to be set.
+type GrafanaDashboardSpec struct {
+	// Dashboard model as inline JSON
+	JSON string `json:"json,omitempty"`
+	// Key of a ConfigMap in the same namespace holding the dashboard model
+	ConfigMapRef *corev1.ConfigMapKeySelector `json:"configMapRef,omitempty"`
+	// URL the dashboard model is downloaded from. Its host has to be allowed
+	// by the operator. It is downloaded again on changes of the resource and
+	// on every resync only.
+	URL string `json:"url,omitempty"`
+	// Title of the folder of the dashboard, the General folder if empty
+	Folder string `json:"folder,omitempty"`
+	// Fixed uid of the (innermost) folder
+	FolderUID string `json:"folderUid,omitempty"`
+	// Name of a GrafanaFolder in the same namespace, takes precedence over
+	// folder and folderUid
+	FolderRef string `json:"folderRef,omitempty"`
+	// Name of the operator instance responsible for this dashboard. Empty
+	// means any instance.
+	Instance string `json:"instance,omitempty"`
+}
+
+// GrafanaDashboardStatus is the state of the dashboard in grafana
+type GrafanaDashboardStatus struct {
+	UID                string       `json:"uid,omitempty"`
+	URL                string       `json:"url,omitempty"`
+	Version            int          `json:"version,omitempty"`
+	ObservedGeneration int64        `json:"observedGeneration,omitempty"`
+	LastSyncTime       *metav1.Time `json:"lastSyncTime,omitempty"`
+	Conditions         []Condition  `json:"conditions,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// GrafanaDashboardList is a list of GrafanaDashboards
+type GrafanaDashboardList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []GrafanaDashboard `json:"items"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// GrafanaDatasource is a datasource applied to grafana
+type GrafanaDatasource struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   GrafanaDatasourceSpec   `json:"spec"`
+	Status GrafanaDatasourceStatus `json:"status,omitempty"`
+}
+
+// GrafanaDatasourceSpec mirrors the datasource of grafana. Sensitive fields
+// can be read from Secrets. basicAuth, withCredentials, isDefault and editable
+// keep their value in grafana unless they are given.
+type GrafanaDatasourceSpec struct {
+	// Name of the datasource, defaults to the name of the resource
+	Name string `json:"name,omitempty"`
+	// Fixed uid of the datasource, generated by grafana if empty
+	UID               string                 `json:"uid,omitempty"`
+	Type              string                 `json:"type"`
+	Access            string                 `json:"access,omitempty"`
+	URL               string                 `json:"url,omitempty"`
+	User              string                 `json:"user,omitempty"`
+	Database          string                 `json:"database,omitempty"`
+	BasicAuth         *bool                  `json:"basicAuth,omitempty"`
+	BasicAuthUser     string                 `json:"basicAuthUser,omitempty"`
+	WithCredentials   *bool                  `json:"withCredentials,omitempty"`
+	IsDefault         *bool                  `json:"isDefault,omitempty"`
+	Editable          *bool                  `json:"editable,omitempty"`
+	Password          *SecretValue           `json:"password,omitempty"`
+	BasicAuthPassword *SecretValue           `json:"basicAuthPassword,omitempty"`
+	JSONData          *runtime.RawExtension  `json:"jsonData,omitempty"`
+	SecureJSONData    map[string]SecretValue `json:"secureJsonData,omitempty"`
+	// Name of the operator instance responsible for this datasource. Empty
+	// means any instance.
+	Instance string `json:"instance,omitempty"`
+	// Id of the organization of the datasource, the organization of the
+	// operator if 0
+	OrgID uint `json:"orgId,omitempty"`
+}
+
+// SecretValue is either given inline or read from a key of a Secret in the
+// namespace of the resource.
+type SecretValue struct {
+	Value        string                    `json:"value,omitempty"`
+	SecretKeyRef *corev1.SecretKeySelector `json:"secretKeyRef,omitempty"`
+}
+
+// GrafanaDatasourceStatus is the state of the datasource in grafana
+type GrafanaDatasourceStatus struct {
+	ID                 uint         `json:"id,omitempty"`
+	Name               string       `json:"name,omitempty"`
+	ObservedGeneration int64        `json:"observedGeneration,omitempty"`
+	LastSyncTime       *metav1.Time `json:"lastSyncTime,omitempty"`
+	Conditions         []Condition  `json:"conditions,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// GrafanaDatasourceList is a list of GrafanaDatasources
+type GrafanaDatasourceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []GrafanaDatasource `json:"items"`
+}
+
+// DatasourceName is the name of the datasource in grafana
+func (in *GrafanaDatasource) DatasourceName() string {
+	if in.Spec.Name != "" {
+		return in.Spec.Name
+	}
+	return in.Name
+}
+
+// SecretNames returns the names of all Secrets referenced by the datasource
+func (in *GrafanaDatasourceSpec) SecretNames() []string {
+	names := []string{}
+	values := []*SecretValue{in.Password, in.BasicAuthPassword}
+	for key := range in.SecureJSONData {
+		value := in.SecureJSONData[key]
+		values = append(values, &value)
+	}
+	for _, value := range values {
+		if value != nil && value.SecretKeyRef != nil {
+			names = append(names, value.SecretKeyRef.Name)
+		}
+	}
+	return names
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// GrafanaFolder is a folder applied to grafana
+type GrafanaFolder struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   GrafanaFolderSpec   `json:"spec"`
+	Status GrafanaFolderStatus `json:"status,omitempty"`
+}
+
+// GrafanaFolderSpec declares a folder and its permissions
+type GrafanaFolderSpec struct {
+	// Title of the folder, defaults to the name of the resource
+	Title string `json:"title,omitempty"`
+	// Fixed uid of the folder, generated by grafana if empty
+	UID string `json:"uid,omitempty"`
+	// Name of the GrafanaFolder in the same namespace this folder is nested in
+	ParentRef string `json:"parentRef,omitempty"`
+	// Uid of the folder this folder is nested in, if not managed by a GrafanaFolder
+	ParentUID string `json:"parentUid,omitempty"`
+	// Permissions of the folder. Left alone if not given.
+	Permissions []FolderPermission `json:"permissions,omitempty"`
+	// Delete the folder along with its dashboards when the resource is
+	// deleted. Otherwise only an empty folder is deleted. Only applies to
+	// folders created for the resource.
+	Cascade bool `json:"cascade,omitempty"`
+	// Take over a folder with the uid or title that already exists in
+	// grafana. Adopted folders are left in grafana when the resource is
+	// deleted.
+	Adopt bool `json:"adopt,omitempty"`
+	// Name of the operator instance responsible for this folder. Empty
+	// means any instance.
+	Instance string `json:"instance,omitempty"`
+}
+
+// FolderPermission grants a permission to either a team, a user or a role
+type FolderPermission struct {
+	Team string `json:"team,omitempty"`
+	// Login or email of the user
+	User string `json:"user,omitempty"`
+	// Viewer or Editor
+	Role string `json:"role,omitempty"`
+	// View, Edit or Admin
+	Permission string `json:"permission"`
+}
+
+// GrafanaFolderStatus is the state of the folder in grafana
+type GrafanaFolderStatus struct {
+	UID                string       `json:"uid,omitempty"`
+	ID                 uint         `json:"id,omitempty"`
+	URL                string       `json:"url,omitempty"`
+	ObservedGeneration int64        `json:"observedGeneration,omitempty"`
+	LastSyncTime       *metav1.Time `json:"lastSyncTime,omitempty"`
+	Conditions         []Condition  `json:"conditions,omitempty"`
+	// Principals the operator granted permissions to
+	ManagedPermissions []string `json:"managedPermissions,omitempty"`
+	// The folder was created for the resource rather than adopted, only
+	// such folders are deleted along with the resource
+	Created bool `json:"created,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// GrafanaFolderList is a list of GrafanaFolders
+type GrafanaFolderList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []GrafanaFolder `json:"items"`
+}
+
+// FolderTitle is the title of the folder in grafana
+func (in *GrafanaFolder) FolderTitle() string {
+	if in.Spec.Title != "" {
+		return in.Spec.Title
+	}
+	return in.Name
+}
+
+// GetCondition returns the condition of the given type, or nil
+func GetCondition(conditions []Condition, conditionType ConditionType) *Condition {
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
+
+// SetCondition adds or updates a condition. The transition time is only
+// changed if the status changes.
+func SetCondition(conditions []Condition, condition Condition) []Condition {
+	if existing := GetCondition(conditions, condition.Type); existing != nil {
+		if existing.Status == condition.Status {
+			condition.LastTransitionTime = existing.LastTransitionTime
+		}
+		*existing = condition
+		return conditions
+	}
+	return append(conditions, condition)
+}
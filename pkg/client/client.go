@@ -0,0 +1,86 @@
+package client
+
+/*
+Copyright [2019] [autonubil System GmbH]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/client-go/rest"
+
+	"gitlab.autonubil.net/kubernetes/grafana-config-operator/pkg/apis/grafana/v1alpha1"
+)
+
+var (
+	// Scheme knows the custom resources of the operator
+	Scheme = runtime.NewScheme()
+	// Codecs for the custom resources
+	Codecs = serializer.NewCodecFactory(Scheme)
+	// ParameterCodec encodes list and watch options
+	ParameterCodec = runtime.NewParameterCodec(Scheme)
+)
+
+func init() {
+	metav1.AddToGroupVersion(Scheme, schema.GroupVersion{Version: "v1"})
+	if err := v1alpha1.AddToScheme(Scheme); err != nil {
+		panic(err)
+	}
+}
+
+// GrafanaV1alpha1Client is a client for the grafana.autonubil.net/v1alpha1
+// API group.
+type GrafanaV1alpha1Client struct {
+	restClient rest.Interface
+}
+
+// NewForConfig creates a new client for the custom resources of the operator
+func NewForConfig(c *rest.Config) (*GrafanaV1alpha1Client, error) {
+	config := *c
+	config.GroupVersion = &v1alpha1.SchemeGroupVersion
+	config.APIPath = "/apis"
+	config.ContentType = runtime.ContentTypeJSON
+	config.NegotiatedSerializer = serializer.DirectCodecFactory{CodecFactory: Codecs}
+	if config.UserAgent == "" {
+		config.UserAgent = rest.DefaultKubernetesUserAgent()
+	}
+	restClient, err := rest.RESTClientFor(&config)
+	if err != nil {
+		return nil, err
+	}
+	return &GrafanaV1alpha1Client{restClient: restClient}, nil
+}
+
+// GrafanaDashboards returns a client for the GrafanaDashboards of a namespace
+func (c *GrafanaV1alpha1Client) GrafanaDashboards(namespace string) GrafanaDashboardInterface {
+	return &grafanaDashboards{client: c.restClient, ns: namespace}
+}
+
+// GrafanaDatasources returns a client for the GrafanaDatasources of a namespace
+func (c *GrafanaV1alpha1Client) GrafanaDatasources(namespace string) GrafanaDatasourceInterface {
+	return &grafanaDatasources{client: c.restClient, ns: namespace}
+}
+
+// GrafanaFolders returns a client for the GrafanaFolders of a namespace
+func (c *GrafanaV1alpha1Client) GrafanaFolders(namespace string) GrafanaFolderInterface {
+	return &grafanaFolders{client: c.restClient, ns: namespace}
+}
+
+// RESTClient returns the underlying REST client
+func (c *GrafanaV1alpha1Client) RESTClient() rest.Interface {
+	return c.restClient
+}
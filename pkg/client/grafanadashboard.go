@@ -0,0 +1,101 @@
+package client
+
+/*
+Copyright [2019] [autonubil System GmbH]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/rest"
+
+	"gitlab.autonubil.net/kubernetes/grafana-config-operator/pkg/apis/grafana/v1alpha1"
+)
+
+// GrafanaDashboardInterface has methods to work with GrafanaDashboard resources.
+type GrafanaDashboardInterface interface {
+	Get(name string, options metav1.GetOptions) (*v1alpha1.GrafanaDashboard, error)
+	List(opts metav1.ListOptions) (*v1alpha1.GrafanaDashboardList, error)
+	Watch(opts metav1.ListOptions) (watch.Interface, error)
+	Update(dashboard *v1alpha1.GrafanaDashboard) (*v1alpha1.GrafanaDashboard, error)
+	UpdateStatus(dashboard *v1alpha1.GrafanaDashboard) (*v1alpha1.GrafanaDashboard, error)
+}
+
+type grafanaDashboards struct {
+	client rest.Interface
+	ns     string
+}
+
+// Get takes name of the grafanaDashboard, and returns the corresponding grafanaDashboard object, and an error if there is any.
+func (c *grafanaDashboards) Get(name string, options metav1.GetOptions) (*v1alpha1.GrafanaDashboard, error) {
+	result := &v1alpha1.GrafanaDashboard{}
+	err := c.client.Get().
+		Namespace(c.ns).
+		Resource("grafanadashboards").
+		Name(name).
+		VersionedParams(&options, ParameterCodec).
+		Do().
+		Into(result)
+	return result, err
+}
+
+// List takes label and field selectors, and returns the list of GrafanaDashboards that match those selectors.
+func (c *grafanaDashboards) List(opts metav1.ListOptions) (*v1alpha1.GrafanaDashboardList, error) {
+	result := &v1alpha1.GrafanaDashboardList{}
+	err := c.client.Get().
+		Namespace(c.ns).
+		Resource("grafanadashboards").
+		VersionedParams(&opts, ParameterCodec).
+		Do().
+		Into(result)
+	return result, err
+}
+
+// Watch returns a watch.Interface that watches the requested grafanaDashboards.
+func (c *grafanaDashboards) Watch(opts metav1.ListOptions) (watch.Interface, error) {
+	opts.Watch = true
+	return c.client.Get().
+		Namespace(c.ns).
+		Resource("grafanadashboards").
+		VersionedParams(&opts, ParameterCodec).
+		Watch()
+}
+
+// Update takes the representation of a grafanaDashboard and updates it. Returns the server's representation of the grafanaDashboard, and an error, if there is any.
+func (c *grafanaDashboards) Update(dashboard *v1alpha1.GrafanaDashboard) (*v1alpha1.GrafanaDashboard, error) {
+	result := &v1alpha1.GrafanaDashboard{}
+	err := c.client.Put().
+		Namespace(c.ns).
+		Resource("grafanadashboards").
+		Name(dashboard.Name).
+		Body(dashboard).
+		Do().
+		Into(result)
+	return result, err
+}
+
+// UpdateStatus updates only the status subresource of a grafanaDashboard.
+func (c *grafanaDashboards) UpdateStatus(dashboard *v1alpha1.GrafanaDashboard) (*v1alpha1.GrafanaDashboard, error) {
+	result := &v1alpha1.GrafanaDashboard{}
+	err := c.client.Put().
+		Namespace(c.ns).
+		Resource("grafanadashboards").
+		Name(dashboard.Name).
+		SubResource("status").
+		Body(dashboard).
+		Do().
+		Into(result)
+	return result, err
+}
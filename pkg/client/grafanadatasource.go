@@ -0,0 +1,101 @@
+package client
+
+/*
+Copyright [2019] [autonubil System GmbH]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/rest"
+
+	"gitlab.autonubil.net/kubernetes/grafana-config-operator/pkg/apis/grafana/v1alpha1"
+)
+
+// GrafanaDatasourceInterface has methods to work with GrafanaDatasource resources.
+type GrafanaDatasourceInterface interface {
+	Get(name string, options metav1.GetOptions) (*v1alpha1.GrafanaDatasource, error)
+	List(opts metav1.ListOptions) (*v1alpha1.GrafanaDatasourceList, error)
+	Watch(opts metav1.ListOptions) (watch.Interface, error)
+	Update(datasource *v1alpha1.GrafanaDatasource) (*v1alpha1.GrafanaDatasource, error)
+	UpdateStatus(datasource *v1alpha1.GrafanaDatasource) (*v1alpha1.GrafanaDatasource, error)
+}
+
+type grafanaDatasources struct {
+	client rest.Interface
+	ns     string
+}
+
+// Get takes name of the grafanaDatasource, and returns the corresponding grafanaDatasource object, and an error if there is any.
+func (c *grafanaDatasources) Get(name string, options metav1.GetOptions) (*v1alpha1.GrafanaDatasource, error) {
+	result := &v1alpha1.GrafanaDatasource{}
+	err := c.client.Get().
+		Namespace(c.ns).
+		Resource("grafanadatasources").
+		Name(name).
+		VersionedParams(&options, ParameterCodec).
+		Do().
+		Into(result)
+	return result, err
+}
+
+// List takes label and field selectors, and returns the list of GrafanaDatasources that match those selectors.
+func (c *grafanaDatasources) List(opts metav1.ListOptions) (*v1alpha1.GrafanaDatasourceList, error) {
+	result := &v1alpha1.GrafanaDatasourceList{}
+	err := c.client.Get().
+		Namespace(c.ns).
+		Resource("grafanadatasources").
+		VersionedParams(&opts, ParameterCodec).
+		Do().
+		Into(result)
+	return result, err
+}
+
+// Watch returns a watch.Interface that watches the requested grafanaDatasources.
+func (c *grafanaDatasources) Watch(opts metav1.ListOptions) (watch.Interface, error) {
+	opts.Watch = true
+	return c.client.Get().
+		Namespace(c.ns).
+		Resource("grafanadatasources").
+		VersionedParams(&opts, ParameterCodec).
+		Watch()
+}
+
+// Update takes the representation of a grafanaDatasource and updates it. Returns the server's representation of the grafanaDatasource, and an error, if there is any.
+func (c *grafanaDatasources) Update(datasource *v1alpha1.GrafanaDatasource) (*v1alpha1.GrafanaDatasource, error) {
+	result := &v1alpha1.GrafanaDatasource{}
+	err := c.client.Put().
+		Namespace(c.ns).
+		Resource("grafanadatasources").
+		Name(datasource.Name).
+		Body(datasource).
+		Do().
+		Into(result)
+	return result, err
+}
+
+// UpdateStatus updates only the status subresource of a grafanaDatasource.
+func (c *grafanaDatasources) UpdateStatus(datasource *v1alpha1.GrafanaDatasource) (*v1alpha1.GrafanaDatasource, error) {
+	result := &v1alpha1.GrafanaDatasource{}
+	err := c.client.Put().
+		Namespace(c.ns).
+		Resource("grafanadatasources").
+		Name(datasource.Name).
+		SubResource("status").
+		Body(datasource).
+		Do().
+		Into(result)
+	return result, err
+}
@@ -0,0 +1,101 @@
+package client
+
+/*
+Copyright [2019] [autonubil System GmbH]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/rest"
+
+	"gitlab.autonubil.net/kubernetes/grafana-config-operator/pkg/apis/grafana/v1alpha1"
+)
+
+// GrafanaFolderInterface has methods to work with GrafanaFolder resources.
+type GrafanaFolderInterface interface {
+	Get(name string, options metav1.GetOptions) (*v1alpha1.GrafanaFolder, error)
+	List(opts metav1.ListOptions) (*v1alpha1.GrafanaFolderList, error)
+	Watch(opts metav1.ListOptions) (watch.Interface, error)
+	Update(folder *v1alpha1.GrafanaFolder) (*v1alpha1.GrafanaFolder, error)
+	UpdateStatus(folder *v1alpha1.GrafanaFolder) (*v1alpha1.GrafanaFolder, error)
+}
+
+type grafanaFolders struct {
+	client rest.Interface
+	ns     string
+}
+
+// Get takes name of the grafanaFolder, and returns the corresponding grafanaFolder object, and an error if there is any.
+func (c *grafanaFolders) Get(name string, options metav1.GetOptions) (*v1alpha1.GrafanaFolder, error) {
+	result := &v1alpha1.GrafanaFolder{}
+	err := c.client.Get().
+		Namespace(c.ns).
+		Resource("grafanafolders").
+		Name(name).
+		VersionedParams(&options, ParameterCodec).
+		Do().
+		Into(result)
+	return result, err
+}
+
+// List takes label and field selectors, and returns the list of GrafanaFolders that match those selectors.
+func (c *grafanaFolders) List(opts metav1.ListOptions) (*v1alpha1.GrafanaFolderList, error) {
+	result := &v1alpha1.GrafanaFolderList{}
+	err := c.client.Get().
+		Namespace(c.ns).
+		Resource("grafanafolders").
+		VersionedParams(&opts, ParameterCodec).
+		Do().
+		Into(result)
+	return result, err
+}
+
+// Watch returns a watch.Interface that watches the requested grafanaFolders.
+func (c *grafanaFolders) Watch(opts metav1.ListOptions) (watch.Interface, error) {
+	opts.Watch = true
+	return c.client.Get().
+		Namespace(c.ns).
+		Resource("grafanafolders").
+		VersionedParams(&opts, ParameterCodec).
+		Watch()
+}
+
+// Update takes the representation of a grafanaFolder and updates it. Returns the server's representation of the grafanaFolder, and an error, if there is any.
+func (c *grafanaFolders) Update(folder *v1alpha1.GrafanaFolder) (*v1alpha1.GrafanaFolder, error) {
+	result := &v1alpha1.GrafanaFolder{}
+	err := c.client.Put().
+		Namespace(c.ns).
+		Resource("grafanafolders").
+		Name(folder.Name).
+		Body(folder).
+		Do().
+		Into(result)
+	return result, err
+}
+
+// UpdateStatus updates only the status subresource of a grafanaFolder.
+func (c *grafanaFolders) UpdateStatus(folder *v1alpha1.GrafanaFolder) (*v1alpha1.GrafanaFolder, error) {
+	result := &v1alpha1.GrafanaFolder{}
+	err := c.client.Put().
+		Namespace(c.ns).
+		Resource("grafanafolders").
+		Name(folder.Name).
+		SubResource("status").
+		Body(folder).
+		Do().
+		Into(result)
+	return result, err
+}
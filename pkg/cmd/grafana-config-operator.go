@@ -23,6 +23,7 @@ import (
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
 	goflag "flag"
 
@@ -31,6 +32,7 @@ import (
 
 	"github.com/golang/glog"
 	"github.com/spf13/cobra"
+	"gitlab.autonubil.net/kubernetes/grafana-config-operator/pkg/grafana"
 	"gitlab.autonubil.net/kubernetes/grafana-config-operator/pkg/operator"
 )
 
@@ -92,8 +94,30 @@ func NewCmdGrafanaConfigOperator() (*cobra.Command, error) {
 		DashboardLabel:    "grafana_dashboard",
 		DatasourceWatch:   true,
 		DatasourceLabel:   "grafana_datasource",
+		NotifierWatch:     false,
+		NotifierLabel:     "grafana_notifier",
+		AlertingWatch:     false,
+		AlertingLabel:     "grafana_alert",
 		Autoconfigure:     false,
 		DbaasFolder:       false,
+		Workers:           2,
+		MaxRetries:        10,
+		RetryBaseDelay:    time.Second,
+		RetryMaxDelay:     5 * time.Minute,
+		ResyncPeriod:      0,
+		DriftInterval:     0,
+		DriftCorrect:      true,
+		Prune:             false,
+		PruneDryRun:       false,
+		PruneInterval:     10 * time.Minute,
+		FolderTemplate:    "",
+		NestedFolders:     false,
+		Permissions:       false,
+		PermissionsStrict: false,
+		DashboardCRD:      false,
+		DatasourceCRD:     false,
+		FolderCRD:         false,
+		Instance:          "",
 	}
 
 	// Create a new command
@@ -116,14 +140,65 @@ func NewCmdGrafanaConfigOperator() (*cobra.Command, error) {
 
 	cmd.Flags().StringVarP(&options.GrafanaEndpoint, "grafana.endpoint", "e", options.GrafanaEndpoint, "Api Endpoint for grafana.")
 	cmd.Flags().StringVarP(&options.GrafanaAuth, "grafana.auth", "t", options.GrafanaAuth, "grafana authentication (wheter basic <user:password> or <token>).")
+	cmd.Flags().StringVarP(&options.GrafanaAuthFile, "grafana.auth-file", "", options.GrafanaAuthFile, "File with the grafana authentication in the format of --grafana.auth, e.g. a mounted Secret. Changes are picked up without a restart")
+	cmd.Flags().StringVarP(&options.GrafanaAuthSecret, "grafana.auth-secret", "", options.GrafanaAuthSecret, "Secret <namespace>/<name> with the grafana authentication in the key 'token' (API key or service account token), the keys 'user' and 'password' or the key 'auth' in the format of --grafana.auth. Changes are picked up without a restart")
+	cmd.Flags().StringVarP(&options.GrafanaAuthProxyUser, "grafana.auth-proxy-user", "", options.GrafanaAuthProxyUser, "User to authenticate as with the header of grafana's auth proxy, e.g. if grafana runs behind an authenticating proxy")
+	cmd.Flags().StringVarP(&options.GrafanaProxyHeader, "grafana.auth-proxy-header", "", grafana.DefaultAuthProxyHeader, "Header of grafana's auth proxy with the user name")
+	cmd.Flags().UintVarP(&options.GrafanaOrgID, "grafana.org-id", "", options.GrafanaOrgID, "Id of the grafana organization to act in. 0 uses the current organization of the user")
+	cmd.Flags().DurationVarP(&options.GrafanaTimeout, "grafana.timeout", "", grafana.DefaultTimeout, "Timeout of a single request to grafana. 0 disables the timeout")
+	cmd.Flags().IntVarP(&options.GrafanaRetries, "grafana.retries", "", grafana.DefaultRetries, "How often idempotent requests to grafana are retried on connection errors, 429 and 5xx responses")
+	cmd.Flags().DurationVarP(&options.GrafanaRetryBackoff, "grafana.retry-backoff", "", grafana.DefaultRetryBackoff, "Initial wait between retries of a request to grafana, doubled with every retry. A longer Retry-After of grafana takes precedence")
+	cmd.Flags().StringVarP(&options.GrafanaCAFile, "grafana.ca-file", "", options.GrafanaCAFile, "PEM bundle of the CAs that sign grafana's certificate, instead of the system CAs. Reloaded when changed")
+	cmd.Flags().StringVarP(&options.GrafanaCertFile, "grafana.cert-file", "", options.GrafanaCertFile, "PEM client certificate for mutual TLS with grafana. Reloaded when changed")
+	cmd.Flags().StringVarP(&options.GrafanaKeyFile, "grafana.key-file", "", options.GrafanaKeyFile, "PEM key of the client certificate for mutual TLS with grafana")
+	cmd.Flags().StringVarP(&options.GrafanaServerName, "grafana.server-name", "", options.GrafanaServerName, "Name expected in grafana's certificate and sent as SNI, if it differs from the host of the endpoint")
+	cmd.Flags().BoolVarP(&options.GrafanaInsecure, "grafana.insecure-skip-verify", "", options.GrafanaInsecure, "Do not verify grafana's certificate. Insecure, for testing only")
 
 	cmd.Flags().BoolVarP(&options.DatasourceWatch, "datasources.watch", "x", options.DatasourceWatch, "Watch for datasources")
 	cmd.Flags().StringVarP(&options.DatasourceLabel, "datasources.label", "d", options.DatasourceLabel, "watch configmaps")
+	cmd.Flags().StringVarP(&options.DatasourceState, "datasources.state-configmap", "", options.DatasourceState, "Config map <namespace>/<name> owned by the operator in which it records hashes of the datasource secrets it wrote, so unchanged secrets are not sent again after a restart. Requires get, create and patch on the config map. Without it the hashes are only kept in memory")
+
+	cmd.Flags().BoolVarP(&options.NotifierWatch, "notifiers.watch", "", options.NotifierWatch, "Watch for legacy alert notification channels in grafana's 'notifiers' provisioning format")
+	cmd.Flags().StringVarP(&options.NotifierLabel, "notifiers.label", "", options.NotifierLabel, "config map filter label for notification channels")
+
+	cmd.Flags().BoolVarP(&options.CrossNamespaceSecrets, "interpolation.cross-namespace-secrets", "", options.CrossNamespaceSecrets, "Allow ${secret:namespace/name/key} references in datasources to read Secrets of other namespaces than the one of the config map")
+	cmd.Flags().StringVarP(&options.EnvVariablePrefix, "interpolation.env-prefix", "", options.EnvVariablePrefix, "Prefix of the environment variables of the operator that ${VAR} references in datasources may read, e.g. 'GRAFANA_DS_'. Other variables are rejected. Empty disables environment variables")
+
+	cmd.Flags().BoolVarP(&options.AlertingWatch, "alerting.watch", "", options.AlertingWatch, "Watch for unified alerting contact points, policies, mute timings, templates and rule groups")
+	cmd.Flags().StringVarP(&options.AlertingLabel, "alerting.label", "", options.AlertingLabel, "config map filter label for unified alerting")
 
 	cmd.Flags().BoolVarP(&options.DashboardWatch, "dashboards.watch", "w", options.DashboardWatch, "Watch for dashboards")
 	cmd.Flags().StringVarP(&options.DashboardLabel, "dashboards.label", "l", options.DashboardLabel, "config map filter label. If ot specified, DASHBOARD_LABEL  env. var is checked for existence")
 
+	cmd.Flags().BoolVarP(&options.DashboardCRD, "dashboards.crd", "", options.DashboardCRD, "Watch GrafanaDashboard custom resources. Requires the CRD to be installed")
+	cmd.Flags().StringVarP(&options.DashboardURLPrefixes, "dashboards.url-prefixes", "", options.DashboardURLPrefixes, "Comma separated URL prefixes GrafanaDashboards may download their model from with spec.url, e.g. 'https://grafana.com/api/dashboards/'. Scheme and host have to match exactly. Empty disables downloads. Downloaded dashboards are only updated on changes of the resource and on every --resync-period")
+	cmd.Flags().BoolVarP(&options.DatasourceCRD, "datasources.crd", "", options.DatasourceCRD, "Watch GrafanaDatasource custom resources. Requires the CRD to be installed")
+	cmd.Flags().DurationVarP(&options.SecretRefreshInterval, "datasources.secret-refresh-interval", "", time.Minute, "Interval in which the Secrets referenced by GrafanaDatasources are fetched again to re-apply rotated credentials. 0 fetches them on every apply without noticing rotations")
+	cmd.Flags().BoolVarP(&options.FolderCRD, "folders.crd", "", options.FolderCRD, "Watch GrafanaFolder custom resources. Dashboards refer to them with spec.folderRef or the 'grafana.autonubil.net/folder-ref' annotation. Requires the CRD to be installed")
+	cmd.Flags().StringVarP(&options.Instance, "instance", "", options.Instance, "Name of the grafana instance managed by this operator. Custom resources with a different spec.instance are ignored")
+
 	cmd.Flags().BoolVarP(&options.DbaasFolder, "dbaasFolder", "z", options.DbaasFolder, "Create Folder for dashboards from the namespaces 'customergroup' label")
+	cmd.Flags().StringVarP(&options.FolderTemplate, "folders.template", "", options.FolderTemplate, "Go template for the folder of dashboards, e.g. '{{ .Namespace }}/{{ .Labels.team }}'. Available fields: Namespace, Name, File, Labels, Annotations, NamespaceLabels, NamespaceAnnotations. Dashboards whose template refers to a missing label or annotation, or evaluates to an empty nested folder name, are not applied. The 'grafana.autonubil.net/folder' annotation of a config map takes precedence")
+	cmd.Flags().BoolVarP(&options.NestedFolders, "folders.nested", "", options.NestedFolders, "Treat '/' in folder names as separator of nested folders, e.g. 'platform/networking/ingress'. Requires a grafana version with nested folder support")
+
+	cmd.Flags().BoolVarP(&options.Permissions, "permissions.enabled", "", options.Permissions, "Apply folder and dashboard permissions from the 'grafana.autonubil.net/folder-permissions' and 'grafana.autonubil.net/dashboard-permissions' annotations of config maps or their namespace, e.g. 'team:ops=Edit, user:jane=View, role:Viewer=View'")
+	cmd.Flags().BoolVarP(&options.PermissionsStrict, "permissions.strict", "", options.PermissionsStrict, "Remove all permissions not declared in the annotations, including grafana's default role permissions. Without it only permissions set by the operator are changed, as recorded in the config map of --permissions.state-configmap")
+	cmd.Flags().StringVarP(&options.PermissionsMaxLevel, "permissions.max-level", "", "Edit", "Highest permission (View, Edit or Admin) the annotations may grant. Config maps granting more are not applied")
+	cmd.Flags().StringVarP(&options.PermissionsPrincipals, "permissions.principals", "", options.PermissionsPrincipals, "Principals the annotations may grant permissions to, e.g. 'team:*, role:Viewer'. Empty allows all teams, users and roles")
+	cmd.Flags().StringVarP(&options.PermissionsState, "permissions.state-configmap", "", options.PermissionsState, "Config map <namespace>/<name> owned by the operator in which it records the permissions it applied, so it can revoke them after a restart. Requires get, create and patch on the config map")
+
+	cmd.Flags().IntVarP(&options.Workers, "workers", "", options.Workers, "Number of workers processing changed config maps in parallel")
+	cmd.Flags().IntVarP(&options.MaxRetries, "max-retries", "", options.MaxRetries, "How often a failed config map or custom resource is retried with exponential backoff. Afterwards it is retried every --retry-max-delay")
+	cmd.Flags().DurationVarP(&options.RetryBaseDelay, "retry-base-delay", "", options.RetryBaseDelay, "Wait before the first retry of a failed config map or custom resource, doubled with every retry")
+	cmd.Flags().DurationVarP(&options.RetryMaxDelay, "retry-max-delay", "", options.RetryMaxDelay, "Longest wait between retries of a failed config map or custom resource")
+	cmd.Flags().DurationVarP(&options.ResyncPeriod, "resync-period", "", options.ResyncPeriod, "Interval in which all config maps are applied again. 0 disables the resync")
+
+	cmd.Flags().DurationVarP(&options.DriftInterval, "drift.interval", "", options.DriftInterval, "Interval in which grafana is checked for dashboards and datasources that differ from their config map. 0 disables the check")
+	cmd.Flags().BoolVarP(&options.DriftCorrect, "drift.correct", "", options.DriftCorrect, "Re-apply config maps whose objects were changed in grafana. If disabled drift is only reported")
+
+	cmd.Flags().BoolVarP(&options.Prune, "prune", "", options.Prune, "Delete dashboards, datasources and folders created by the operator that are no longer declared in any watched config map")
+	cmd.Flags().BoolVarP(&options.PruneDryRun, "prune.dry-run", "", options.PruneDryRun, "Only log the objects that would be deleted by --prune")
+	cmd.Flags().DurationVarP(&options.PruneInterval, "prune.interval", "", options.PruneInterval, "Interval in which orphaned objects are collected. 0 only collects once on startup")
 
 	return cmd, nil
 }
@@ -179,8 +254,16 @@ func Run(cmd *cobra.Command, options *operator.GrafanaConfigOperatorOptions) err
 		}
 	}
 
+	httpClient, err := newGrafanaHTTPClient(options)
+	if err != nil {
+		return err
+	}
+	if httpClient != nil {
+		grafana.DefaultHTTPClient = httpClient
+	}
+
 	// Relay OS signals to the chan
-	signals := make(chan os.Signal)
+	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
 	stop := make(chan struct{})
 
@@ -188,9 +271,43 @@ func Run(cmd *cobra.Command, options *operator.GrafanaConfigOperatorOptions) err
 		KubeConfig: options.KubeConfig,
 		Namespace:  options.Namespace,
 
-		GrafanaEndpoint: options.GrafanaEndpoint,
-		GrafanaAuth:     options.GrafanaAuth,
-		DbaasFolder:     options.DbaasFolder,
+		GrafanaEndpoint:       options.GrafanaEndpoint,
+		GrafanaAuth:           options.GrafanaAuth,
+		DbaasFolder:           options.DbaasFolder,
+		Workers:               options.Workers,
+		MaxRetries:            options.MaxRetries,
+		RetryBaseDelay:        options.RetryBaseDelay,
+		RetryMaxDelay:         options.RetryMaxDelay,
+		ResyncPeriod:          options.ResyncPeriod,
+		DriftInterval:         options.DriftInterval,
+		DriftCorrect:          options.DriftCorrect,
+		Prune:                 options.Prune,
+		PruneDryRun:           options.PruneDryRun,
+		PruneInterval:         options.PruneInterval,
+		FolderTemplate:        options.FolderTemplate,
+		NestedFolders:         options.NestedFolders,
+		PermissionsEnabled:    options.Permissions,
+		PermissionsStrict:     options.PermissionsStrict,
+		PermissionsMaxLevel:   options.PermissionsMaxLevel,
+		PermissionsPrincipals: options.PermissionsPrincipals,
+		PermissionsState:      options.PermissionsState,
+		DatasourceState:       options.DatasourceState,
+		DashboardCRD:          options.DashboardCRD,
+		DashboardURLPrefixes:  options.DashboardURLPrefixes,
+		DatasourceCRD:         options.DatasourceCRD,
+		FolderCRD:             options.FolderCRD,
+		Instance:              options.Instance,
+		CrossNamespaceSecrets: options.CrossNamespaceSecrets,
+		EnvVariablePrefix:     options.EnvVariablePrefix,
+		SecretRefreshInterval: options.SecretRefreshInterval,
+		GrafanaTimeout:        options.GrafanaTimeout,
+		GrafanaRetries:        options.GrafanaRetries,
+		GrafanaRetryBackoff:   options.GrafanaRetryBackoff,
+		GrafanaAuthFile:       options.GrafanaAuthFile,
+		GrafanaAuthSecret:     options.GrafanaAuthSecret,
+		GrafanaAuthProxyUser:  options.GrafanaAuthProxyUser,
+		GrafanaProxyHeader:    options.GrafanaProxyHeader,
+		GrafanaOrgID:          options.GrafanaOrgID,
 	}
 
 	if options.DashboardWatch {
@@ -199,7 +316,13 @@ func Run(cmd *cobra.Command, options *operator.GrafanaConfigOperatorOptions) err
 	if options.DatasourceWatch {
 		opts.DatasourceLabel = options.DatasourceLabel
 	}
-	if options.DatasourceWatch || options.DashboardWatch {
+	if options.NotifierWatch {
+		opts.NotifierLabel = options.NotifierLabel
+	}
+	if options.AlertingWatch {
+		opts.AlertingLabel = options.AlertingLabel
+	}
+	if options.DatasourceWatch || options.DashboardWatch || options.NotifierWatch || options.AlertingWatch || options.DashboardCRD || options.DatasourceCRD || options.FolderCRD {
 		watchCntlr, err := operator.NewgrafanaConfigController(opts)
 
 		if err != nil {
@@ -0,0 +1,198 @@
+package cmd
+
+/*
+Copyright [2019] [autonubil System GmbH]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	"gitlab.autonubil.net/kubernetes/grafana-config-operator/pkg/operator"
+)
+
+// Files of the CA bundle and client certificate, read again whenever they
+// change on disk, e.g. when the Secret they are mounted from is updated.
+type tlsFiles struct {
+	caFile   string
+	certFile string
+	keyFile  string
+
+	lock      sync.Mutex
+	caPool    *x509.CertPool
+	caStamp   time.Time
+	cert      *tls.Certificate
+	certStamp time.Time
+}
+
+// Latest modification time of the files
+func modTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// The CA pool, reloaded if the CA file changed. A pool that fails to reload
+// is kept until the file is fixed.
+func (f *tlsFiles) rootCAs() (*x509.CertPool, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	stamp, err := modTime(f.caFile)
+	if err == nil && (f.caPool == nil || !stamp.Equal(f.caStamp)) {
+		var pem []byte
+		if pem, err = ioutil.ReadFile(f.caFile); err == nil {
+			pool := x509.NewCertPool()
+			if pool.AppendCertsFromPEM(pem) {
+				if f.caPool != nil {
+					glog.V(1).Infof("Reloaded grafana CA bundle %s", f.caFile)
+				}
+				f.caPool, f.caStamp = pool, stamp
+			} else {
+				err = fmt.Errorf("no certificates found in %s", f.caFile)
+			}
+		}
+	}
+	if err != nil {
+		if f.caPool == nil {
+			return nil, err
+		}
+		glog.Warningf("Failed to reload grafana CA bundle, keeping the previous one (%v)", err)
+	}
+	return f.caPool, nil
+}
+
+// The client certificate, reloaded if the certificate or key changed
+func (f *tlsFiles) clientCertificate() (*tls.Certificate, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	stamp, err := modTime(f.certFile, f.keyFile)
+	if err == nil && (f.cert == nil || !stamp.Equal(f.certStamp)) {
+		var cert tls.Certificate
+		if cert, err = tls.LoadX509KeyPair(f.certFile, f.keyFile); err == nil {
+			if f.cert != nil {
+				glog.V(1).Infof("Reloaded grafana client certificate %s", f.certFile)
+			}
+			f.cert, f.certStamp = &cert, stamp
+		}
+	}
+	if err != nil {
+		if f.cert == nil {
+			return nil, err
+		}
+		glog.Warningf("Failed to reload grafana client certificate, keeping the previous one (%v)", err)
+	}
+	return f.cert, nil
+}
+
+// Verify the chain of the server against the current CA pool. It replaces
+// the verification of crypto/tls, which cannot pick up a changed pool.
+func (f *tlsFiles) verifyPeerCertificate(serverName string) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("grafana presented no certificate")
+		}
+		roots, err := f.rootCAs()
+		if err != nil {
+			return err
+		}
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			if certs[i], err = x509.ParseCertificate(raw); err != nil {
+				return err
+			}
+		}
+		opts := x509.VerifyOptions{Roots: roots, DNSName: serverName, Intermediates: x509.NewCertPool()}
+		for _, cert := range certs[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err = certs[0].Verify(opts)
+		return err
+	}
+}
+
+// Build the HTTP client for grafana from the TLS options. Returns nil if no
+// option is set, so the default client is used.
+func newGrafanaHTTPClient(options *operator.GrafanaConfigOperatorOptions) (*http.Client, error) {
+	if options.GrafanaCAFile == "" && options.GrafanaCertFile == "" && options.GrafanaKeyFile == "" && options.GrafanaServerName == "" && !options.GrafanaInsecure {
+		return nil, nil
+	}
+	if (options.GrafanaCertFile == "") != (options.GrafanaKeyFile == "") {
+		return nil, fmt.Errorf("--grafana.cert-file and --grafana.key-file must be given together")
+	}
+
+	config := &tls.Config{ServerName: options.GrafanaServerName}
+	files := &tlsFiles{caFile: options.GrafanaCAFile, certFile: options.GrafanaCertFile, keyFile: options.GrafanaKeyFile}
+	switch {
+	case options.GrafanaInsecure:
+		glog.Warningf("Certificate verification of grafana is disabled")
+		config.InsecureSkipVerify = true
+	case files.caFile != "":
+		if _, err := files.rootCAs(); err != nil {
+			return nil, fmt.Errorf("failed to load grafana CA bundle: %v", err)
+		}
+		serverName := options.GrafanaServerName
+		if serverName == "" {
+			endpoint, err := url.Parse(options.GrafanaEndpoint)
+			if err != nil {
+				return nil, err
+			}
+			if serverName, _, err = net.SplitHostPort(endpoint.Host); err != nil {
+				serverName = endpoint.Host
+			}
+		}
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = files.verifyPeerCertificate(serverName)
+	}
+	if files.certFile != "" {
+		if _, err := files.clientCertificate(); err != nil {
+			return nil, fmt.Errorf("failed to load grafana client certificate: %v", err)
+		}
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return files.clientCertificate()
+		}
+	}
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       config,
+	}
+	return &http.Client{Transport: transport}, nil
+}
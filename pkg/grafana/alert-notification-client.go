@@ -0,0 +1,103 @@
+package grafana
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// GetAlertNotifications gets all legacy alert notification channels.
+// It reflects GET /api/alert-notifications API call.
+func (r *Client) GetAlertNotifications() ([]AlertNotification, error) {
+	var (
+		raw           []byte
+		notifications []AlertNotification
+		err           error
+	)
+	if raw, _, err = r.get("api/alert-notifications", nil); err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(raw, &notifications)
+	return notifications, err
+}
+
+// GetAlertNotificationByUID gets a notification channel by its uid.
+// It reflects GET /api/alert-notifications/uid/:uid API call.
+func (r *Client) GetAlertNotificationByUID(uid string) (AlertNotification, error) {
+	var (
+		raw          []byte
+		notification AlertNotification
+		err          error
+	)
+	if raw, _, err = r.get(fmt.Sprintf("api/alert-notifications/uid/%s", uid), nil); err != nil {
+		return notification, err
+	}
+	err = json.Unmarshal(raw, &notification)
+	return notification, err
+}
+
+// GetAlertNotificationByName looks up a notification channel by its name. It
+// returns nil if there is no such channel.
+func (r *Client) GetAlertNotificationByName(name string) (*AlertNotification, error) {
+	notifications, err := r.GetAlertNotifications()
+	if err != nil {
+		return nil, err
+	}
+	for _, notification := range notifications {
+		if notification.Name == name {
+			return &notification, nil
+		}
+	}
+	return nil, nil
+}
+
+// CreateAlertNotification creates a new notification channel.
+// It reflects POST /api/alert-notifications API call.
+func (r *Client) CreateAlertNotification(notification AlertNotification) (AlertNotification, error) {
+	var (
+		raw     []byte
+		created AlertNotification
+		err     error
+	)
+	if raw, err = json.Marshal(notification); err != nil {
+		return created, err
+	}
+	if raw, _, err = r.post("api/alert-notifications", nil, raw); err != nil {
+		return created, err
+	}
+	err = json.Unmarshal(raw, &created)
+	return created, err
+}
+
+// UpdateAlertNotification updates the notification channel with the uid of
+// the passed channel.
+// It reflects PUT /api/alert-notifications/uid/:uid API call.
+func (r *Client) UpdateAlertNotification(notification AlertNotification) (AlertNotification, error) {
+	var (
+		raw     []byte
+		updated AlertNotification
+		err     error
+	)
+	if raw, err = json.Marshal(notification); err != nil {
+		return updated, err
+	}
+	if raw, _, err = r.put(fmt.Sprintf("api/alert-notifications/uid/%s", notification.UID), nil, raw); err != nil {
+		return updated, err
+	}
+	err = json.Unmarshal(raw, &updated)
+	return updated, err
+}
+
+// DeleteAlertNotification deletes a notification channel by its uid.
+// It reflects DELETE /api/alert-notifications/uid/:uid API call.
+func (r *Client) DeleteAlertNotification(uid string) (StatusMessage, error) {
+	var (
+		raw   []byte
+		reply StatusMessage
+		err   error
+	)
+	if raw, _, err = r.delete(fmt.Sprintf("api/alert-notifications/uid/%s", uid)); err != nil {
+		return StatusMessage{}, err
+	}
+	err = json.Unmarshal(raw, &reply)
+	return reply, err
+}
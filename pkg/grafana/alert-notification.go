@@ -0,0 +1,115 @@
+package grafana
+
+import (
+	"fmt"
+	"time"
+)
+
+// AlertNotification is a legacy alert notification channel as described in
+// http://docs.grafana.org/http_api/alerting_notification_channels/
+type AlertNotification struct {
+	ID                    uint                   `json:"id,omitempty"`
+	UID                   string                 `json:"uid,omitempty"`
+	Name                  string                 `json:"name"`
+	Type                  string                 `json:"type"`
+	IsDefault             bool                   `json:"isDefault"`
+	SendReminder          bool                   `json:"sendReminder"`
+	DisableResolveMessage bool                   `json:"disableResolveMessage"`
+	Frequency             string                 `json:"frequency,omitempty"`
+	Settings              map[string]interface{} `json:"settings"`
+	SecureSettings        map[string]string      `json:"secureSettings,omitempty"`
+	Created               *time.Time             `json:"created,omitempty"`
+	Updated               *time.Time             `json:"updated,omitempty"`
+}
+
+// Notifier is a notification channel in grafana's provisioning format
+// http://docs.grafana.org/administration/provisioning/#alert-notification-channels
+type Notifier struct {
+	Name                  string                         `yaml:"name"`
+	Type                  string                         `yaml:"type"`
+	UID                   string                         `yaml:"uid,omitempty"`
+	OrgID                 uint                           `yaml:"org_id,omitempty"`
+	OrgName               string                         `yaml:"org_name,omitempty"`
+	IsDefault             bool                           `yaml:"is_default,omitempty"`
+	SendReminder          bool                           `yaml:"send_reminder,omitempty"`
+	Frequency             string                         `yaml:"frequency,omitempty"`
+	DisableResolveMessage bool                           `yaml:"disable_resolve_message,omitempty"`
+	Settings              map[string]interface{}         `yaml:"settings,omitempty"`
+	SecureSettings        map[string]NotifierSecureValue `yaml:"secure_settings,omitempty"`
+}
+
+// NotifierRef identifies a notification channel to delete
+type NotifierRef struct {
+	Name    string `yaml:"name,omitempty"`
+	UID     string `yaml:"uid,omitempty"`
+	OrgID   uint   `yaml:"org_id,omitempty"`
+	OrgName string `yaml:"org_name,omitempty"`
+}
+
+// NotifierSecureValue is a secure setting given either inline or as a
+// reference to a key of a Kubernetes Secret:
+//
+//	secure_settings:
+//	  url:
+//	    secretKeyRef:
+//	      name: slack
+//	      key: webhook
+type NotifierSecureValue struct {
+	Value        string
+	SecretKeyRef *SecretKeyRef
+}
+
+// SecretKeyRef references a key of a Secret in the namespace of the ConfigMap
+type SecretKeyRef struct {
+	Name     string `yaml:"name"`
+	Key      string `yaml:"key"`
+	Optional bool   `yaml:"optional,omitempty"`
+}
+
+// UnmarshalYAML accepts plain strings as well as secretKeyRef mappings.
+func (v *NotifierSecureValue) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	if err := unmarshal(&value); err == nil {
+		v.Value = value
+		return nil
+	}
+	var ref struct {
+		SecretKeyRef *SecretKeyRef `yaml:"secretKeyRef"`
+	}
+	if err := unmarshal(&ref); err != nil {
+		return err
+	}
+	if ref.SecretKeyRef == nil || ref.SecretKeyRef.Name == "" || ref.SecretKeyRef.Key == "" {
+		return fmt.Errorf("secure setting must be a string or a secretKeyRef with name and key")
+	}
+	v.SecretKeyRef = ref.SecretKeyRef
+	return nil
+}
+
+// MarshalYAML writes the value in the form it was read.
+func (v NotifierSecureValue) MarshalYAML() (interface{}, error) {
+	if v.SecretKeyRef != nil {
+		return map[string]interface{}{"secretKeyRef": v.SecretKeyRef}, nil
+	}
+	return v.Value, nil
+}
+
+// AlertNotification converts a provisioned notifier to the notification
+// channel of the API. Secure settings have to be resolved by the caller.
+func (n Notifier) AlertNotification(secureSettings map[string]string) AlertNotification {
+	settings, _ := normalizeYAMLValue(n.Settings).(map[string]interface{})
+	if settings == nil {
+		settings = map[string]interface{}{}
+	}
+	return AlertNotification{
+		UID:                   n.UID,
+		Name:                  n.Name,
+		Type:                  n.Type,
+		IsDefault:             n.IsDefault,
+		SendReminder:          n.SendReminder,
+		DisableResolveMessage: n.DisableResolveMessage,
+		Frequency:             n.Frequency,
+		Settings:              settings,
+		SecureSettings:        secureSettings,
+	}
+}
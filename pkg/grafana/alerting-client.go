@@ -0,0 +1,239 @@
+package grafana
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Unmarshal the body of a successful provisioning call, which may be empty.
+func unmarshalProvisioningReply(raw []byte, v interface{}) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// GetContactPoints gets the receivers of all contact points.
+// It reflects GET /api/v1/provisioning/contact-points API call.
+func (r *Client) GetContactPoints() ([]ContactPoint, error) {
+	var (
+		raw           []byte
+		contactPoints []ContactPoint
+		err           error
+	)
+	if raw, _, err = r.get("api/v1/provisioning/contact-points", nil); err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(raw, &contactPoints)
+	return contactPoints, err
+}
+
+// CreateContactPoint creates a receiver of a contact point.
+// It reflects POST /api/v1/provisioning/contact-points API call.
+func (r *Client) CreateContactPoint(contactPoint ContactPoint) (ContactPoint, error) {
+	var (
+		raw     []byte
+		created ContactPoint
+		err     error
+	)
+	if raw, err = json.Marshal(contactPoint); err != nil {
+		return created, err
+	}
+	if raw, _, err = r.post("api/v1/provisioning/contact-points", nil, raw); err != nil {
+		return created, err
+	}
+	err = unmarshalProvisioningReply(raw, &created)
+	return created, err
+}
+
+// UpdateContactPoint updates the receiver with the uid of the passed one.
+// It reflects PUT /api/v1/provisioning/contact-points/:uid API call.
+func (r *Client) UpdateContactPoint(contactPoint ContactPoint) error {
+	raw, err := json.Marshal(contactPoint)
+	if err != nil {
+		return err
+	}
+	_, _, err = r.put(fmt.Sprintf("api/v1/provisioning/contact-points/%s", contactPoint.UID), nil, raw)
+	return err
+}
+
+// DeleteContactPoint deletes a receiver by its uid.
+// It reflects DELETE /api/v1/provisioning/contact-points/:uid API call.
+func (r *Client) DeleteContactPoint(uid string) error {
+	_, _, err := r.delete(fmt.Sprintf("api/v1/provisioning/contact-points/%s", uid))
+	return err
+}
+
+// GetNotificationPolicy gets the notification policy tree.
+// It reflects GET /api/v1/provisioning/policies API call.
+func (r *Client) GetNotificationPolicy() (NotificationPolicy, error) {
+	var (
+		raw    []byte
+		policy NotificationPolicy
+		err    error
+	)
+	if raw, _, err = r.get("api/v1/provisioning/policies", nil); err != nil {
+		return policy, err
+	}
+	err = json.Unmarshal(raw, &policy)
+	return policy, err
+}
+
+// SetNotificationPolicy replaces the notification policy tree.
+// It reflects PUT /api/v1/provisioning/policies API call.
+func (r *Client) SetNotificationPolicy(policy NotificationPolicy) error {
+	raw, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	_, _, err = r.put("api/v1/provisioning/policies", nil, raw)
+	return err
+}
+
+// ResetNotificationPolicy resets the notification policy tree to the default.
+// It reflects DELETE /api/v1/provisioning/policies API call.
+func (r *Client) ResetNotificationPolicy() error {
+	_, _, err := r.delete("api/v1/provisioning/policies")
+	return err
+}
+
+// GetMuteTimings gets all mute timings.
+// It reflects GET /api/v1/provisioning/mute-timings API call.
+func (r *Client) GetMuteTimings() ([]MuteTiming, error) {
+	var (
+		raw         []byte
+		muteTimings []MuteTiming
+		err         error
+	)
+	if raw, _, err = r.get("api/v1/provisioning/mute-timings", nil); err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(raw, &muteTimings)
+	return muteTimings, err
+}
+
+// GetMuteTiming gets a mute timing by its name.
+// It reflects GET /api/v1/provisioning/mute-timings/:name API call.
+func (r *Client) GetMuteTiming(name string) (MuteTiming, error) {
+	var (
+		raw        []byte
+		muteTiming MuteTiming
+		err        error
+	)
+	if raw, _, err = r.get(fmt.Sprintf("api/v1/provisioning/mute-timings/%s", name), nil); err != nil {
+		return muteTiming, err
+	}
+	err = json.Unmarshal(raw, &muteTiming)
+	return muteTiming, err
+}
+
+// CreateMuteTiming creates a new mute timing.
+// It reflects POST /api/v1/provisioning/mute-timings API call.
+func (r *Client) CreateMuteTiming(muteTiming MuteTiming) error {
+	raw, err := json.Marshal(muteTiming)
+	if err != nil {
+		return err
+	}
+	_, _, err = r.post("api/v1/provisioning/mute-timings", nil, raw)
+	return err
+}
+
+// UpdateMuteTiming updates the mute timing with the name of the passed one.
+// It reflects PUT /api/v1/provisioning/mute-timings/:name API call.
+func (r *Client) UpdateMuteTiming(muteTiming MuteTiming) error {
+	raw, err := json.Marshal(muteTiming)
+	if err != nil {
+		return err
+	}
+	_, _, err = r.put(fmt.Sprintf("api/v1/provisioning/mute-timings/%s", muteTiming.Name), nil, raw)
+	return err
+}
+
+// DeleteMuteTiming deletes a mute timing by its name.
+// It reflects DELETE /api/v1/provisioning/mute-timings/:name API call.
+func (r *Client) DeleteMuteTiming(name string) error {
+	_, _, err := r.delete(fmt.Sprintf("api/v1/provisioning/mute-timings/%s", name))
+	return err
+}
+
+// GetMessageTemplates gets all notification templates.
+// It reflects GET /api/v1/provisioning/templates API call.
+func (r *Client) GetMessageTemplates() ([]MessageTemplate, error) {
+	var (
+		raw       []byte
+		templates []MessageTemplate
+		err       error
+	)
+	if raw, _, err = r.get("api/v1/provisioning/templates", nil); err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(raw, &templates)
+	return templates, err
+}
+
+// SetMessageTemplate creates or updates a notification template.
+// It reflects PUT /api/v1/provisioning/templates/:name API call.
+func (r *Client) SetMessageTemplate(template MessageTemplate) error {
+	raw, err := json.Marshal(map[string]string{"template": template.Template})
+	if err != nil {
+		return err
+	}
+	_, _, err = r.put(fmt.Sprintf("api/v1/provisioning/templates/%s", template.Name), nil, raw)
+	return err
+}
+
+// DeleteMessageTemplate deletes a notification template by its name.
+// It reflects DELETE /api/v1/provisioning/templates/:name API call.
+func (r *Client) DeleteMessageTemplate(name string) error {
+	_, _, err := r.delete(fmt.Sprintf("api/v1/provisioning/templates/%s", name))
+	return err
+}
+
+// GetAlertRule gets an alert rule by its uid.
+// It reflects GET /api/v1/provisioning/alert-rules/:uid API call.
+func (r *Client) GetAlertRule(uid string) (AlertRule, error) {
+	var (
+		raw  []byte
+		rule AlertRule
+		err  error
+	)
+	if raw, _, err = r.get(fmt.Sprintf("api/v1/provisioning/alert-rules/%s", uid), nil); err != nil {
+		return rule, err
+	}
+	err = json.Unmarshal(raw, &rule)
+	return rule, err
+}
+
+// DeleteAlertRule deletes an alert rule by its uid.
+// It reflects DELETE /api/v1/provisioning/alert-rules/:uid API call.
+func (r *Client) DeleteAlertRule(uid string) error {
+	_, _, err := r.delete(fmt.Sprintf("api/v1/provisioning/alert-rules/%s", uid))
+	return err
+}
+
+// GetAlertRuleGroup gets a rule group with all its rules.
+// It reflects GET /api/v1/provisioning/folder/:folderUid/rule-groups/:group API call.
+func (r *Client) GetAlertRuleGroup(folderUID string, group string) (AlertRuleGroup, error) {
+	var (
+		raw       []byte
+		ruleGroup AlertRuleGroup
+		err       error
+	)
+	if raw, _, err = r.get(fmt.Sprintf("api/v1/provisioning/folder/%s/rule-groups/%s", folderUID, group), nil); err != nil {
+		return ruleGroup, err
+	}
+	err = json.Unmarshal(raw, &ruleGroup)
+	return ruleGroup, err
+}
+
+// SetAlertRuleGroup creates or replaces a rule group. Rules of the group that
+// are not part of the passed group are deleted by grafana.
+// It reflects PUT /api/v1/provisioning/folder/:folderUid/rule-groups/:group API call.
+func (r *Client) SetAlertRuleGroup(ruleGroup AlertRuleGroup) error {
+	raw, err := json.Marshal(ruleGroup)
+	if err != nil {
+		return err
+	}
+	_, _, err = r.put(fmt.Sprintf("api/v1/provisioning/folder/%s/rule-groups/%s", ruleGroup.FolderUID, ruleGroup.Title), nil, raw)
+	return err
+}
@@ -0,0 +1,228 @@
+package grafana
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ContactPoint is a single receiver of a contact point as used by the alerting
+// provisioning API. Receivers sharing the same name form one contact point.
+// https://grafana.com/docs/grafana/latest/developers/http_api/alerting_provisioning/
+type ContactPoint struct {
+	UID                   string                 `json:"uid,omitempty"`
+	Name                  string                 `json:"name"`
+	Type                  string                 `json:"type"`
+	Settings              map[string]interface{} `json:"settings"`
+	DisableResolveMessage bool                   `json:"disableResolveMessage"`
+	Provenance            string                 `json:"provenance,omitempty"`
+}
+
+// NotificationPolicy is a node of the notification policy tree
+type NotificationPolicy struct {
+	Receiver            string                `json:"receiver,omitempty" yaml:"receiver,omitempty"`
+	GroupBy             []string              `json:"group_by,omitempty" yaml:"group_by,omitempty"`
+	Matchers            []string              `json:"matchers,omitempty" yaml:"matchers,omitempty"`
+	ObjectMatchers      [][]string            `json:"object_matchers,omitempty" yaml:"object_matchers,omitempty"`
+	MuteTimeIntervals   []string              `json:"mute_time_intervals,omitempty" yaml:"mute_time_intervals,omitempty"`
+	ActiveTimeIntervals []string              `json:"active_time_intervals,omitempty" yaml:"active_time_intervals,omitempty"`
+	Continue            bool                  `json:"continue,omitempty" yaml:"continue,omitempty"`
+	GroupWait           string                `json:"group_wait,omitempty" yaml:"group_wait,omitempty"`
+	GroupInterval       string                `json:"group_interval,omitempty" yaml:"group_interval,omitempty"`
+	RepeatInterval      string                `json:"repeat_interval,omitempty" yaml:"repeat_interval,omitempty"`
+	Routes              []*NotificationPolicy `json:"routes,omitempty" yaml:"routes,omitempty"`
+	Provenance          string                `json:"provenance,omitempty" yaml:"-"`
+}
+
+// MuteTiming is a named set of time intervals in which notifications are muted
+type MuteTiming struct {
+	Name          string         `json:"name" yaml:"name"`
+	TimeIntervals []TimeInterval `json:"time_intervals" yaml:"time_intervals"`
+	Provenance    string         `json:"provenance,omitempty" yaml:"-"`
+}
+
+// TimeInterval of a mute timing
+type TimeInterval struct {
+	Times       []TimeRange `json:"times,omitempty" yaml:"times,omitempty"`
+	Weekdays    []string    `json:"weekdays,omitempty" yaml:"weekdays,omitempty"`
+	DaysOfMonth []string    `json:"days_of_month,omitempty" yaml:"days_of_month,omitempty"`
+	Months      []string    `json:"months,omitempty" yaml:"months,omitempty"`
+	Years       []string    `json:"years,omitempty" yaml:"years,omitempty"`
+	Location    string      `json:"location,omitempty" yaml:"location,omitempty"`
+}
+
+// TimeRange within a day, e.g. 06:00 to 23:59
+type TimeRange struct {
+	StartTime string `json:"start_time" yaml:"start_time"`
+	EndTime   string `json:"end_time" yaml:"end_time"`
+}
+
+// MessageTemplate is a named notification template
+type MessageTemplate struct {
+	Name       string `json:"name" yaml:"name"`
+	Template   string `json:"template" yaml:"template"`
+	Provenance string `json:"provenance,omitempty" yaml:"-"`
+}
+
+// AlertRule is a provisioned alert rule. The folder and group are taken from
+// the rule group in provisioning files.
+type AlertRule struct {
+	ID           uint              `json:"id,omitempty" yaml:"-"`
+	UID          string            `json:"uid,omitempty" yaml:"uid,omitempty"`
+	OrgID        uint              `json:"orgID,omitempty" yaml:"-"`
+	FolderUID    string            `json:"folderUID" yaml:"-"`
+	RuleGroup    string            `json:"ruleGroup" yaml:"-"`
+	Title        string            `json:"title" yaml:"title"`
+	Condition    string            `json:"condition" yaml:"condition"`
+	Data         []AlertQuery      `json:"data" yaml:"data"`
+	NoDataState  string            `json:"noDataState,omitempty" yaml:"noDataState,omitempty"`
+	ExecErrState string            `json:"execErrState,omitempty" yaml:"execErrState,omitempty"`
+	For          string            `json:"for,omitempty" yaml:"for,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	IsPaused     bool              `json:"isPaused" yaml:"isPaused,omitempty"`
+	DashboardUID string            `json:"-" yaml:"dashboardUid,omitempty"`
+	PanelID      uint              `json:"-" yaml:"panelId,omitempty"`
+	Provenance   string            `json:"provenance,omitempty" yaml:"-"`
+}
+
+// AlertQuery is a query or expression of an alert rule
+type AlertQuery struct {
+	RefID             string            `json:"refId" yaml:"refId"`
+	QueryType         string            `json:"queryType,omitempty" yaml:"queryType,omitempty"`
+	RelativeTimeRange RelativeTimeRange `json:"relativeTimeRange" yaml:"relativeTimeRange"`
+	DatasourceUID     string            `json:"datasourceUid" yaml:"datasourceUid"`
+	Model             interface{}       `json:"model" yaml:"model"`
+}
+
+// RelativeTimeRange of a query in seconds before now
+type RelativeTimeRange struct {
+	From int64 `json:"from" yaml:"from"`
+	To   int64 `json:"to" yaml:"to"`
+}
+
+// AlertRuleGroup is a group of alert rules in a folder that are evaluated
+// together. The interval is given in seconds.
+type AlertRuleGroup struct {
+	Title     string      `json:"title"`
+	FolderUID string      `json:"folderUid"`
+	Interval  int64       `json:"interval"`
+	Rules     []AlertRule `json:"rules"`
+}
+
+// AlertingRef identifies an alerting object to delete, by uid for rules and
+// contact points and by name for mute timings and templates
+type AlertingRef struct {
+	OrgID uint   `yaml:"orgId,omitempty"`
+	UID   string `yaml:"uid,omitempty"`
+	Name  string `yaml:"name,omitempty"`
+}
+
+// ContactPointConfig is a contact point in grafana's provisioning format
+type ContactPointConfig struct {
+	OrgID     uint                   `yaml:"orgId,omitempty"`
+	Name      string                 `yaml:"name"`
+	Receivers []ContactPointReceiver `yaml:"receivers"`
+}
+
+// ContactPointReceiver is a single integration of a provisioned contact point
+type ContactPointReceiver struct {
+	UID                   string                 `yaml:"uid,omitempty"`
+	Type                  string                 `yaml:"type"`
+	Settings              map[string]interface{} `yaml:"settings,omitempty"`
+	DisableResolveMessage bool                   `yaml:"disableResolveMessage,omitempty"`
+}
+
+// PolicyConfig is the notification policy tree of an organization in
+// grafana's provisioning format
+type PolicyConfig struct {
+	OrgID              uint `yaml:"orgId,omitempty"`
+	NotificationPolicy `yaml:",inline"`
+}
+
+// MuteTimingConfig is a mute timing in grafana's provisioning format
+type MuteTimingConfig struct {
+	OrgID      uint `yaml:"orgId,omitempty"`
+	MuteTiming `yaml:",inline"`
+}
+
+// TemplateConfig is a notification template in grafana's provisioning format
+type TemplateConfig struct {
+	OrgID           uint `yaml:"orgId,omitempty"`
+	MessageTemplate `yaml:",inline"`
+}
+
+// AlertRuleGroupConfig is a rule group in grafana's provisioning format. The
+// folder is given by its title.
+type AlertRuleGroupConfig struct {
+	OrgID    uint        `yaml:"orgId,omitempty"`
+	Name     string      `yaml:"name"`
+	Folder   string      `yaml:"folder"`
+	Interval string      `yaml:"interval"`
+	Rules    []AlertRule `yaml:"rules"`
+}
+
+// ContactPoints converts a provisioned contact point to the receivers of the API
+func (c ContactPointConfig) ContactPoints() []ContactPoint {
+	result := make([]ContactPoint, 0, len(c.Receivers))
+	for _, receiver := range c.Receivers {
+		settings, _ := normalizeYAMLValue(receiver.Settings).(map[string]interface{})
+		if settings == nil {
+			settings = map[string]interface{}{}
+		}
+		result = append(result, ContactPoint{
+			UID:                   receiver.UID,
+			Name:                  c.Name,
+			Type:                  receiver.Type,
+			Settings:              settings,
+			DisableResolveMessage: receiver.DisableResolveMessage,
+		})
+	}
+	return result
+}
+
+// RuleGroup converts a provisioned rule group to the rule group of the API
+// for the folder with the given uid
+func (g AlertRuleGroupConfig) RuleGroup(folderUID string) (AlertRuleGroup, error) {
+	interval, err := parseIntervalSeconds(g.Interval)
+	if err != nil {
+		return AlertRuleGroup{}, fmt.Errorf("rule group %s: %v", g.Name, err)
+	}
+	group := AlertRuleGroup{Title: g.Name, FolderUID: folderUID, Interval: interval}
+	for _, rule := range g.Rules {
+		rule.FolderUID = folderUID
+		rule.RuleGroup = g.Name
+		if rule.DashboardUID != "" {
+			annotations := make(map[string]string, len(rule.Annotations)+2)
+			for k, v := range rule.Annotations {
+				annotations[k] = v
+			}
+			annotations["__dashboardUid__"] = rule.DashboardUID
+			annotations["__panelId__"] = strconv.FormatUint(uint64(rule.PanelID), 10)
+			rule.Annotations = annotations
+		}
+		data := make([]AlertQuery, len(rule.Data))
+		for i, query := range rule.Data {
+			query.Model = normalizeYAMLValue(query.Model)
+			data[i] = query
+		}
+		rule.Data = data
+		group.Rules = append(group.Rules, rule)
+	}
+	return group, nil
+}
+
+// Intervals are durations like 1m or plain numbers of seconds
+func parseIntervalSeconds(interval string) (int64, error) {
+	if interval == "" {
+		return 60, nil
+	}
+	if seconds, err := strconv.ParseInt(interval, 10, 64); err == nil {
+		return seconds, nil
+	}
+	duration, err := time.ParseDuration(interval)
+	if err != nil {
+		return 0, fmt.Errorf("invalid interval '%s'", interval)
+	}
+	return int64(duration / time.Second), nil
+}
@@ -82,7 +82,7 @@ type (
 		Type        string   `json:"type"`
 		Auto        bool     `json:"auto,omitempty"`
 		AutoCount   *int     `json:"auto_count,omitempty"`
-		Datasource  *string  `json:"datasource"`
+		Datasource  *DashboardDatasourceRef `json:"datasource"`
 		Refresh     BoolInt  `json:"refresh"`
 		Options     []Option `json:"options"`
 		IncludeAll  bool     `json:"includeAll"`
@@ -111,7 +111,7 @@ type (
 	}
 	Annotation struct {
 		Name       string  `json:"name"`
-		Datasource *string `json:"datasource"`
+		Datasource *DashboardDatasourceRef `json:"datasource"`
 		ShowLine   bool    `json:"showLine"`
 		IconColor  string  `json:"iconColor"`
 		LineColor  string  `json:"lineColor"`
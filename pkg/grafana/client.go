@@ -20,30 +20,53 @@ package grafana
 
 import (
 	"bytes"
-	"fmt"
+	"context"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // DefaultHTTPClient initialized Grafana with appropriate conditions.
 // It allows you globally redefine HTTP client.
-var DefaultHTTPClient = http.DefaultClient
+var DefaultHTTPClient = &http.Client{}
+
+// Defaults of new clients, see WithTimeout and WithRetries
+var (
+	DefaultTimeout      = 30 * time.Second
+	DefaultRetries      = 3
+	DefaultRetryBackoff = 500 * time.Millisecond
+)
+
+// DefaultAuthProxyHeader is the header grafana reads the user name from when
+// it runs behind an authenticating proxy, see WithAuthProxy.
+const DefaultAuthProxyHeader = "X-WEBAUTH-USER"
 
 // Client uses Grafana REST API for interacting with Grafana server.
 type Client struct {
-	baseURL   string
-	key       string
-	basicAuth bool
-	client    *http.Client
+	baseURL      string
+	credentials  Credentials
+	client       *http.Client
+	ctx          context.Context
+	timeout      time.Duration
+	retries      int
+	retryBackoff time.Duration
+	// auth proxy header and user, sent if the user is set
+	authProxyHeader string
+	authProxyUser   string
+	// organization of the requests, 0 for the current one of the user
+	orgID uint
 }
 
 // StatusMessage reflects status message as it returned by Grafana REST API.
 type StatusMessage struct {
 	ID      *uint   `json:"id"`
+	UID     *string `json:"uid"`
+	URL     *string `json:"url"`
 	OrgID   *uint   `json:"orgId"`
 	Message *string `json:"message"`
 	Slug    *string `json:"slug"`
@@ -51,20 +74,99 @@ type StatusMessage struct {
 	Status  *string `json:"resp"`
 }
 
+// Credentials of the client, either basic authentication or a token, i.e.
+// an API key or the token of a service account.
+type Credentials struct {
+	User     string
+	Password string
+	Token    string
+}
+
+// ParseCredentials accepts either 'username:password' basic authentication
+// credentials or a token. The user name ends at the first colon, so passwords
+// may contain any character.
+func ParseCredentials(apiKeyOrBasicAuth string) Credentials {
+	colon := strings.Index(apiKeyOrBasicAuth, ":")
+	if colon < 0 {
+		return Credentials{Token: apiKeyOrBasicAuth}
+	}
+	return Credentials{User: apiKeyOrBasicAuth[:colon], Password: apiKeyOrBasicAuth[colon+1:]}
+}
+
 // NewClient initializes client for interacting with an instance of Grafana server;
 // apiKeyOrBasicAuth accepts either 'username:password' basic authentication credentials,
 // or a Grafana API key
 func NewClient(apiURL, apiKeyOrBasicAuth string, client *http.Client) *Client {
-	key := ""
-	basicAuth := strings.Contains(apiKeyOrBasicAuth, ":")
-	baseURL, _ := url.Parse(apiURL)
-	if !basicAuth {
-		key = fmt.Sprintf("Bearer %s", apiKeyOrBasicAuth)
-	} else {
-		parts := strings.Split(apiKeyOrBasicAuth, ":")
-		baseURL.User = url.UserPassword(parts[0], parts[1])
+	return NewClientWithCredentials(apiURL, ParseCredentials(apiKeyOrBasicAuth), client)
+}
+
+// NewClientWithCredentials initializes client for interacting with an instance
+// of Grafana server with the given credentials.
+func NewClientWithCredentials(apiURL string, credentials Credentials, client *http.Client) *Client {
+	return &Client{
+		baseURL:      apiURL,
+		credentials:  credentials,
+		client:       client,
+		ctx:          context.Background(),
+		timeout:      DefaultTimeout,
+		retries:      DefaultRetries,
+		retryBackoff: DefaultRetryBackoff,
+	}
+}
+
+// WithContext returns a copy of the client whose requests are cancelled
+// together with ctx.
+func (r *Client) WithContext(ctx context.Context) *Client {
+	c := *r
+	c.ctx = ctx
+	return &c
+}
+
+// WithTimeout returns a copy of the client that gives up on a single attempt
+// of a request after timeout. 0 disables the timeout.
+func (r *Client) WithTimeout(timeout time.Duration) *Client {
+	c := *r
+	c.timeout = timeout
+	return &c
+}
+
+// WithRetries returns a copy of the client that retries idempotent requests
+// up to retries times on connection errors, 429 and 5xx responses. The wait
+// between attempts starts at backoff and doubles with every attempt, unless
+// grafana asks for a longer one with Retry-After.
+func (r *Client) WithRetries(retries int, backoff time.Duration) *Client {
+	c := *r
+	c.retries = retries
+	c.retryBackoff = backoff
+	return &c
+}
+
+// WithAuthProxy returns a copy of the client that authenticates as user with
+// the header of grafana's auth proxy, DefaultAuthProxyHeader if header is
+// empty. Credentials of the client are still sent, e.g. for the proxy itself.
+func (r *Client) WithAuthProxy(header string, user string) *Client {
+	c := *r
+	if header == "" {
+		header = DefaultAuthProxyHeader
 	}
-	return &Client{baseURL: baseURL.String(), basicAuth: basicAuth, key: key, client: client}
+	c.authProxyHeader = header
+	c.authProxyUser = user
+	return &c
+}
+
+// WithOrgID returns a copy of the client whose requests act in the
+// organization with the id orgID instead of the current organization of the
+// user, e.g. client.WithOrgID(2).GetAllDatasources(). 0 resets it to the
+// current organization.
+func (r *Client) WithOrgID(orgID uint) *Client {
+	c := *r
+	c.orgID = orgID
+	return &c
+}
+
+// OrgID returns the organization set by WithOrgID, 0 if none is set.
+func (r *Client) OrgID() uint {
+	return r.orgID
 }
 
 func (r *Client) get(query string, params url.Values) ([]byte, int, error) {
@@ -72,39 +174,89 @@ func (r *Client) get(query string, params url.Values) ([]byte, int, error) {
 }
 
 func (r *Client) patch(query string, params url.Values, body []byte) ([]byte, int, error) {
-	return r.doRequest("PATCH", query, params, bytes.NewBuffer(body))
+	return r.doRequest("PATCH", query, params, body)
 }
 
 func (r *Client) put(query string, params url.Values, body []byte) ([]byte, int, error) {
-	return r.doRequest("PUT", query, params, bytes.NewBuffer(body))
+	return r.doRequest("PUT", query, params, body)
 }
 
 func (r *Client) post(query string, params url.Values, body []byte) ([]byte, int, error) {
-	return r.doRequest("POST", query, params, bytes.NewBuffer(body))
+	return r.doRequest("POST", query, params, body)
 }
 
 func (r *Client) delete(query string) ([]byte, int, error) {
 	return r.doRequest("DELETE", query, nil, nil)
 }
 
-func (r *Client) doRequest(method, query string, params url.Values, buf io.Reader) ([]byte, int, error) {
-	u, _ := url.Parse(r.baseURL)
+// Send a request and retry it if it is idempotent and failed temporarily
+func (r *Client) doRequest(method, query string, params url.Values, body []byte) ([]byte, int, error) {
+	u, err := url.Parse(r.baseURL)
+	if err != nil {
+		return nil, 0, err
+	}
 	u.Path = path.Join(u.Path, query)
 	if params != nil {
 		u.RawQuery = params.Encode()
 	}
-	req, err := http.NewRequest(method, u.String(), buf)
-	if !r.basicAuth {
-		req.Header.Set("Authorization", r.key)
+	for attempt := 0; ; attempt++ {
+		data, code, retryAfter, err := r.attempt(method, u.String(), body)
+		if err == nil {
+			if code < 200 || code > 299 {
+				err = newAPIError(method, query, code, data)
+			}
+			if !retryableStatus(code) {
+				return data, code, err
+			}
+		} else if r.ctx.Err() != nil {
+			return nil, 0, err
+		}
+		if attempt >= r.retries || !idempotent(method) {
+			return data, code, err
+		}
+		if err := sleep(r.ctx, backoff(r.retryBackoff, attempt, retryAfter)); err != nil {
+			return data, code, err
+		}
+	}
+}
+
+// A single attempt of a request, limited by the timeout of the client.
+// Returns the Retry-After of the response, if any.
+func (r *Client) attempt(method, u string, body []byte) ([]byte, int, time.Duration, error) {
+	var buf io.Reader
+	if body != nil {
+		buf = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, u, buf)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	ctx := r.ctx
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+	req = req.WithContext(ctx)
+	if r.credentials.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.credentials.Token)
+	} else if r.credentials.User != "" {
+		req.SetBasicAuth(r.credentials.User, r.credentials.Password)
+	}
+	if r.authProxyUser != "" {
+		req.Header.Set(r.authProxyHeader, r.authProxyUser)
+	}
+	if r.orgID != 0 {
+		req.Header.Set("X-Grafana-Org-Id", strconv.FormatUint(uint64(r.orgID), 10))
 	}
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", "grafana-config-operator")
 	resp, err := r.client.Do(req)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, 0, err
 	}
 	data, err := ioutil.ReadAll(resp.Body)
 	resp.Body.Close()
-	return data, resp.StatusCode, err
+	return data, resp.StatusCode, retryAfter(resp.Header.Get("Retry-After")), err
 }
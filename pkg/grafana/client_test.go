@@ -0,0 +1,259 @@
+package grafana
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseCredentials(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Credentials
+	}{
+		{value: "admin:admin", want: Credentials{User: "admin", Password: "admin"}},
+		{value: "admin:pa:ss:word", want: Credentials{User: "admin", Password: "pa:ss:word"}},
+		{value: "admin:", want: Credentials{User: "admin"}},
+		{value: "eyJrIjoiT0tTcG1pUlY2RnVKZTFVaDFsNFZXdE9ZWmNrMkZYbk", want: Credentials{Token: "eyJrIjoiT0tTcG1pUlY2RnVKZTFVaDFsNFZXdE9ZWmNrMkZYbk"}},
+		{value: "", want: Credentials{}},
+	}
+	for _, test := range tests {
+		if got := ParseCredentials(test.value); got != test.want {
+			t.Errorf("ParseCredentials(%q) = %+v, want %+v", test.value, got, test.want)
+		}
+	}
+}
+
+// A fake grafana answering every request with the next of the given status
+// codes, the last one is repeated. The requests are recorded.
+type fakeGrafana struct {
+	*httptest.Server
+	mu       sync.Mutex
+	codes    []int
+	headers  http.Header
+	requests []*http.Request
+}
+
+func newFakeGrafana(codes ...int) *fakeGrafana {
+	f := &fakeGrafana{codes: codes, headers: http.Header{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		code := f.codes[0]
+		if len(f.codes) > 1 {
+			f.codes = f.codes[1:]
+		}
+		f.requests = append(f.requests, r)
+		for key, values := range f.headers {
+			w.Header()[key] = values
+		}
+		f.mu.Unlock()
+		w.WriteHeader(code)
+		if code == http.StatusOK {
+			w.Write([]byte(`{"id":1,"name":"Main Org."}`))
+		} else {
+			w.Write([]byte(`{"message":"failed"}`))
+		}
+	}))
+	return f
+}
+
+func (f *fakeGrafana) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.requests)
+}
+
+func (f *fakeGrafana) last() *http.Request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[len(f.requests)-1]
+}
+
+func (f *fakeGrafana) client(credentials string) *Client {
+	return NewClient(f.URL, credentials, http.DefaultClient).WithRetries(3, time.Millisecond)
+}
+
+func TestDoRequestStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		codes    []int
+		method   string
+		wantCode int
+		attempts int
+	}{
+		{name: "success", codes: []int{200}, method: "GET", wantCode: 200, attempts: 1},
+		{name: "not found is final", codes: []int{404}, method: "GET", wantCode: 404, attempts: 1},
+		{name: "GET is retried on 503", codes: []int{503, 502, 200}, method: "GET", wantCode: 200, attempts: 3},
+		{name: "GET is retried on 429", codes: []int{429, 200}, method: "GET", wantCode: 200, attempts: 2},
+		{name: "PUT is retried", codes: []int{500, 200}, method: "PUT", wantCode: 200, attempts: 2},
+		{name: "POST is not retried", codes: []int{502, 200}, method: "POST", wantCode: 502, attempts: 1},
+		{name: "PATCH is not retried", codes: []int{503, 200}, method: "PATCH", wantCode: 503, attempts: 1},
+		{name: "501 is not retried", codes: []int{501, 200}, method: "GET", wantCode: 501, attempts: 1},
+		{name: "retries are limited", codes: []int{503}, method: "GET", wantCode: 503, attempts: 4},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := newFakeGrafana(test.codes...)
+			defer f.Close()
+
+			_, code, err := f.client("admin:admin").doRequest(test.method, "api/org", nil, []byte(`{}`))
+			if code != test.wantCode {
+				t.Errorf("code = %d, want %d", code, test.wantCode)
+			}
+			if test.wantCode == 200 && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if test.wantCode != 200 {
+				if StatusCode(err) != test.wantCode {
+					t.Errorf("error = %v, want an APIError with status %d", err, test.wantCode)
+				} else if apiErr := err.(*APIError); apiErr.Message != "failed" || apiErr.Endpoint != "api/org" {
+					t.Errorf("unexpected error %+v", apiErr)
+				}
+			}
+			if f.count() != test.attempts {
+				t.Errorf("%d attempts, want %d", f.count(), test.attempts)
+			}
+		})
+	}
+}
+
+func TestDoRequestRetryAfter(t *testing.T) {
+	f := newFakeGrafana(503, 200)
+	defer f.Close()
+	f.headers.Set("Retry-After", "1")
+
+	start := time.Now()
+	if _, err := f.client("").GetCurrentOrg(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if waited := time.Since(start); waited < time.Second {
+		t.Errorf("retried after %s, want the Retry-After of 1s", waited)
+	}
+}
+
+func TestDoRequestCancel(t *testing.T) {
+	f := newFakeGrafana(503)
+	defer f.Close()
+	f.headers.Set("Retry-After", "60")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	start := time.Now()
+	_, err := f.client("").WithContext(ctx).GetCurrentOrg()
+	if err != context.Canceled {
+		t.Errorf("error = %v, want %v", err, context.Canceled)
+	}
+	if waited := time.Since(start); waited > 10*time.Second {
+		t.Errorf("cancelled request returned after %s", waited)
+	}
+}
+
+func TestDoRequestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := NewClient(server.URL, "", http.DefaultClient).WithTimeout(50*time.Millisecond).WithRetries(0, 0)
+	if _, err := client.GetCurrentOrg(); err == nil {
+		t.Error("expected the request to time out")
+	}
+}
+
+func TestDoRequestHeaders(t *testing.T) {
+	tests := []struct {
+		name          string
+		client        func(f *fakeGrafana) *Client
+		authorization string
+		proxyHeader   string
+		proxyUser     string
+		orgID         string
+	}{
+		{
+			name:          "token",
+			client:        func(f *fakeGrafana) *Client { return f.client("t0k3n") },
+			authorization: "Bearer t0k3n",
+		},
+		{
+			name:          "basic auth",
+			client:        func(f *fakeGrafana) *Client { return f.client("admin:admin") },
+			authorization: "Basic YWRtaW46YWRtaW4=",
+		},
+		{
+			name:        "auth proxy",
+			client:      func(f *fakeGrafana) *Client { return f.client("").WithAuthProxy("", "operator") },
+			proxyHeader: DefaultAuthProxyHeader,
+			proxyUser:   "operator",
+		},
+		{
+			name:          "auth proxy with custom header and credentials",
+			client:        func(f *fakeGrafana) *Client { return f.client("t0k3n").WithAuthProxy("X-Forwarded-User", "operator") },
+			authorization: "Bearer t0k3n",
+			proxyHeader:   "X-Forwarded-User",
+			proxyUser:     "operator",
+		},
+		{
+			name:   "organization",
+			client: func(f *fakeGrafana) *Client { return f.client("").WithOrgID(3) },
+			orgID:  "3",
+		},
+		{
+			name:   "organization reset",
+			client: func(f *fakeGrafana) *Client { return f.client("").WithOrgID(3).WithOrgID(0) },
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := newFakeGrafana(200)
+			defer f.Close()
+
+			if _, err := test.client(f).GetCurrentOrg(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			request := f.last()
+			if got := request.Header.Get("Authorization"); got != test.authorization {
+				t.Errorf("Authorization = %q, want %q", got, test.authorization)
+			}
+			if test.proxyHeader != "" {
+				if got := request.Header.Get(test.proxyHeader); got != test.proxyUser {
+					t.Errorf("%s = %q, want %q", test.proxyHeader, got, test.proxyUser)
+				}
+			} else if got := request.Header.Get(DefaultAuthProxyHeader); got != "" {
+				t.Errorf("%s = %q, want none", DefaultAuthProxyHeader, got)
+			}
+			if got := request.Header.Get("X-Grafana-Org-Id"); got != test.orgID {
+				t.Errorf("X-Grafana-Org-Id = %q, want %q", got, test.orgID)
+			}
+		})
+	}
+}
+
+func TestWithOrgIDPerCall(t *testing.T) {
+	f := newFakeGrafana(200)
+	defer f.Close()
+
+	client := f.client("")
+	if _, err := client.WithOrgID(2).GetCurrentOrg(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := f.last().Header.Get("X-Grafana-Org-Id"); got != "2" {
+		t.Errorf("X-Grafana-Org-Id = %q, want 2", got)
+	}
+	if _, err := client.GetCurrentOrg(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := f.last().Header.Get("X-Grafana-Org-Id"); got != "" {
+		t.Errorf("X-Grafana-Org-Id = %q, want none for the original client", got)
+	}
+	if client.OrgID() != 0 {
+		t.Errorf("OrgID() = %d, want 0", client.OrgID())
+	}
+}
@@ -0,0 +1,138 @@
+package grafana
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+)
+
+// Keys that are maintained by grafana itself and never part of a desired state
+var (
+	dashboardIgnoredKeys  = []string{"id", "version", "iteration"}
+	datasourceIgnoredKeys = []string{"id", "orgId", "version", "readOnly", "password", "basicAuthPassword", "secureJsonData", "secureJsonFields"}
+)
+
+// DashboardDrifted reports whether the dashboard stored in grafana (as returned by
+// GetRawDashboardByUID) differs from the desired board. Only values declared in the
+// desired board are compared, so defaults filled in by grafana are not reported.
+func DashboardDrifted(desired *Board, live []byte) (bool, error) {
+	want, err := desired.ToJson()
+	if err != nil {
+		return false, err
+	}
+	return jsonDrifted(want, live, dashboardIgnoredKeys)
+}
+
+// DatasourceDrifted reports whether the datasource stored in grafana differs from
+// the desired one. Ids, versions and secrets (which grafana does not return) are
+// ignored. A declared jsonData has to match exactly, as it replaces the stored
+// one.
+func DatasourceDrifted(desired Datasource, live Datasource) (bool, error) {
+	want, err := json.Marshal(desired)
+	if err != nil {
+		return false, err
+	}
+	have, err := json.Marshal(live)
+	if err != nil {
+		return false, err
+	}
+	drifted, err := jsonDrifted(want, have, datasourceIgnoredKeys)
+	if err != nil || drifted || desired.JSONData == nil {
+		return drifted, err
+	}
+	// keys stored in grafana that are no longer declared
+	if want, err = json.Marshal(live.JSONData); err != nil {
+		return false, err
+	}
+	if have, err = json.Marshal(desired.JSONData); err != nil {
+		return false, err
+	}
+	return jsonDrifted(want, have, nil)
+}
+
+func jsonDrifted(want []byte, have []byte, ignoredKeys []string) (bool, error) {
+	var (
+		desired interface{}
+		live    interface{}
+	)
+	if err := decodeJSON(want, &desired); err != nil {
+		return false, err
+	}
+	if err := decodeJSON(have, &live); err != nil {
+		return false, err
+	}
+	if desiredMap, ok := desired.(map[string]interface{}); ok {
+		for _, key := range ignoredKeys {
+			delete(desiredMap, key)
+		}
+	}
+	return !isSubset(desired, live), nil
+}
+
+func decodeJSON(raw []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// isSubset checks that every value declared in desired is present in live. Null
+// values and empty strings in desired are treated as not declared. A scalar
+// missing in live equals its zero value, as grafana omits some of them.
+func isSubset(desired interface{}, live interface{}) bool {
+	switch want := desired.(type) {
+	case nil:
+		return true
+	case string:
+		if want == "" {
+			return true
+		}
+		return want == live
+	case bool:
+		if live == nil {
+			return !want
+		}
+		return want == live
+	case json.Number:
+		if live == nil {
+			wantFloat, err := want.Float64()
+			return err == nil && wantFloat == 0
+		}
+		have, ok := live.(json.Number)
+		if !ok {
+			return false
+		}
+		wantFloat, err := want.Float64()
+		if err != nil {
+			return want == have
+		}
+		haveFloat, err := have.Float64()
+		return err == nil && wantFloat == haveFloat
+	case map[string]interface{}:
+		have, ok := live.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for key, value := range want {
+			if !isSubset(value, have[key]) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		have, ok := live.([]interface{})
+		if !ok {
+			return len(want) == 0 && live == nil
+		}
+		if len(want) != len(have) {
+			return false
+		}
+		for i := range want {
+			if !isSubset(want[i], have[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(desired, live)
+	}
+}
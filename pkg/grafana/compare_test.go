@@ -0,0 +1,110 @@
+package grafana
+
+import (
+	"testing"
+)
+
+func TestJSONDrifted(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		have    string
+		ignored []string
+		drifted bool
+	}{
+		{name: "equal", want: `{"a":1,"b":"x"}`, have: `{"a":1,"b":"x"}`},
+		{name: "defaults added by grafana", want: `{"a":1}`, have: `{"a":1,"b":"x","c":{"d":true}}`},
+		{name: "changed value", want: `{"a":1}`, have: `{"a":2}`, drifted: true},
+		{name: "missing key", want: `{"a":1}`, have: `{}`, drifted: true},
+		{name: "number formats", want: `{"a":1}`, have: `{"a":1.0}`},
+		{name: "large numbers", want: `{"a":12345678901234567890}`, have: `{"a":12345678901234567890}`},
+		{name: "null is not declared", want: `{"a":null}`, have: `{"a":5}`},
+		{name: "empty string is not declared", want: `{"a":""}`, have: `{"a":"x"}`},
+		{name: "bool changed", want: `{"a":false}`, have: `{"a":true}`, drifted: true},
+		{name: "false missing", want: `{"a":false}`, have: `{}`},
+		{name: "true missing", want: `{"a":true}`, have: `{}`, drifted: true},
+		{name: "zero missing", want: `{"a":0}`, have: `{}`},
+		{name: "type changed", want: `{"a":"1"}`, have: `{"a":1}`, drifted: true},
+		{name: "nested subset", want: `{"a":{"b":1}}`, have: `{"a":{"b":1,"c":2}}`},
+		{name: "nested changed", want: `{"a":{"b":1}}`, have: `{"a":{"b":2}}`, drifted: true},
+		{name: "nested not an object", want: `{"a":{"b":1}}`, have: `{"a":1}`, drifted: true},
+		{name: "arrays of objects", want: `{"p":[{"id":1},{"id":2}]}`, have: `{"p":[{"id":1,"x":0},{"id":2,"x":0}]}`},
+		{name: "array length", want: `{"p":[1,2]}`, have: `{"p":[1,2,3]}`, drifted: true},
+		{name: "array order", want: `{"p":[1,2]}`, have: `{"p":[2,1]}`, drifted: true},
+		{name: "empty array vs missing", want: `{"p":[]}`, have: `{}`},
+		{name: "array vs object", want: `{"p":[1]}`, have: `{"p":{"0":1}}`, drifted: true},
+		{name: "ignored keys", want: `{"id":1,"version":3,"title":"x"}`, have: `{"id":2,"version":7,"title":"x"}`, ignored: dashboardIgnoredKeys},
+		{name: "ignored keys only at the top", want: `{"panels":[{"id":1}]}`, have: `{"panels":[{"id":2}]}`, ignored: dashboardIgnoredKeys, drifted: true},
+	}
+	for _, test := range tests {
+		drifted, err := jsonDrifted([]byte(test.want), []byte(test.have), test.ignored)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if drifted != test.drifted {
+			t.Errorf("%s: jsonDrifted(%s, %s) = %t, want %t", test.name, test.want, test.have, drifted, test.drifted)
+		}
+	}
+}
+
+func TestJSONDriftedInvalid(t *testing.T) {
+	if _, err := jsonDrifted([]byte(`{`), []byte(`{}`), nil); err == nil {
+		t.Error("expected an error for invalid desired JSON")
+	}
+	if _, err := jsonDrifted([]byte(`{}`), []byte(`nope`), nil); err == nil {
+		t.Error("expected an error for invalid live JSON")
+	}
+}
+
+func TestIsSubsetNil(t *testing.T) {
+	if !isSubset(nil, map[string]interface{}{"a": 1}) {
+		t.Error("nothing declared must be a subset of anything")
+	}
+	if isSubset(map[string]interface{}{"a": "x"}, nil) {
+		t.Error("a declared value must not be a subset of nothing")
+	}
+}
+
+func TestDatasourceDrifted(t *testing.T) {
+	url := "http://prometheus:9090"
+	enabled := true
+	desired := Datasource{Name: "prometheus", Type: "prometheus", URL: url, IsDefault: &enabled, Password: &url}
+	live := Datasource{ID: 3, OrgID: 1, Version: 4, Name: "prometheus", Type: "prometheus", URL: url, Access: "proxy", IsDefault: &enabled, ReadOnly: true}
+
+	drifted, err := DatasourceDrifted(desired, live)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if drifted {
+		t.Error("ids, versions, secrets and settings grafana added must not be reported as drift")
+	}
+
+	live.Name = "renamed"
+	if drifted, _ := DatasourceDrifted(desired, live); !drifted {
+		t.Error("a renamed datasource must be reported as drift")
+	}
+	live.Name = desired.Name
+	disabled := false
+	live.IsDefault = &disabled
+	if drifted, _ := DatasourceDrifted(desired, live); !drifted {
+		t.Error("a changed isDefault must be reported as drift")
+	}
+	desired.IsDefault = nil
+	if drifted, _ := DatasourceDrifted(desired, live); drifted {
+		t.Error("an undeclared isDefault must not be reported as drift")
+	}
+
+	live.JSONData = JSONData{"httpMethod": "POST", "timeInterval": "30s"}
+	if drifted, _ := DatasourceDrifted(desired, live); drifted {
+		t.Error("jsonData must not be reported as drift if it is not declared")
+	}
+	desired.JSONData = JSONData{"httpMethod": "POST"}
+	if drifted, _ := DatasourceDrifted(desired, live); !drifted {
+		t.Error("a jsonData key that is no longer declared must be reported as drift")
+	}
+	desired.JSONData["timeInterval"] = "30s"
+	if drifted, _ := DatasourceDrifted(desired, live); drifted {
+		t.Error("a matching jsonData must not be reported as drift")
+	}
+}
@@ -1,35 +1,252 @@
 package grafana
 
 import (
-	"errors"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
 	"strings"
 
 	yaml "gopkg.in/yaml.v2"
 )
 
+// DatasourceConfigFile is grafana's provisioning format for datasources
 type DatasourceConfigFile struct {
-	ApiVersion        int          `yaml:"apiVersion,omitempty"`
-	DeleteDatasources []Datasource `yaml:"deleteDatasources,omitempty"`
-	Datasources       []Datasource `yaml:"datasources,omitempty"`
+	ApiVersion        int             `yaml:"apiVersion,omitempty"`
+	DeleteDatasources []DatasourceRef `yaml:"deleteDatasources,omitempty"`
+	Datasources       []Datasource    `yaml:"datasources,omitempty"`
 }
 
-func GetGrafanaConfigObjectFromString(source string) (*DatasourceConfigFile, *Board, error) {
-	var (
-		err   error
-		ds    *DatasourceConfigFile
-		board *Board
-	)
-	// try datasource first
-	if strings.Contains(source, "apiVersion:") {
-		ds, err = DatasourceConfigFileFromString(source)
-	} else {
-		board, err = BoardFromString(source)
+// NotifierConfigFile is grafana's provisioning format for legacy alert
+// notification channels
+type NotifierConfigFile struct {
+	Notifiers       []Notifier    `yaml:"notifiers,omitempty"`
+	DeleteNotifiers []NotifierRef `yaml:"delete_notifiers,omitempty"`
+}
+
+// AlertingConfigFile is grafana's provisioning format for unified alerting
+type AlertingConfigFile struct {
+	ApiVersion          int                    `yaml:"apiVersion,omitempty"`
+	Groups              []AlertRuleGroupConfig `yaml:"groups,omitempty"`
+	DeleteRules         []AlertingRef          `yaml:"deleteRules,omitempty"`
+	ContactPoints       []ContactPointConfig   `yaml:"contactPoints,omitempty"`
+	DeleteContactPoints []AlertingRef          `yaml:"deleteContactPoints,omitempty"`
+	Policies            []PolicyConfig         `yaml:"policies,omitempty"`
+	ResetPolicies       []uint                 `yaml:"resetPolicies,omitempty"`
+	MuteTimes           []MuteTimingConfig     `yaml:"muteTimes,omitempty"`
+	DeleteMuteTimes     []AlertingRef          `yaml:"deleteMuteTimes,omitempty"`
+	Templates           []TemplateConfig       `yaml:"templates,omitempty"`
+	DeleteTemplates     []AlertingRef          `yaml:"deleteTemplates,omitempty"`
+}
+
+// DocumentKind is the kind of a grafana configuration document
+type DocumentKind string
+
+const (
+	DashboardDocument  DocumentKind = "dashboard"
+	DatasourceDocument DocumentKind = "datasources"
+	NotifierDocument   DocumentKind = "notifiers"
+	AlertingDocument   DocumentKind = "alerting"
+)
+
+// ConfigDocument is a single grafana configuration document. Only the object
+// matching the kind is set.
+type ConfigDocument struct {
+	Kind        DocumentKind
+	Board       *Board
+	Datasources *DatasourceConfigFile
+	Notifiers   *NotifierConfigFile
+	Alerting    *AlertingConfigFile
+}
+
+// Top level keys that identify the kind of a document
+var documentKindKeys = []struct {
+	kind DocumentKind
+	keys []string
+}{
+	{DatasourceDocument, []string{"datasources", "deleteDatasources"}},
+	{NotifierDocument, []string{"notifiers", "delete_notifiers"}},
+	{AlertingDocument, []string{"groups", "deleteRules", "contactPoints", "deleteContactPoints", "policies", "resetPolicies", "muteTimes", "deleteMuteTimes", "templates", "deleteTemplates"}},
+	{DashboardDocument, []string{"dashboard", "panels", "rows", "schemaVersion", "templating"}},
+}
+
+// UnknownContentError is returned for documents that are none of the known
+// kinds of grafana configuration
+type UnknownContentError struct {
+	// Top level keys of the document, sorted
+	Keys []string
+}
+
+func (e *UnknownContentError) Error() string {
+	if len(e.Keys) == 0 {
+		return "unknown content: empty document"
+	}
+	return fmt.Sprintf("unknown content with top level keys %s, expected a dashboard or a datasources, notifiers or alerting provisioning file", strings.Join(e.Keys, ", "))
+}
+
+// Determine the kind of a document from its top level keys
+func documentKind(keys []string) (DocumentKind, error) {
+	present := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		present[key] = true
+	}
+	kinds := []string{}
+	var kind DocumentKind
+	for _, candidate := range documentKindKeys {
+		for _, key := range candidate.keys {
+			if present[key] {
+				kind = candidate.kind
+				kinds = append(kinds, string(candidate.kind))
+				break
+			}
+		}
+	}
+	// dashboards without panels still have a title
+	if len(kinds) == 0 && present["title"] {
+		return DashboardDocument, nil
+	}
+	sort.Strings(keys)
+	switch len(kinds) {
+	case 0:
+		return "", &UnknownContentError{Keys: keys}
+	case 1:
+		return kind, nil
+	}
+	return "", fmt.Errorf("ambiguous content, top level keys %s match %s", strings.Join(keys, ", "), strings.Join(kinds, " and "))
+}
+
+// ParseConfigDocuments detects and parses the grafana configuration documents
+// of a ConfigMap entry. Entries named *.json are JSON, entries named *.yaml or
+// *.yml are YAML and may contain several documents separated by '---'. Other
+// entries are JSON if they start with '{' and YAML otherwise.
+func ParseConfigDocuments(file string, source string) ([]ConfigDocument, error) {
+	switch strings.ToLower(path.Ext(file)) {
+	case ".json":
+		return parseJSONDocument(source)
+	case ".yaml", ".yml":
+		return parseYAMLDocuments(source)
+	}
+	if strings.HasPrefix(strings.TrimSpace(source), "{") {
+		return parseJSONDocument(source)
+	}
+	return parseYAMLDocuments(source)
+}
+
+func parseJSONDocument(source string) ([]ConfigDocument, error) {
+	top := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(source), &top); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	keys := make([]string, 0, len(top))
+	for key := range top {
+		keys = append(keys, key)
 	}
+	kind, err := documentKind(keys)
+	if err != nil {
+		return nil, err
+	}
+	if kind == DashboardDocument {
+		raw := []byte(source)
+		// dashboards may be wrapped like in the dashboard API
+		if wrapped, ok := top["dashboard"]; ok && strings.HasPrefix(strings.TrimSpace(string(wrapped)), "{") {
+			raw = wrapped
+		}
+		board := Board{}
+		if err := json.Unmarshal(raw, &board); err != nil {
+			return nil, fmt.Errorf("invalid dashboard: %v", err)
+		}
+		return []ConfigDocument{{Kind: kind, Board: &board}}, nil
+	}
+	// JSON is valid YAML, which the provisioning formats are defined in
+	document, err := decodeProvisioningDocument(kind, []byte(source))
+	if err != nil {
+		return nil, err
+	}
+	return []ConfigDocument{document}, nil
+}
 
-	if board == nil && ds == nil {
-		err = errors.New("Not board nor datasource")
+func parseYAMLDocuments(source string) ([]ConfigDocument, error) {
+	documents := []ConfigDocument{}
+	decoder := yaml.NewDecoder(strings.NewReader(source))
+	for i := 1; ; i++ {
+		top := map[string]interface{}{}
+		err := decoder.Decode(&top)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid YAML in document %d: %v", i, err)
+		}
+		if len(top) == 0 {
+			// empty documents, e.g. before a leading '---'
+			continue
+		}
+		keys := make([]string, 0, len(top))
+		for key := range top {
+			keys = append(keys, key)
+		}
+		kind, err := documentKind(keys)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %v", i, err)
+		}
+		var document ConfigDocument
+		if kind == DashboardDocument {
+			document, err = yamlDashboardDocument(top)
+		} else {
+			var raw []byte
+			if raw, err = yaml.Marshal(top); err == nil {
+				document, err = decodeProvisioningDocument(kind, raw)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %v", i, err)
+		}
+		documents = append(documents, document)
 	}
-	return ds, board, err
+	if len(documents) == 0 {
+		return nil, &UnknownContentError{}
+	}
+	return documents, nil
+}
+
+// Dashboards are JSON, but may be given as YAML as well
+func yamlDashboardDocument(top map[string]interface{}) (ConfigDocument, error) {
+	value := normalizeYAMLValue(top).(map[string]interface{})
+	if wrapped, ok := value["dashboard"].(map[string]interface{}); ok {
+		value = wrapped
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return ConfigDocument{}, fmt.Errorf("invalid dashboard: %v", err)
+	}
+	board := Board{}
+	if err := json.Unmarshal(raw, &board); err != nil {
+		return ConfigDocument{}, fmt.Errorf("invalid dashboard: %v", err)
+	}
+	return ConfigDocument{Kind: DashboardDocument, Board: &board}, nil
+}
+
+func decodeProvisioningDocument(kind DocumentKind, raw []byte) (ConfigDocument, error) {
+	document := ConfigDocument{Kind: kind}
+	var err error
+	switch kind {
+	case DatasourceDocument:
+		document.Datasources = &DatasourceConfigFile{}
+		if err = yaml.Unmarshal(raw, document.Datasources); err == nil {
+			document.Datasources.setDefaults()
+		}
+	case NotifierDocument:
+		document.Notifiers = &NotifierConfigFile{}
+		err = yaml.Unmarshal(raw, document.Notifiers)
+	case AlertingDocument:
+		document.Alerting = &AlertingConfigFile{}
+		err = yaml.Unmarshal(raw, document.Alerting)
+	}
+	if err != nil {
+		return document, fmt.Errorf("invalid %s: %v", kind, err)
+	}
+	return document, nil
 }
 
 func DatasourceConfigFileFromString(source string) (*DatasourceConfigFile, error) {
@@ -38,6 +255,15 @@ func DatasourceConfigFileFromString(source string) (*DatasourceConfigFile, error
 	return &result, err
 }
 
+// Fill in the defaults grafana applies to provisioned datasources
+func (f *DatasourceConfigFile) setDefaults() {
+	for i := range f.Datasources {
+		if f.Datasources[i].Access == "" {
+			f.Datasources[i].Access = "proxy"
+		}
+	}
+}
+
 func (f *DatasourceConfigFile) ToYaml() ([]byte, error) {
 	raw, err := yaml.Marshal(f)
 	if err != nil {
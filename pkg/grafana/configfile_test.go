@@ -0,0 +1,178 @@
+package grafana
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDocumentKind(t *testing.T) {
+	tests := []struct {
+		keys    []string
+		kind    DocumentKind
+		wantErr string
+	}{
+		{keys: []string{"apiVersion", "datasources"}, kind: DatasourceDocument},
+		{keys: []string{"apiVersion", "deleteDatasources"}, kind: DatasourceDocument},
+		{keys: []string{"notifiers"}, kind: NotifierDocument},
+		{keys: []string{"delete_notifiers"}, kind: NotifierDocument},
+		{keys: []string{"apiVersion", "groups"}, kind: AlertingDocument},
+		{keys: []string{"apiVersion", "contactPoints", "policies"}, kind: AlertingDocument},
+		{keys: []string{"title", "panels", "schemaVersion"}, kind: DashboardDocument},
+		{keys: []string{"dashboard", "overwrite"}, kind: DashboardDocument},
+		{keys: []string{"title"}, kind: DashboardDocument},
+		{keys: []string{"datasources", "groups"}, wantErr: "ambiguous content"},
+		{keys: []string{"foo", "bar"}, wantErr: "unknown content with top level keys bar, foo"},
+		{keys: []string{}, wantErr: "empty document"},
+	}
+	for _, test := range tests {
+		kind, err := documentKind(test.keys)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("documentKind(%v) error = %v, want %q", test.keys, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("documentKind(%v) unexpected error: %v", test.keys, err)
+			continue
+		}
+		if kind != test.kind {
+			t.Errorf("documentKind(%v) = %s, want %s", test.keys, kind, test.kind)
+		}
+	}
+}
+
+func TestDocumentKindUnknownContentError(t *testing.T) {
+	_, err := documentKind([]string{"b", "a"})
+	unknown, ok := err.(*UnknownContentError)
+	if !ok {
+		t.Fatalf("error %v is no UnknownContentError", err)
+	}
+	if strings.Join(unknown.Keys, ",") != "a,b" {
+		t.Errorf("keys = %v, want them sorted", unknown.Keys)
+	}
+}
+
+func TestParseConfigDocuments(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		source  string
+		kinds   []DocumentKind
+		wantErr string
+	}{
+		{
+			name:   "json dashboard",
+			file:   "board.json",
+			source: `{"title": "Board", "panels": []}`,
+			kinds:  []DocumentKind{DashboardDocument},
+		},
+		{
+			name:   "wrapped json dashboard",
+			file:   "board.json",
+			source: `{"dashboard": {"title": "Wrapped"}, "overwrite": true}`,
+			kinds:  []DocumentKind{DashboardDocument},
+		},
+		{
+			name:   "json without extension",
+			file:   "board",
+			source: ` {"title": "Board"}`,
+			kinds:  []DocumentKind{DashboardDocument},
+		},
+		{
+			name:   "yaml datasources",
+			file:   "datasources.yaml",
+			source: "apiVersion: 1\ndatasources:\n- name: prometheus\n  type: prometheus\n",
+			kinds:  []DocumentKind{DatasourceDocument},
+		},
+		{
+			name:   "several yaml documents",
+			file:   "all.yml",
+			source: "---\napiVersion: 1\ndatasources:\n- name: loki\n  type: loki\n---\nnotifiers:\n- name: mail\n  type: email\n---\napiVersion: 1\ngroups: []\n",
+			kinds:  []DocumentKind{DatasourceDocument, NotifierDocument, AlertingDocument},
+		},
+		{
+			name:   "yaml dashboard",
+			file:   "board.yaml",
+			source: "title: Board\npanels:\n- id: 1\n  type: graph\n",
+			kinds:  []DocumentKind{DashboardDocument},
+		},
+		{
+			name:    "invalid json",
+			file:    "board.json",
+			source:  `{"title": `,
+			wantErr: "invalid JSON",
+		},
+		{
+			name:    "unknown yaml document",
+			file:    "config.yaml",
+			source:  "apiVersion: 1\ndatasources: []\n---\nfoo: bar\n",
+			wantErr: "document 2: unknown content",
+		},
+		{
+			name:    "empty yaml",
+			file:    "empty.yaml",
+			source:  "---\n",
+			wantErr: "empty document",
+		},
+	}
+	for _, test := range tests {
+		documents, err := ParseConfigDocuments(test.file, test.source)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: error = %v, want %q", test.name, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if len(documents) != len(test.kinds) {
+			t.Errorf("%s: got %d documents, want %d", test.name, len(documents), len(test.kinds))
+			continue
+		}
+		for i, document := range documents {
+			if document.Kind != test.kinds[i] {
+				t.Errorf("%s: document %d is %s, want %s", test.name, i+1, document.Kind, test.kinds[i])
+			}
+		}
+	}
+}
+
+func TestParseConfigDocumentsContent(t *testing.T) {
+	documents, err := ParseConfigDocuments("board.json", `{"dashboard": {"title": "Wrapped", "uid": "abc"}}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if board := documents[0].Board; board == nil || board.Title != "Wrapped" || board.UID != "abc" {
+		t.Errorf("wrapped dashboard not unwrapped: %+v", board)
+	}
+
+	source := "apiVersion: 1\ndatasources:\n- name: loki\n  type: loki\n  isDefault: false\n  jsonData:\n    derivedFields:\n    - name: trace\n"
+	documents, err = ParseConfigDocuments("datasources.yaml", source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	datasources := documents[0].Datasources
+	if datasources == nil || len(datasources.Datasources) != 1 {
+		t.Fatalf("datasources not parsed: %+v", datasources)
+	}
+	ds := datasources.Datasources[0]
+	if ds.Access != "proxy" {
+		t.Errorf("access = %q, want the default proxy", ds.Access)
+	}
+	if ds.IsDefault == nil || *ds.IsDefault {
+		t.Errorf("isDefault = %v, want it declared as false", ds.IsDefault)
+	}
+	if ds.Editable != nil || ds.WithCredentials != nil {
+		t.Errorf("editable = %v, withCredentials = %v, want them undeclared", ds.Editable, ds.WithCredentials)
+	}
+	fields, ok := ds.JSONData["derivedFields"].([]interface{})
+	if !ok || len(fields) != 1 {
+		t.Fatalf("jsonData.derivedFields = %#v", ds.JSONData["derivedFields"])
+	}
+	if _, ok := fields[0].(map[string]interface{}); !ok {
+		t.Errorf("nested jsonData is %T, want map[string]interface{}", fields[0])
+	}
+}
@@ -44,6 +44,7 @@ type BoardProperties struct {
 	UpdatedBy  string    `json:"updatedBy"`
 	CreatedBy  string    `json:"createdBy"`
 	Version    int       `json:"version"`
+	FolderID   uint      `json:"folderId"`
 }
 
 // GetDashboard loads a dashboard from Grafana instance along with metadata for a dashboard.
@@ -57,16 +58,12 @@ func (r *Client) GetDashboardBySlug(slug string) (Board, BoardProperties, error)
 			Meta  BoardProperties `json:"meta"`
 			Board Board           `json:"dashboard"`
 		}
-		code int
-		err  error
+		err error
 	)
 	slug, _ = setPrefix(slug)
-	if raw, code, err = r.get(fmt.Sprintf("api/dashboards/%s", slug), nil); err != nil {
+	if raw, _, err = r.get(fmt.Sprintf("api/dashboards/%s", slug), nil); err != nil {
 		return Board{}, BoardProperties{}, err
 	}
-	if code != 200 {
-		return Board{}, BoardProperties{}, fmt.Errorf("HTTP error %d: returns %s", code, raw)
-	}
 	dec := json.NewDecoder(bytes.NewReader(raw))
 	dec.UseNumber()
 	if err := dec.Decode(&result); err != nil {
@@ -87,15 +84,11 @@ func (r *Client) GetDashboard(uid string) (Board, BoardProperties, error) {
 			Meta  BoardProperties `json:"meta"`
 			Board Board           `json:"dashboard"`
 		}
-		code int
-		err  error
+		err error
 	)
-	if raw, code, err = r.get(fmt.Sprintf("api/dashboards/uid/%s", uid), nil); err != nil {
+	if raw, _, err = r.get(fmt.Sprintf("api/dashboards/uid/%s", uid), nil); err != nil {
 		return Board{}, BoardProperties{}, err
 	}
-	if code != 200 {
-		return Board{}, BoardProperties{}, fmt.Errorf("HTTP error %d: returns %s", code, raw)
-	}
 	dec := json.NewDecoder(bytes.NewReader(raw))
 	dec.UseNumber()
 	if err := dec.Decode(&result); err != nil {
@@ -121,16 +114,12 @@ func (r *Client) GetRawDashboardBySlug(slug string) ([]byte, BoardProperties, er
 			Meta  BoardProperties `json:"meta"`
 			Board json.RawMessage `json:"dashboard"`
 		}
-		code int
-		err  error
+		err error
 	)
 	slug, _ = setPrefix(slug)
-	if raw, code, err = r.get(fmt.Sprintf("api/dashboards/%s", slug), nil); err != nil {
+	if raw, _, err = r.get(fmt.Sprintf("api/dashboards/%s", slug), nil); err != nil {
 		return nil, BoardProperties{}, err
 	}
-	if code != 200 {
-		return nil, BoardProperties{}, fmt.Errorf("HTTP error %d: returns %s", code, raw)
-	}
 	dec := json.NewDecoder(bytes.NewReader(raw))
 	dec.UseNumber()
 	if err := dec.Decode(&result); err != nil {
@@ -154,15 +143,11 @@ func (r *Client) GetRawDashboardByUID(uid string) ([]byte, BoardProperties, erro
 			Meta  BoardProperties `json:"meta"`
 			Board json.RawMessage `json:"dashboard"`
 		}
-		code int
-		err  error
+		err error
 	)
-	if raw, code, err = r.get(fmt.Sprintf("api/dashboards/uid/%s", uid), nil); err != nil {
+	if raw, _, err = r.get(fmt.Sprintf("api/dashboards/uid/%s", uid), nil); err != nil {
 		return nil, BoardProperties{}, err
 	}
-	if code != 200 {
-		return nil, BoardProperties{}, fmt.Errorf("HTTP error %d: returns %s", code, raw)
-	}
 	dec := json.NewDecoder(bytes.NewReader(raw))
 	dec.UseNumber()
 	if err := dec.Decode(&result); err != nil {
@@ -172,12 +157,17 @@ func (r *Client) GetRawDashboardByUID(uid string) ([]byte, BoardProperties, erro
 }
 // FoundBoard keeps result of search with metadata of a dashboard.
 type FoundBoard struct {
-	ID        uint     `json:"id"`
-	Title     string   `json:"title"`
-	URI       string   `json:"uri"`
-	Type      string   `json:"type"`
-	Tags      []string `json:"tags"`
-	IsStarred bool     `json:"isStarred"`
+	ID          uint     `json:"id"`
+	UID         string   `json:"uid"`
+	Title       string   `json:"title"`
+	URI         string   `json:"uri"`
+	URL         string   `json:"url"`
+	Type        string   `json:"type"`
+	Tags        []string `json:"tags"`
+	IsStarred   bool     `json:"isStarred"`
+	FolderID    uint     `json:"folderId"`
+	FolderUID   string   `json:"folderUid"`
+	FolderTitle string   `json:"folderTitle"`
 }
 
 // SearchDashboards search dashboards by substring of their title. It allows restrict the result set with
@@ -186,7 +176,6 @@ func (r *Client) SearchDashboards(query string, starred bool, tags ...string) ([
 	var (
 		raw    []byte
 		boards []FoundBoard
-		code   int
 		err    error
 	)
 	u := url.URL{}
@@ -200,11 +189,26 @@ func (r *Client) SearchDashboards(query string, starred bool, tags ...string) ([
 	for _, tag := range tags {
 		q.Add("tag", tag)
 	}
-	if raw, code, err = r.get("api/search", q); err != nil {
+	if raw, _, err = r.get("api/search", q); err != nil {
 		return nil, err
 	}
-	if code != 200 {
-		return nil, fmt.Errorf("HTTP error %d: returns %s", code, raw)
+	err = json.Unmarshal(raw, &boards)
+	return boards, err
+}
+
+// SearchDashboardsInFolder lists the dashboards stored in a folder.
+// It reflects GET /api/search?folderIds=:folderId&type=dash-db API call.
+func (r *Client) SearchDashboardsInFolder(folderID uint) ([]FoundBoard, error) {
+	var (
+		raw    []byte
+		boards []FoundBoard
+		err    error
+	)
+	q := url.Values{}
+	q.Set("folderIds", fmt.Sprintf("%d", folderID))
+	q.Set("type", "dash-db")
+	if raw, _, err = r.get("api/search", q); err != nil {
+		return nil, err
 	}
 	err = json.Unmarshal(raw, &boards)
 	return boards, err
@@ -217,6 +221,13 @@ func (r *Client) SearchDashboards(query string, starred bool, tags ...string) ([
 // Grafana only can create or update a dashboard in a database. File dashboards
 // may be only loaded with HTTP API but not created or updated.
 func (r *Client) SetDashboard(board Board, overwrite bool, folderID uint) error {
+	_, err := r.SaveDashboard(board, overwrite, folderID)
+	return err
+}
+
+// SaveDashboard works like SetDashboard but also returns the status message
+// carrying the id, uid and version of the saved dashboard.
+func (r *Client) SaveDashboard(board Board, overwrite bool, folderID uint) (StatusMessage, error) {
 	var (
 		isBoardFromDB bool
 		newBoard      struct {
@@ -226,11 +237,10 @@ func (r *Client) SetDashboard(board Board, overwrite bool, folderID uint) error
 		}
 		raw  []byte
 		resp StatusMessage
-		code int
 		err  error
 	)
 	if board.Slug, isBoardFromDB = cleanPrefix(board.Slug); !isBoardFromDB {
-		return errors.New("only database dashboard (with 'db/' prefix in a slug) can be set")
+		return StatusMessage{}, errors.New("only database dashboard (with 'db/' prefix in a slug) can be set")
 	}
 	newBoard.Dashboard = board
 	newBoard.Overwrite = overwrite
@@ -239,21 +249,15 @@ func (r *Client) SetDashboard(board Board, overwrite bool, folderID uint) error
 		newBoard.Dashboard.ID = 0
 	}
 	if raw, err = json.Marshal(newBoard); err != nil {
-		return err
+		return StatusMessage{}, err
 	}
-	if raw, code, err = r.post("api/dashboards/db", nil, raw); err != nil {
-		return err
+	if raw, _, err = r.post("api/dashboards/db", nil, raw); err != nil {
+		return StatusMessage{}, err
 	}
 	if err = json.Unmarshal(raw, &resp); err != nil {
-		return err
-	}
-	switch code {
-	case 401:
-		return fmt.Errorf("%d %s", code, *resp.Message)
-	case 412:
-		return fmt.Errorf("%d %s", code, *resp.Message)
+		return StatusMessage{}, err
 	}
-	return nil
+	return resp, nil
 }
 
 // SetRawDashboard updates existing dashboard or creates a new one.
@@ -264,7 +268,6 @@ func (r *Client) SetRawDashboard(raw []byte) error {
 	var (
 		rawResp []byte
 		resp    StatusMessage
-		code    int
 		err     error
 		buf     bytes.Buffer
 		plain   = make(map[string]interface{})
@@ -278,19 +281,10 @@ func (r *Client) SetRawDashboard(raw []byte) error {
 	buf.WriteString(`{"dashboard":`)
 	buf.Write(raw)
 	buf.WriteString(`, "overwrite": true}`)
-	if rawResp, code, err = r.post("api/dashboards/db", nil, buf.Bytes()); err != nil {
-		return err
-	}
-	if err = json.Unmarshal(rawResp, &resp); err != nil {
+	if rawResp, _, err = r.post("api/dashboards/db", nil, buf.Bytes()); err != nil {
 		return err
 	}
-	switch code {
-	case 401:
-		return fmt.Errorf("%d %s", code, *resp.Message)
-	case 412:
-		return fmt.Errorf("%d %s", code, *resp.Message)
-	}
-	return nil
+	return json.Unmarshal(rawResp, &resp)
 }
 
 // DeleteDashboard deletes dashboard that selected by slug string.
@@ -330,6 +324,46 @@ func (r *Client) DeleteDashboard(uid string) (StatusMessage, error) {
 	return reply, err
 }
 
+// GetDashboardPermissions loads the access control list of a dashboard.
+// It reflects GET /api/dashboards/id/:dashboardId/permissions API call.
+func (r *Client) GetDashboardPermissions(id uint) ([]Permission, error) {
+	var (
+		raw         []byte
+		permissions []Permission
+		err         error
+	)
+	if raw, _, err = r.get(fmt.Sprintf("api/dashboards/id/%d/permissions", id), nil); err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(raw, &permissions)
+	return permissions, err
+}
+
+// UpdateDashboardPermissions replaces the access control list of a dashboard.
+// Permissions inherited from the folder are not affected.
+// It reflects POST /api/dashboards/id/:dashboardId/permissions API call.
+func (r *Client) UpdateDashboardPermissions(id uint, items []PermissionItem) (StatusMessage, error) {
+	var (
+		raw    []byte
+		reply  StatusMessage
+		err    error
+		update = struct {
+			Items []PermissionItem `json:"items"`
+		}{Items: items}
+	)
+	if update.Items == nil {
+		update.Items = []PermissionItem{}
+	}
+	if raw, err = json.Marshal(update); err != nil {
+		return StatusMessage{}, err
+	}
+	if raw, _, err = r.post(fmt.Sprintf("api/dashboards/id/%d/permissions", id), nil, raw); err != nil {
+		return StatusMessage{}, err
+	}
+	err = json.Unmarshal(raw, &reply)
+	return reply, err
+}
+
 // implicitly use dashboards from Grafana DB not from a file system
 func setPrefix(slug string) (string, bool) {
 	if strings.HasPrefix(slug, "db") {
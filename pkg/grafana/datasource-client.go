@@ -27,17 +27,13 @@ import (
 // It reflects GET /api/datasources API call.
 func (r *Client) GetAllDatasources() ([]Datasource, error) {
 	var (
-		raw  []byte
-		ds   []Datasource
-		code int
-		err  error
+		raw []byte
+		ds  []Datasource
+		err error
 	)
-	if raw, code, err = r.get("api/datasources", nil); err != nil {
+	if raw, _, err = r.get("api/datasources", nil); err != nil {
 		return nil, err
 	}
-	if code != 200 {
-		return nil, fmt.Errorf("HTTP error %d: returns %s", code, raw)
-	}
 	err = json.Unmarshal(raw, &ds)
 	return ds, err
 }
@@ -46,17 +42,13 @@ func (r *Client) GetAllDatasources() ([]Datasource, error) {
 // It reflects GET /api/datasources/:datasourceId API call.
 func (r *Client) GetDatasource(id uint) (Datasource, error) {
 	var (
-		raw  []byte
-		ds   Datasource
-		code int
-		err  error
+		raw []byte
+		ds  Datasource
+		err error
 	)
-	if raw, code, err = r.get(fmt.Sprintf("api/datasources/%d", id), nil); err != nil {
+	if raw, _, err = r.get(fmt.Sprintf("api/datasources/%d", id), nil); err != nil {
 		return ds, err
 	}
-	if code != 200 {
-		return ds, fmt.Errorf("HTTP error %d: returns %s", code, raw)
-	}
 	err = json.Unmarshal(raw, &ds)
 	return ds, err
 }
@@ -65,16 +57,27 @@ func (r *Client) GetDatasource(id uint) (Datasource, error) {
 // It reflects GET /api/datasources/name/:datasourceName API call.
 func (r *Client) GetDatasourceByName(name string) (Datasource, error) {
 	var (
-		raw  []byte
-		ds   Datasource
-		code int
-		err  error
+		raw []byte
+		ds  Datasource
+		err error
 	)
-	if raw, code, err = r.get(fmt.Sprintf("api/datasources/name/%s", name), nil); err != nil {
+	if raw, _, err = r.get(fmt.Sprintf("api/datasources/name/%s", name), nil); err != nil {
 		return ds, err
 	}
-	if code != 200 {
-		return ds, fmt.Errorf("HTTP error %d: returns %s", code, raw)
+	err = json.Unmarshal(raw, &ds)
+	return ds, err
+}
+
+// GetDatasourceByUID gets an datasource by UID.
+// It reflects GET /api/datasources/uid/:datasourceUid API call.
+func (r *Client) GetDatasourceByUID(uid string) (Datasource, error) {
+	var (
+		raw []byte
+		ds  Datasource
+		err error
+	)
+	if raw, _, err = r.get(fmt.Sprintf("api/datasources/uid/%s", uid), nil); err != nil {
+		return ds, err
 	}
 	err = json.Unmarshal(raw, &ds)
 	return ds, err
@@ -156,15 +159,11 @@ func (r *Client) GetDatasourceTypes() (map[string]DatasourceType, error) {
 	var (
 		raw     []byte
 		dsTypes = make(map[string]DatasourceType)
-		code    int
 		err     error
 	)
-	if raw, code, err = r.get("api/datasources/plugins", nil); err != nil {
+	if raw, _, err = r.get("api/datasources/plugins", nil); err != nil {
 		return nil, err
 	}
-	if code != 200 {
-		return nil, fmt.Errorf("HTTP error %d: returns %s", code, raw)
-	}
 	err = json.Unmarshal(raw, &dsTypes)
 	return dsTypes, err
 }
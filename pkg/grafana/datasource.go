@@ -18,23 +18,248 @@ package grafana
    ॐ तारे तुत्तारे तुरे स्व
 */
 
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
 // Datasource as described in the doc
 // http://docs.grafana.org/reference/http_api/#get-all-datasources
+// The yaml keys follow grafana's provisioning format
+// http://docs.grafana.org/administration/provisioning/#datasources
 type Datasource struct {
-	ID                uint        `json:"id"`
-	OrgID             uint        `json:"orgId"`
-	Name              string      `json:"name"`
-	Type              string      `json:"type"`
-	Access            string      `json:"access"` // direct or proxy
-	URL               string      `json:"url"`
-	Password          *string     `json:"password,omitempty"`
-	User              *string     `json:"user,omitempty"`
-	Database          *string     `json:"database,omitempty"`
-	BasicAuth         *bool       `json:"basicAuth,omitempty"`
-	BasicAuthUser     *string     `json:"basicAuthUser,omitempty"`
-	BasicAuthPassword *string     `json:"basicAuthPassword,omitempty"`
-	IsDefault         bool        `json:"isDefault"`
-	JSONData          interface{} `json:"jsonData"`
+	ID                uint              `json:"id" yaml:"-"`
+	UID               string            `json:"uid,omitempty" yaml:"uid,omitempty"`
+	OrgID             uint              `json:"orgId" yaml:"orgId,omitempty"`
+	Name              string            `json:"name" yaml:"name"`
+	Type              string            `json:"type" yaml:"type"`
+	Access            string            `json:"access" yaml:"access,omitempty"` // direct or proxy
+	URL               string            `json:"url" yaml:"url,omitempty"`
+	Password          *string           `json:"password,omitempty" yaml:"password,omitempty"`
+	User              *string           `json:"user,omitempty" yaml:"user,omitempty"`
+	Database          *string           `json:"database,omitempty" yaml:"database,omitempty"`
+	BasicAuth         *bool             `json:"basicAuth,omitempty" yaml:"basicAuth,omitempty"`
+	BasicAuthUser     *string           `json:"basicAuthUser,omitempty" yaml:"basicAuthUser,omitempty"`
+	BasicAuthPassword *string           `json:"basicAuthPassword,omitempty" yaml:"basicAuthPassword,omitempty"`
+	WithCredentials   *bool             `json:"withCredentials,omitempty" yaml:"withCredentials,omitempty"`
+	IsDefault         *bool             `json:"isDefault,omitempty" yaml:"isDefault,omitempty"`
+	JSONData          JSONData          `json:"jsonData" yaml:"jsonData,omitempty"`
+	SecureJSONData    map[string]string `json:"secureJsonData,omitempty" yaml:"secureJsonData,omitempty"`
+	SecureJSONFields  map[string]bool   `json:"secureJsonFields,omitempty" yaml:"-"`
+	Version           int               `json:"version,omitempty" yaml:"version,omitempty"`
+	Editable          *bool             `json:"editable,omitempty" yaml:"editable,omitempty"`
+	ReadOnly          bool              `json:"readOnly" yaml:"-"`
+}
+
+// DatasourceRef identifies a datasource to delete by its name within an
+// organization. A zero OrgID stands for the organization of the client.
+type DatasourceRef struct {
+	Name  string `yaml:"name"`
+	OrgID uint   `yaml:"orgId,omitempty"`
+}
+
+// JSONData holds the type specific settings of a datasource, e.g. the
+// derivedFields of Loki, the tracesToLogs of Tempo or the timeField of
+// Elasticsearch. Nested mappings read from YAML are converted so they can be
+// sent to the API as JSON.
+type JSONData map[string]interface{}
+
+// UnmarshalYAML converts nested mappings to map[string]interface{}.
+func (d *JSONData) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw map[string]interface{}
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	*d = normalizeYAMLValue(raw).(map[string]interface{})
+	return nil
+}
+
+// String returns the string stored under key.
+func (d JSONData) String(key string) (string, bool) {
+	value, ok := d[key].(string)
+	return value, ok
+}
+
+// Bool returns the boolean stored under key.
+func (d JSONData) Bool(key string) (bool, bool) {
+	value, ok := d[key].(bool)
+	return value, ok
+}
+
+// JSONDataValue returns the value stored under key in the datasource's jsonData.
+func (ds *Datasource) JSONDataValue(key string) (interface{}, bool) {
+	value, exists := ds.JSONData[key]
+	return value, exists
+}
+
+// SetJSONDataValue stores value under key in the datasource's jsonData.
+func (ds *Datasource) SetJSONDataValue(key string, value interface{}) {
+	if ds.JSONData == nil {
+		ds.JSONData = make(JSONData)
+	}
+	ds.JSONData[key] = value
+}
+
+// HasSecrets reports whether the datasource declares passwords or
+// secureJsonData. Grafana never returns them, so they cannot be compared with
+// the stored datasource.
+func (ds *Datasource) HasSecrets() bool {
+	return ds.Password != nil || ds.BasicAuthPassword != nil || len(ds.SecureJSONData) > 0
+}
+
+// SecretsHash returns a hash over the passwords and secureJsonData of the
+// datasource, so a change of them can be detected without keeping the
+// secrets. It is empty for datasources without secrets.
+func (ds *Datasource) SecretsHash() string {
+	if !ds.HasSecrets() {
+		return ""
+	}
+	values := []string{}
+	if ds.Password != nil {
+		values = append(values, "password="+*ds.Password)
+	}
+	if ds.BasicAuthPassword != nil {
+		values = append(values, "basicAuthPassword="+*ds.BasicAuthPassword)
+	}
+	for key, value := range ds.SecureJSONData {
+		values = append(values, "secureJsonData."+key+"="+value)
+	}
+	sort.Strings(values)
+	hash := sha256.New()
+	for _, value := range values {
+		hash.Write([]byte(value))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// WithoutSecrets returns a copy of the datasource without passwords and
+// secureJsonData.
+func (ds Datasource) WithoutSecrets() Datasource {
+	ds.Password = nil
+	ds.BasicAuthPassword = nil
+	ds.SecureJSONData = nil
+	return ds
+}
+
+// MergeDatasource applies the settings declared in desired to the live
+// datasource as returned by grafana. Optional settings that desired leaves
+// out keep their stored values, so an update does not reset what was not
+// declared. A declared jsonData replaces the stored one, so removed keys are
+// dropped. Secrets are only sent if desired declares them, grafana keeps the
+// stored ones otherwise.
+func MergeDatasource(desired Datasource, live Datasource) Datasource {
+	merged := live
+	merged.Name = desired.Name
+	merged.Type = desired.Type
+	if desired.UID != "" {
+		merged.UID = desired.UID
+	}
+	if desired.Access != "" {
+		merged.Access = desired.Access
+	}
+	if desired.URL != "" {
+		merged.URL = desired.URL
+	}
+	if desired.Password != nil {
+		merged.Password = desired.Password
+	}
+	if desired.User != nil {
+		merged.User = desired.User
+	}
+	if desired.Database != nil {
+		merged.Database = desired.Database
+	}
+	if desired.BasicAuth != nil {
+		merged.BasicAuth = desired.BasicAuth
+	}
+	if desired.BasicAuthUser != nil {
+		merged.BasicAuthUser = desired.BasicAuthUser
+	}
+	if desired.BasicAuthPassword != nil {
+		merged.BasicAuthPassword = desired.BasicAuthPassword
+	}
+	if desired.WithCredentials != nil {
+		merged.WithCredentials = desired.WithCredentials
+	}
+	if desired.IsDefault != nil {
+		merged.IsDefault = desired.IsDefault
+	}
+	if desired.Editable != nil {
+		merged.Editable = desired.Editable
+	}
+	if desired.JSONData != nil {
+		merged.JSONData = desired.JSONData
+	}
+	merged.SecureJSONData = desired.SecureJSONData
+	merged.SecureJSONFields = nil
+	// grafana rejects updates with an older version than the stored one
+	if desired.Version > live.Version {
+		merged.Version = desired.Version
+	}
+	return merged
+}
+
+// DashboardDatasourceRef references the datasource of a panel, target, template
+// variable or annotation. Older dashboards name the datasource, newer ones
+// reference it by uid and type.
+type DashboardDatasourceRef struct {
+	Name string `json:"-"`
+	UID  string `json:"uid,omitempty"`
+	Type string `json:"type,omitempty"`
+}
+
+// MarshalJSON writes the reference in the form it was read.
+func (r DashboardDatasourceRef) MarshalJSON() ([]byte, error) {
+	if r.UID == "" && r.Type == "" {
+		return json.Marshal(r.Name)
+	}
+	type ref DashboardDatasourceRef
+	return json.Marshal(ref(r))
+}
+
+// UnmarshalJSON accepts datasource names as well as {uid, type} objects.
+func (r *DashboardDatasourceRef) UnmarshalJSON(raw []byte) error {
+	var name string
+	if err := json.Unmarshal(raw, &name); err == nil {
+		*r = DashboardDatasourceRef{Name: name}
+		return nil
+	}
+	type ref DashboardDatasourceRef
+	var value ref
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return fmt.Errorf("datasource must be a name or an object with uid and type: %v", err)
+	}
+	*r = DashboardDatasourceRef(value)
+	return nil
+}
+
+// yaml.v2 decodes mappings as map[interface{}]interface{}, which can not be
+// marshalled to JSON. Convert them (recursively) to map[string]interface{}.
+func normalizeYAMLValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[fmt.Sprintf("%v", key)] = normalizeYAMLValue(item)
+		}
+		return result
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeYAMLValue(item)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeYAMLValue(item)
+		}
+		return v
+	default:
+		return value
+	}
 }
 
 // Datasource type as described in
@@ -0,0 +1,143 @@
+package grafana
+
+import (
+	"testing"
+)
+
+func stringPtr(s string) *string { return &s }
+
+func boolPtr(b bool) *bool { return &b }
+
+func TestMergeDatasource(t *testing.T) {
+	live := Datasource{
+		ID:               7,
+		UID:              "live-uid",
+		OrgID:            1,
+		Name:             "prometheus",
+		Type:             "prometheus",
+		Access:           "proxy",
+		URL:              "http://old:9090",
+		User:             stringPtr("reader"),
+		Database:         stringPtr("metrics"),
+		BasicAuth:        boolPtr(true),
+		BasicAuthUser:    stringPtr("admin"),
+		WithCredentials:  boolPtr(true),
+		IsDefault:        boolPtr(true),
+		Editable:         boolPtr(true),
+		JSONData:         JSONData{"timeInterval": "30s", "httpMethod": "GET"},
+		SecureJSONFields: map[string]bool{"token": true},
+		Version:          5,
+		ReadOnly:         false,
+	}
+
+	tests := []struct {
+		name    string
+		desired Datasource
+		check   func(t *testing.T, merged Datasource)
+	}{
+		{
+			name:    "undeclared settings are kept",
+			desired: Datasource{Name: "prometheus", Type: "prometheus"},
+			check: func(t *testing.T, merged Datasource) {
+				if merged.ID != 7 || merged.UID != "live-uid" || merged.URL != "http://old:9090" || merged.Access != "proxy" {
+					t.Errorf("identity or url changed: %+v", merged)
+				}
+				if *merged.User != "reader" || *merged.Database != "metrics" || !*merged.BasicAuth || *merged.BasicAuthUser != "admin" {
+					t.Errorf("optional settings changed: %+v", merged)
+				}
+				if !*merged.WithCredentials || !*merged.IsDefault || !*merged.Editable {
+					t.Errorf("withCredentials, isDefault and editable must be kept: %v %v %v", *merged.WithCredentials, *merged.IsDefault, *merged.Editable)
+				}
+				if merged.JSONData["timeInterval"] != "30s" || merged.JSONData["httpMethod"] != "GET" {
+					t.Errorf("jsonData changed: %v", merged.JSONData)
+				}
+				if merged.Version != 5 {
+					t.Errorf("version = %d, want 5", merged.Version)
+				}
+			},
+		},
+		{
+			name: "declared settings win",
+			desired: Datasource{
+				Name:            "prometheus",
+				Type:            "prometheus",
+				UID:             "new-uid",
+				URL:             "http://new:9090",
+				User:            stringPtr("writer"),
+				WithCredentials: boolPtr(false),
+				IsDefault:       boolPtr(false),
+				Editable:        boolPtr(false),
+			},
+			check: func(t *testing.T, merged Datasource) {
+				if merged.UID != "new-uid" || merged.URL != "http://new:9090" || *merged.User != "writer" {
+					t.Errorf("declared settings not applied: %+v", merged)
+				}
+				if *merged.WithCredentials || *merged.IsDefault || *merged.Editable {
+					t.Errorf("declared false values not applied: %v %v %v", *merged.WithCredentials, *merged.IsDefault, *merged.Editable)
+				}
+			},
+		},
+		{
+			name:    "declared jsonData replaces the stored one",
+			desired: Datasource{Name: "prometheus", Type: "prometheus", JSONData: JSONData{"httpMethod": "POST", "exemplars": true}},
+			check: func(t *testing.T, merged Datasource) {
+				want := JSONData{"httpMethod": "POST", "exemplars": true}
+				if len(merged.JSONData) != len(want) {
+					t.Errorf("jsonData = %v, want %v", merged.JSONData, want)
+				}
+				for key, value := range want {
+					if merged.JSONData[key] != value {
+						t.Errorf("jsonData.%s = %v, want %v", key, merged.JSONData[key], value)
+					}
+				}
+				if live.JSONData["httpMethod"] != "GET" {
+					t.Errorf("jsonData of the live datasource was modified: %v", live.JSONData)
+				}
+			},
+		},
+		{
+			name:    "secrets are only sent if declared",
+			desired: Datasource{Name: "prometheus", Type: "prometheus", SecureJSONData: map[string]string{"token": "new"}},
+			check: func(t *testing.T, merged Datasource) {
+				if merged.SecureJSONData["token"] != "new" {
+					t.Errorf("secureJsonData = %v", merged.SecureJSONData)
+				}
+				if merged.SecureJSONFields != nil {
+					t.Errorf("secureJsonFields must not be sent: %v", merged.SecureJSONFields)
+				}
+				if merged.Password != nil {
+					t.Errorf("password must not be sent: %v", *merged.Password)
+				}
+			},
+		},
+		{
+			name:    "newer desired version",
+			desired: Datasource{Name: "prometheus", Type: "prometheus", Version: 9},
+			check: func(t *testing.T, merged Datasource) {
+				if merged.Version != 9 {
+					t.Errorf("version = %d, want 9", merged.Version)
+				}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.check(t, MergeDatasource(test.desired, live))
+		})
+	}
+}
+
+func TestSecretsHash(t *testing.T) {
+	a := Datasource{Password: stringPtr("p"), SecureJSONData: map[string]string{"x": "1", "y": "2"}}
+	b := Datasource{Password: stringPtr("p"), SecureJSONData: map[string]string{"y": "2", "x": "1"}}
+	if a.SecretsHash() == "" || a.SecretsHash() != b.SecretsHash() {
+		t.Error("the hash must not depend on the order of secureJsonData")
+	}
+	b.SecureJSONData["y"] = "3"
+	if a.SecretsHash() == b.SecretsHash() {
+		t.Error("the hash must change with the secrets")
+	}
+	if (&Datasource{Name: "x"}).SecretsHash() != "" {
+		t.Error("datasources without secrets have no hash")
+	}
+}
@@ -0,0 +1,69 @@
+package grafana
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// APIError is returned by the client for every response of grafana with a
+// status code outside of 2xx.
+type APIError struct {
+	StatusCode int
+	// Message of grafana's error reply, or the reply itself if it has none
+	Message  string
+	Method   string
+	Endpoint string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("HTTP error %d: %s %s returns %s", e.StatusCode, e.Method, e.Endpoint, e.Message)
+}
+
+// The endpoint is the path relative to the API URL, so credentials that are
+// part of the URL never show up in errors.
+func newAPIError(method string, endpoint string, code int, raw []byte) *APIError {
+	reply := struct {
+		Message string `json:"message"`
+	}{}
+	message := strings.TrimSpace(string(raw))
+	if json.Unmarshal(raw, &reply) == nil && reply.Message != "" {
+		message = reply.Message
+	}
+	if message == "" {
+		message = http.StatusText(code)
+	}
+	return &APIError{StatusCode: code, Message: message, Method: method, Endpoint: endpoint}
+}
+
+// StatusCode returns the HTTP status of an APIError, 0 for any other error.
+func StatusCode(err error) int {
+	if apiErr, ok := err.(*APIError); ok {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// IsNotFound reports whether the requested object does not exist.
+func IsNotFound(err error) bool {
+	return StatusCode(err) == http.StatusNotFound
+}
+
+// IsConflict reports whether the request clashed with the stored state.
+// Grafana answers version mismatches and duplicate names of dashboards with
+// 412 Precondition Failed and other duplicates with 409 Conflict.
+func IsConflict(err error) bool {
+	code := StatusCode(err)
+	return code == http.StatusConflict || code == http.StatusPreconditionFailed
+}
+
+// IsUnauthorized reports whether grafana rejected the credentials of the client.
+func IsUnauthorized(err error) bool {
+	return StatusCode(err) == http.StatusUnauthorized
+}
+
+// IsForbidden reports whether the credentials lack a permission for the request.
+func IsForbidden(err error) bool {
+	return StatusCode(err) == http.StatusForbidden
+}
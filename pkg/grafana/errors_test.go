@@ -0,0 +1,64 @@
+package grafana
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewAPIError(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    int
+		raw     string
+		message string
+	}{
+		{name: "grafana message", code: 404, raw: `{"message":"Dashboard not found"}`, message: "Dashboard not found"},
+		{name: "reply without message", code: 500, raw: `{"error":"boom"}`, message: `{"error":"boom"}`},
+		{name: "plain text", code: 502, raw: " Bad Gateway\n", message: "Bad Gateway"},
+		{name: "empty reply", code: 403, raw: "", message: "Forbidden"},
+	}
+	for _, test := range tests {
+		err := newAPIError("GET", "api/dashboards/uid/x", test.code, []byte(test.raw))
+		if err.Message != test.message {
+			t.Errorf("%s: message = %q, want %q", test.name, err.Message, test.message)
+		}
+		if err.StatusCode != test.code || err.Method != "GET" || err.Endpoint != "api/dashboards/uid/x" {
+			t.Errorf("%s: unexpected error %+v", test.name, err)
+		}
+	}
+
+	err := newAPIError("POST", "api/folders", 409, []byte(`{"message":"exists"}`))
+	if want := "HTTP error 409: POST api/folders returns exists"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestErrorClassification(t *testing.T) {
+	apiError := func(code int) error { return newAPIError("GET", "api", code, nil) }
+	tests := []struct {
+		err          error
+		status       int
+		notFound     bool
+		conflict     bool
+		unauthorized bool
+		forbidden    bool
+	}{
+		{err: apiError(404), status: 404, notFound: true},
+		{err: apiError(409), status: 409, conflict: true},
+		{err: apiError(412), status: 412, conflict: true},
+		{err: apiError(401), status: 401, unauthorized: true},
+		{err: apiError(403), status: 403, forbidden: true},
+		{err: apiError(500), status: 500},
+		{err: errors.New("connection refused")},
+		{err: nil},
+	}
+	for _, test := range tests {
+		if got := StatusCode(test.err); got != test.status {
+			t.Errorf("StatusCode(%v) = %d, want %d", test.err, got, test.status)
+		}
+		if IsNotFound(test.err) != test.notFound || IsConflict(test.err) != test.conflict ||
+			IsUnauthorized(test.err) != test.unauthorized || IsForbidden(test.err) != test.forbidden {
+			t.Errorf("wrong classification of %v", test.err)
+		}
+	}
+}
@@ -1,46 +1,119 @@
 package grafana
 
-
 import (
 	"encoding/json"
 	"fmt"
+	"net/url"
 )
 
-// GetAllDatasources loads all datasources.
-// It reflects GET /api/datasources API call.
+// GetAllFolders loads all folders.
+// It reflects GET /api/folders API call.
 func (r *Client) GetAllFolders() ([]Folder, error) {
 	var (
-		raw  []byte
-		ds   []Folder
-		code int
-		err  error
+		raw []byte
+		ds  []Folder
+		err error
 	)
-	if raw, code, err = r.get("api/folders", nil); err != nil {
+	if raw, _, err = r.get("api/folders", nil); err != nil {
 		return nil, err
 	}
-	if code != 200 {
-		return nil, fmt.Errorf("HTTP error %d: returns %s", code, raw)
-	}
 	err = json.Unmarshal(raw, &ds)
 	return ds, err
 }
 
+// GetFolders loads the folders below a parent folder. An empty parentUID
+// lists the top level folders. Grafana versions without nested folders
+// ignore the parent and return all folders.
+// It reflects GET /api/folders?parentUid=:parentUid API call.
+func (r *Client) GetFolders(parentUID string) ([]Folder, error) {
+	var (
+		raw     []byte
+		folders []Folder
+		err     error
+	)
+	var params url.Values
+	if parentUID != "" {
+		params = url.Values{}
+		params.Set("parentUid", parentUID)
+	}
+	if raw, _, err = r.get("api/folders", params); err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(raw, &folders)
+	return folders, err
+}
+
+// GetFolderByTitleInParent looks up a folder by its title within a parent folder,
+// so folders with the same title in different branches are told apart. It returns
+// nil if there is no such folder.
+func (r *Client) GetFolderByTitleInParent(title string, parentUID string) (*Folder, error) {
+	folders, err := r.GetFolders(parentUID)
+	if err != nil {
+		return nil, err
+	}
+	for _, folder := range folders {
+		if folder.Title == title && folder.ParentUID == parentUID {
+			return &folder, nil
+		}
+	}
+	return nil, nil
+}
+
+// GetFolderByPath looks up a nested folder by the titles of the folders leading
+// to it, starting at the top level. It returns nil if any folder of the path
+// does not exist.
+func (r *Client) GetFolderByPath(path []string) (*Folder, error) {
+	var folder *Folder
+	parentUID := ""
+	for _, title := range path {
+		var err error
+		if folder, err = r.GetFolderByTitleInParent(title, parentUID); err != nil || folder == nil {
+			return nil, err
+		}
+		parentUID = folder.UID
+	}
+	return folder, nil
+}
+
+// MoveFolder moves a folder below another parent folder. An empty parentUID
+// moves it to the top level.
+// It reflects POST /api/folders/:uid/move API call.
+func (r *Client) MoveFolder(uid string, parentUID string) (Folder, error) {
+	var (
+		raw    []byte
+		folder Folder
+		err    error
+		move   = struct {
+			ParentUID string `json:"parentUid"`
+		}{ParentUID: parentUID}
+	)
+	if raw, err = json.Marshal(move); err != nil {
+		return Folder{}, err
+	}
+	if raw, _, err = r.post(fmt.Sprintf("api/folders/%s/move", uid), nil, raw); err != nil {
+		return Folder{}, err
+	}
+	err = json.Unmarshal(raw, &folder)
+	return folder, err
+}
+
+// GetFolderByTitle looks up a folder by its title. It returns nil if there is no
+// such folder.
 func (r *Client) GetFolderByTitle(title string) (*Folder, error) {
 	folders, err := r.GetAllFolders()
 	if err != nil {
-		return nil,err
+		return nil, err
 	}
 	for _, folder := range folders {
-		if (folder.Title == title) {
+		if folder.Title == title {
 			return &folder, nil
 		}
 	}
 	return nil, nil
 }
 
-
-// CreateDatasource creates a new datasource.
-// It reflects POST /api/datasources API call.
+// CreateFolder creates a new folder.
+// It reflects POST /api/folders API call.
 func (r *Client) CreateFolder(f Folder) (StatusMessage, error) {
 	var (
 		raw  []byte
@@ -58,3 +131,122 @@ func (r *Client) CreateFolder(f Folder) (StatusMessage, error) {
 	}
 	return resp, nil
 }
+
+// DeleteFolder deletes an existing folder and all dashboards stored in it.
+// It reflects DELETE /api/folders/:uid API call.
+func (r *Client) DeleteFolder(uid string) (StatusMessage, error) {
+	var (
+		raw   []byte
+		reply StatusMessage
+		err   error
+	)
+	if raw, _, err = r.delete(fmt.Sprintf("api/folders/%s", uid)); err != nil {
+		return StatusMessage{}, err
+	}
+	err = json.Unmarshal(raw, &reply)
+	return reply, err
+}
+
+// GetFolder loads a folder by its uid.
+// It reflects GET /api/folders/:uid API call.
+func (r *Client) GetFolder(uid string) (Folder, error) {
+	var (
+		raw    []byte
+		folder Folder
+		err    error
+	)
+	if raw, _, err = r.get(fmt.Sprintf("api/folders/%s", uid), nil); err != nil {
+		return folder, err
+	}
+	err = json.Unmarshal(raw, &folder)
+	return folder, err
+}
+
+// GetFolderByID loads a folder by its id.
+// It reflects GET /api/folders/id/:id API call.
+func (r *Client) GetFolderByID(id uint) (Folder, error) {
+	var (
+		raw    []byte
+		folder Folder
+		err    error
+	)
+	if raw, _, err = r.get(fmt.Sprintf("api/folders/id/%d", id), nil); err != nil {
+		return folder, err
+	}
+	err = json.Unmarshal(raw, &folder)
+	return folder, err
+}
+
+// UpdateFolder updates the title (and uid) of the folder f.UID. The version of f
+// must match the stored one unless overwrite is set.
+// It reflects PUT /api/folders/:uid API call.
+func (r *Client) UpdateFolder(f Folder, overwrite bool) (Folder, error) {
+	var (
+		raw    []byte
+		folder Folder
+		err    error
+		update = struct {
+			UID       string `json:"uid,omitempty"`
+			Title     string `json:"title"`
+			Version   int    `json:"version"`
+			Overwrite bool   `json:"overwrite"`
+		}{UID: f.UID, Title: f.Title, Version: f.Version, Overwrite: overwrite}
+	)
+	if raw, err = json.Marshal(update); err != nil {
+		return Folder{}, err
+	}
+	if raw, _, err = r.put(fmt.Sprintf("api/folders/%s", f.UID), nil, raw); err != nil {
+		return Folder{}, err
+	}
+	err = json.Unmarshal(raw, &folder)
+	return folder, err
+}
+
+// RenameFolder changes the title of a folder.
+func (r *Client) RenameFolder(uid string, title string) (Folder, error) {
+	folder, err := r.GetFolder(uid)
+	if err != nil {
+		return Folder{}, err
+	}
+	folder.Title = title
+	return r.UpdateFolder(folder, false)
+}
+
+// GetFolderPermissions loads the access control list of a folder.
+// It reflects GET /api/folders/:uid/permissions API call.
+func (r *Client) GetFolderPermissions(uid string) ([]Permission, error) {
+	var (
+		raw         []byte
+		permissions []Permission
+		err         error
+	)
+	if raw, _, err = r.get(fmt.Sprintf("api/folders/%s/permissions", uid), nil); err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(raw, &permissions)
+	return permissions, err
+}
+
+// UpdateFolderPermissions replaces the access control list of a folder.
+// It reflects POST /api/folders/:uid/permissions API call.
+func (r *Client) UpdateFolderPermissions(uid string, items []PermissionItem) (StatusMessage, error) {
+	var (
+		raw    []byte
+		reply  StatusMessage
+		err    error
+		update = struct {
+			Items []PermissionItem `json:"items"`
+		}{Items: items}
+	)
+	if update.Items == nil {
+		update.Items = []PermissionItem{}
+	}
+	if raw, err = json.Marshal(update); err != nil {
+		return StatusMessage{}, err
+	}
+	if raw, _, err = r.post(fmt.Sprintf("api/folders/%s/permissions", uid), nil, raw); err != nil {
+		return StatusMessage{}, err
+	}
+	err = json.Unmarshal(raw, &reply)
+	return reply, err
+}
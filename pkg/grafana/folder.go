@@ -26,25 +26,23 @@ var (
 	folderID uint
 )
 
-
 type (
 	// Board represents Grafana dashboard.
 	Folder struct {
-		ID              uint       `json:"id,omitempty"`
-		UID             string     `json:"uid,omitempty"`
-		Title           string     `json:"title"`
-		URL         	string  `json:"url,omitempty"`
-	HasAcl    bool      `json:"hasAcl"`
-	CanSave    bool      `json:"canSave"`
-	CanEdit    bool      `json:"canEdit"`
-	CanAdmin    bool      `json:"canAdmin"`
-
-
-			Created    time.Time `json:"created"`
-	Updated    time.Time `json:"updated"`
-	UpdatedBy  string    `json:"updatedBy"`
-	CreatedBy  string    `json:"createdBy"`
-	Version    int       `json:"version"`
+		ID        uint   `json:"id,omitempty"`
+		UID       string `json:"uid,omitempty"`
+		Title     string `json:"title"`
+		ParentUID string `json:"parentUid,omitempty"`
+		URL       string `json:"url,omitempty"`
+		HasAcl    bool   `json:"hasAcl"`
+		CanSave   bool   `json:"canSave"`
+		CanEdit   bool   `json:"canEdit"`
+		CanAdmin  bool   `json:"canAdmin"`
+
+		Created   time.Time `json:"created"`
+		Updated   time.Time `json:"updated"`
+		UpdatedBy string    `json:"updatedBy"`
+		CreatedBy string    `json:"createdBy"`
+		Version   int       `json:"version"`
 	}
-
 )
@@ -0,0 +1,137 @@
+package grafana
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ExpandVariables replaces $VAR and ${VAR} references the way grafana's file
+// provisioning does, $$ stands for a literal $. Every reference is resolved by
+// lookup, which is expected to fail for unknown names.
+func ExpandVariables(value string, lookup func(name string) (string, error)) (string, error) {
+	if !strings.Contains(value, "$") {
+		return value, nil
+	}
+	var result strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '$' || i+1 == len(value) {
+			result.WriteByte(value[i])
+			continue
+		}
+		var name string
+		switch next := value[i+1]; {
+		case next == '$':
+			result.WriteByte('$')
+			i++
+			continue
+		case next == '{':
+			end := strings.IndexByte(value[i+2:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated reference '%s'", value[i:])
+			}
+			name = value[i+2 : i+2+end]
+			if name == "" {
+				return "", fmt.Errorf("empty reference '${}'")
+			}
+			i += end + 2
+		case isVariableStart(next):
+			end := i + 2
+			for end < len(value) && isVariableChar(value[end]) {
+				end++
+			}
+			name = value[i+1 : end]
+			i = end - 1
+		default:
+			result.WriteByte('$')
+			continue
+		}
+		resolved, err := lookup(name)
+		if err != nil {
+			return "", err
+		}
+		result.WriteString(resolved)
+	}
+	return result.String(), nil
+}
+
+func isVariableStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isVariableChar(c byte) bool {
+	return isVariableStart(c) || (c >= '0' && c <= '9')
+}
+
+// WithExpandedVariables returns a copy of the datasource with the variable
+// references in all string settings expanded, including its jsonData and
+// secureJsonData. The error names every setting with a reference that could
+// not be resolved.
+func (ds Datasource) WithExpandedVariables(lookup func(name string) (string, error)) (Datasource, error) {
+	errs := []string{}
+	expand := func(field string, value string) string {
+		expanded, err := ExpandVariables(value, lookup)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", field, err))
+			return value
+		}
+		return expanded
+	}
+	expandPtr := func(field string, value *string) *string {
+		if value == nil {
+			return nil
+		}
+		expanded := expand(field, *value)
+		return &expanded
+	}
+
+	result := ds
+	result.Name = expand("name", ds.Name)
+	result.UID = expand("uid", ds.UID)
+	result.Type = expand("type", ds.Type)
+	result.Access = expand("access", ds.Access)
+	result.URL = expand("url", ds.URL)
+	result.User = expandPtr("user", ds.User)
+	result.Password = expandPtr("password", ds.Password)
+	result.Database = expandPtr("database", ds.Database)
+	result.BasicAuthUser = expandPtr("basicAuthUser", ds.BasicAuthUser)
+	result.BasicAuthPassword = expandPtr("basicAuthPassword", ds.BasicAuthPassword)
+	if ds.SecureJSONData != nil {
+		result.SecureJSONData = make(map[string]string, len(ds.SecureJSONData))
+		for key, value := range ds.SecureJSONData {
+			result.SecureJSONData[key] = expand("secureJsonData."+key, value)
+		}
+	}
+	if ds.JSONData != nil {
+		result.JSONData = make(JSONData, len(ds.JSONData))
+		for key, value := range ds.JSONData {
+			result.JSONData[key] = expandValue("jsonData."+key, value, expand)
+		}
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return ds, fmt.Errorf("unresolved references in datasource %s: %s", ds.Name, strings.Join(errs, ", "))
+	}
+	return result, nil
+}
+
+// Copy a decoded JSON value with all strings in it expanded
+func expandValue(field string, value interface{}, expand func(string, string) string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return expand(field, v)
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[key] = expandValue(field+"."+key, item, expand)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = expandValue(fmt.Sprintf("%s[%d]", field, i), item, expand)
+		}
+		return result
+	}
+	return value
+}
@@ -0,0 +1,123 @@
+package grafana
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func testLookup(values map[string]string) func(string) (string, error) {
+	return func(name string) (string, error) {
+		if value, ok := values[name]; ok {
+			return value, nil
+		}
+		return "", fmt.Errorf("unknown variable %s", name)
+	}
+}
+
+func TestExpandVariables(t *testing.T) {
+	lookup := testLookup(map[string]string{"HOST": "db", "PORT": "5432", "EMPTY": ""})
+	tests := []struct {
+		value   string
+		want    string
+		wantErr string
+	}{
+		{value: "plain", want: "plain"},
+		{value: "$HOST:$PORT", want: "db:5432"},
+		{value: "${HOST}.svc:${PORT}", want: "db.svc:5432"},
+		{value: "$HOST_NAME", wantErr: "unknown variable HOST_NAME"},
+		{value: "x${EMPTY}y", want: "xy"},
+		{value: "cost $$5", want: "cost $5"},
+		{value: "$$HOST", want: "$HOST"},
+		{value: "trailing $", want: "trailing $"},
+		{value: "$1 and $-", want: "$1 and $-"},
+		{value: "${HOST", wantErr: "unterminated reference"},
+		{value: "${}", wantErr: "empty reference"},
+		{value: "$MISSING", wantErr: "unknown variable MISSING"},
+	}
+	for _, test := range tests {
+		got, err := ExpandVariables(test.value, lookup)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("ExpandVariables(%q) error = %v, want %q", test.value, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ExpandVariables(%q) unexpected error: %v", test.value, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ExpandVariables(%q) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestWithExpandedVariables(t *testing.T) {
+	lookup := testLookup(map[string]string{"HOST": "db", "PASSWORD": "secret", "TOKEN": "t0k3n"})
+	user := "$$user"
+	password := "$PASSWORD"
+	ds := Datasource{
+		Name:     "postgres",
+		Type:     "postgres",
+		URL:      "${HOST}:5432",
+		User:     &user,
+		Password: &password,
+		JSONData: JSONData{
+			"sslmode": "disable",
+			"nested":  map[string]interface{}{"host": "$HOST", "port": float64(5432)},
+			"list":    []interface{}{"$HOST", true},
+		},
+		SecureJSONData: map[string]string{"token": "$TOKEN"},
+	}
+
+	expanded, err := ds.WithExpandedVariables(lookup)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expanded.URL != "db:5432" {
+		t.Errorf("url = %q, want %q", expanded.URL, "db:5432")
+	}
+	if *expanded.User != "$user" {
+		t.Errorf("user = %q, want %q", *expanded.User, "$user")
+	}
+	if *expanded.Password != "secret" {
+		t.Errorf("password = %q, want %q", *expanded.Password, "secret")
+	}
+	if expanded.SecureJSONData["token"] != "t0k3n" {
+		t.Errorf("secureJsonData.token = %q, want %q", expanded.SecureJSONData["token"], "t0k3n")
+	}
+	nested := expanded.JSONData["nested"].(map[string]interface{})
+	if nested["host"] != "db" || nested["port"] != float64(5432) {
+		t.Errorf("jsonData.nested = %v", nested)
+	}
+	list := expanded.JSONData["list"].([]interface{})
+	if list[0] != "db" || list[1] != true {
+		t.Errorf("jsonData.list = %v", list)
+	}
+	// the original is left alone
+	if ds.URL != "${HOST}:5432" || *ds.Password != "$PASSWORD" || ds.SecureJSONData["token"] != "$TOKEN" {
+		t.Errorf("original datasource was modified: %+v", ds)
+	}
+	if ds.JSONData["nested"].(map[string]interface{})["host"] != "$HOST" {
+		t.Errorf("original jsonData was modified: %v", ds.JSONData)
+	}
+}
+
+func TestWithExpandedVariablesErrors(t *testing.T) {
+	ds := Datasource{
+		Name:           "loki",
+		URL:            "$HOST",
+		JSONData:       JSONData{"derivedFields": []interface{}{map[string]interface{}{"url": "${TRACES}"}}},
+		SecureJSONData: map[string]string{"token": "${TOKEN"},
+	}
+	_, err := ds.WithExpandedVariables(testLookup(nil))
+	if err == nil {
+		t.Fatal("expected an error for unresolved references")
+	}
+	for _, field := range []string{"url:", "jsonData.derivedFields[0].url:", "secureJsonData.token:"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("error %q does not name %s", err, field)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package grafana
+
+import (
+	"encoding/json"
+)
+
+// GetCurrentOrg gets the organization the client acts in.
+// It reflects GET /api/org API call.
+func (r *Client) GetCurrentOrg() (Org, error) {
+	var (
+		raw []byte
+		org Org
+		err error
+	)
+	if raw, _, err = r.get("api/org", nil); err != nil {
+		return org, err
+	}
+	err = json.Unmarshal(raw, &org)
+	return org, err
+}
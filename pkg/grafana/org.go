@@ -0,0 +1,8 @@
+package grafana
+
+// Org as described in
+// http://docs.grafana.org/http_api/org/#get-current-organization
+type Org struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
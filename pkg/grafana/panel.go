@@ -53,9 +53,9 @@ type (
 	}
 	panelType   int8
 	commonPanel struct {
-		Datasource *string `json:"datasource,omitempty"` // metrics
-		Editable   bool    `json:"editable"`
-		Error      bool    `json:"error"`
+		Datasource *DashboardDatasourceRef `json:"datasource,omitempty"` // metrics
+		Editable   bool                    `json:"editable"`
+		Error      bool                    `json:"error"`
 		GridPos    struct {
 			H *int `json:"h,omitempty"`
 			W *int `json:"w,omitempty"`
@@ -280,8 +280,8 @@ type valueMap struct {
 
 // for an any panel
 type Target struct {
-	RefID      string `json:"refId"`
-	Datasource string `json:"datasource,omitempty"`
+	RefID      string                  `json:"refId"`
+	Datasource *DashboardDatasourceRef `json:"datasource,omitempty"`
 
 	// For Prometheus
 	Expr           string `json:"expr,omitempty"`
@@ -507,7 +507,7 @@ func (p *Panel) RepeatDatasourcesForEachTarget(dsNames ...string) {
 			for _, ds := range dsNames {
 				newTarget := target
 				newTarget.RefID = refID
-				newTarget.Datasource = ds
+				newTarget.Datasource = &DashboardDatasourceRef{Name: ds}
 				refID = incRefID(refID)
 				*targets = append(*targets, newTarget)
 			}
@@ -532,13 +532,13 @@ func (p *Panel) RepeatTargetsForDatasources(dsNames ...string) {
 		lenTargets := len(*targets)
 		for i, name := range dsNames {
 			if i < lenTargets {
-				(*targets)[i].Datasource = name
+				(*targets)[i].Datasource = &DashboardDatasourceRef{Name: name}
 				lastRefID = (*targets)[i].RefID
 			} else {
 				newTarget := (*targets)[i%lenTargets]
 				lastRefID = incRefID(lastRefID)
 				newTarget.RefID = lastRefID
-				newTarget.Datasource = name
+				newTarget.Datasource = &DashboardDatasourceRef{Name: name}
 				*targets = append(*targets, newTarget)
 			}
 		}
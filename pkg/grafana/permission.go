@@ -0,0 +1,83 @@
+package grafana
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PermissionType is the level of access granted by a permission
+type PermissionType int
+
+// Permission levels as used by the folder and dashboard permission API
+const (
+	PermissionView  PermissionType = 1
+	PermissionEdit  PermissionType = 2
+	PermissionAdmin PermissionType = 4
+)
+
+// ParsePermissionType converts 'View', 'Edit' or 'Admin' (case insensitive)
+// to a PermissionType.
+func ParsePermissionType(name string) (PermissionType, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "view":
+		return PermissionView, nil
+	case "edit":
+		return PermissionEdit, nil
+	case "admin":
+		return PermissionAdmin, nil
+	}
+	return 0, fmt.Errorf("unknown permission '%s'", name)
+}
+
+func (p PermissionType) String() string {
+	switch p {
+	case PermissionView:
+		return "View"
+	case PermissionEdit:
+		return "Edit"
+	case PermissionAdmin:
+		return "Admin"
+	}
+	return fmt.Sprintf("%d", int(p))
+}
+
+// Permission is an entry of a folder or dashboard access control list as
+// returned by grafana.
+// http://docs.grafana.org/http_api/folder_permissions/#get-permissions-for-a-folder
+type Permission struct {
+	ID             uint           `json:"id"`
+	FolderID       uint           `json:"folderId"`
+	DashboardID    uint           `json:"dashboardId"`
+	Created        time.Time      `json:"created"`
+	Updated        time.Time      `json:"updated"`
+	UserID         uint           `json:"userId"`
+	UserLogin      string         `json:"userLogin"`
+	UserEmail      string         `json:"userEmail"`
+	TeamID         uint           `json:"teamId"`
+	Team           string         `json:"team"`
+	Role           string         `json:"role,omitempty"`
+	Permission     PermissionType `json:"permission"`
+	PermissionName string         `json:"permissionName"`
+	UID            string         `json:"uid"`
+	Title          string         `json:"title"`
+	Slug           string         `json:"slug"`
+	IsFolder       bool           `json:"isFolder"`
+	URL            string         `json:"url"`
+	Inherited      bool           `json:"inherited"`
+}
+
+// PermissionItem grants a permission to either a role, a team or a user.
+// http://docs.grafana.org/http_api/folder_permissions/#update-permissions-for-a-folder
+type PermissionItem struct {
+	Role       string         `json:"role,omitempty"`
+	TeamID     uint           `json:"teamId,omitempty"`
+	UserID     uint           `json:"userId,omitempty"`
+	Permission PermissionType `json:"permission"`
+}
+
+// Item converts an access control list entry to an item that can be sent back
+// to grafana.
+func (p Permission) Item() PermissionItem {
+	return PermissionItem{Role: p.Role, TeamID: p.TeamID, UserID: p.UserID, Permission: p.Permission}
+}
@@ -0,0 +1,75 @@
+package grafana
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Upper bound of the wait between two attempts of a request, including waits
+// requested by Retry-After
+const maxRetryWait = 2 * time.Minute
+
+// Requests that can be sent again without changing the outcome. POST and
+// PATCH are never retried, as grafana may have applied them already.
+func idempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "PUT", "DELETE", "OPTIONS":
+		return true
+	}
+	return false
+}
+
+// Status codes of temporary failures
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || (code >= 500 && code != http.StatusNotImplemented)
+}
+
+// Parse a Retry-After header, given in seconds or as HTTP date
+func retryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// Exponential backoff with jitter, the wait is chosen at random from the
+// upper half of base * 2^attempt. A longer Retry-After takes precedence.
+func backoff(base time.Duration, attempt int, retryAfter time.Duration) time.Duration {
+	wait := base
+	for i := 0; i < attempt && wait < maxRetryWait; i++ {
+		wait *= 2
+	}
+	if wait > 1 {
+		wait = wait/2 + time.Duration(rand.Int63n(int64(wait/2)))
+	}
+	if retryAfter > wait {
+		wait = retryAfter
+	}
+	if wait > maxRetryWait {
+		wait = maxRetryWait
+	}
+	return wait
+}
+
+// Wait for d unless ctx is done before
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
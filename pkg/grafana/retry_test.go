@@ -0,0 +1,79 @@
+package grafana
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		header string
+		min    time.Duration
+		max    time.Duration
+	}{
+		{header: "", min: 0, max: 0},
+		{header: "5", min: 5 * time.Second, max: 5 * time.Second},
+		{header: "0", min: 0, max: 0},
+		{header: "-3", min: 0, max: 0},
+		{header: "soon", min: 0, max: 0},
+		{header: time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), min: 0, max: 0},
+		{header: time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), min: 58 * time.Second, max: time.Minute},
+	}
+	for _, test := range tests {
+		got := retryAfter(test.header)
+		if got < test.min || got > test.max {
+			t.Errorf("retryAfter(%q) = %s, want between %s and %s", test.header, got, test.min, test.max)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	base := 100 * time.Millisecond
+	tests := []struct {
+		attempt    int
+		retryAfter time.Duration
+		min        time.Duration
+		max        time.Duration
+	}{
+		{attempt: 0, min: 50 * time.Millisecond, max: 100 * time.Millisecond},
+		{attempt: 1, min: 100 * time.Millisecond, max: 200 * time.Millisecond},
+		{attempt: 3, min: 400 * time.Millisecond, max: 800 * time.Millisecond},
+		{attempt: 2, retryAfter: 3 * time.Second, min: 3 * time.Second, max: 3 * time.Second},
+		{attempt: 0, retryAfter: time.Millisecond, min: 50 * time.Millisecond, max: 100 * time.Millisecond},
+		{attempt: 50, min: maxRetryWait / 2, max: maxRetryWait},
+		{attempt: 0, retryAfter: time.Hour, min: maxRetryWait, max: maxRetryWait},
+	}
+	for _, test := range tests {
+		for i := 0; i < 20; i++ {
+			got := backoff(base, test.attempt, test.retryAfter)
+			if got < test.min || got > test.max {
+				t.Errorf("backoff(%s, %d, %s) = %s, want between %s and %s", base, test.attempt, test.retryAfter, got, test.min, test.max)
+				break
+			}
+		}
+	}
+	if got := backoff(0, 3, 0); got != 0 {
+		t.Errorf("backoff without base = %s, want 0", got)
+	}
+}
+
+func TestRetryableStatus(t *testing.T) {
+	tests := map[int]bool{
+		200: false,
+		400: false,
+		404: false,
+		409: false,
+		429: true,
+		500: true,
+		501: false,
+		502: true,
+		503: true,
+		504: true,
+	}
+	for code, want := range tests {
+		if got := retryableStatus(code); got != want {
+			t.Errorf("retryableStatus(%d) = %t, want %t", code, got, want)
+		}
+	}
+}
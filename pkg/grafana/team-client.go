@@ -0,0 +1,58 @@
+package grafana
+
+import (
+	"encoding/json"
+	"net/url"
+)
+
+// SearchTeams searches the teams of the current organization by name.
+// It reflects GET /api/teams/search?name=:name API call.
+func (r *Client) SearchTeams(name string) ([]Team, error) {
+	var (
+		raw    []byte
+		result struct {
+			TotalCount int    `json:"totalCount"`
+			Teams      []Team `json:"teams"`
+		}
+		err error
+	)
+	params := url.Values{}
+	params.Set("name", name)
+	if raw, _, err = r.get("api/teams/search", params); err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(raw, &result)
+	return result.Teams, err
+}
+
+// GetTeamByName looks up a team by its exact name. It returns nil if there is
+// no such team.
+func (r *Client) GetTeamByName(name string) (*Team, error) {
+	teams, err := r.SearchTeams(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, team := range teams {
+		if team.Name == name {
+			return &team, nil
+		}
+	}
+	return nil, nil
+}
+
+// LookupUser gets a user by login or email.
+// It reflects GET /api/users/lookup?loginOrEmail=:loginOrEmail API call.
+func (r *Client) LookupUser(loginOrEmail string) (User, error) {
+	var (
+		raw  []byte
+		user User
+		err  error
+	)
+	params := url.Values{}
+	params.Set("loginOrEmail", loginOrEmail)
+	if raw, _, err = r.get("api/users/lookup", params); err != nil {
+		return user, err
+	}
+	err = json.Unmarshal(raw, &user)
+	return user, err
+}
@@ -0,0 +1,24 @@
+package grafana
+
+// Team as described in
+// http://docs.grafana.org/http_api/team/#team-search-with-paging
+type Team struct {
+	ID          uint   `json:"id"`
+	OrgID       uint   `json:"orgId"`
+	Name        string `json:"name"`
+	Email       string `json:"email"`
+	AvatarURL   string `json:"avatarUrl"`
+	MemberCount int    `json:"memberCount"`
+}
+
+// User as described in
+// http://docs.grafana.org/http_api/user/#get-single-user-by-username-login-or-email
+type User struct {
+	ID             uint   `json:"id"`
+	Email          string `json:"email"`
+	Name           string `json:"name"`
+	Login          string `json:"login"`
+	Theme          string `json:"theme"`
+	OrgID          uint   `json:"orgId"`
+	IsGrafanaAdmin bool   `json:"isGrafanaAdmin"`
+}
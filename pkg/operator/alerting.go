@@ -0,0 +1,329 @@
+package operator
+
+/*
+Copyright [2019] [autonubil System GmbH]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+
+	raven "github.com/getsentry/raven-go"
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	"gitlab.autonubil.net/kubernetes/grafana-config-operator/pkg/grafana"
+)
+
+// Apply or delete the unified alerting objects of a provisioning file. Objects
+// are applied in dependency order: templates, contact points, mute timings,
+// the notification policy and finally the alert rules. Deletion happens in
+// reverse order.
+func (npc *grafanaConfigController) processAlertingConfigMap(configMap *corev1.ConfigMap, file string, config *grafana.AlertingConfigFile, deleteMode bool) error {
+	if deleteMode {
+		glog.V(2).Infof("Handling Delete Alerting %s from Config Map: %s/%s", file, configMap.Namespace, configMap.Name)
+	} else {
+		glog.V(2).Infof("Handling Update Alerting %s from Config Map: %s/%s", file, configMap.Namespace, configMap.Name)
+	}
+	grafanaClient := npc.grafanaClient()
+	tags := map[string]string{"ConfigMap.Namespace": configMap.Namespace, "ConfigMap.Name": configMap.Name, "ConfigMap.File": file}
+	errs := []error{}
+	collect := func(err error, operation string, keyValues ...string) {
+		if err == nil {
+			return
+		}
+		glog.Errorf("%s failed for Config Map: %s/%s %s %v (%#v)", operation, configMap.Namespace, configMap.Name, file, keyValues, err)
+		raven.CaptureError(err, npc.ravenTags(tags, operation, keyValues...))
+		errs = append(errs, err)
+	}
+
+	if deleteMode {
+		for _, group := range config.Groups {
+			collect(npc.deleteAlertRuleGroup(grafanaClient, group), "DeleteAlertRuleGroup", "RuleGroup.Name", group.Name)
+		}
+		if len(config.Policies) > 0 {
+			collect(ignoreNotFound(grafanaClient.ResetNotificationPolicy()), "ResetNotificationPolicy")
+		}
+		for _, muteTiming := range config.MuteTimes {
+			collect(ignoreNotFound(grafanaClient.DeleteMuteTiming(muteTiming.Name)), "DeleteMuteTiming", "MuteTiming.Name", muteTiming.Name)
+		}
+		if len(config.ContactPoints) > 0 {
+			collect(npc.deleteContactPoints(grafanaClient, config.ContactPoints), "DeleteContactPoint")
+		}
+		for _, template := range config.Templates {
+			collect(ignoreNotFound(grafanaClient.DeleteMessageTemplate(template.Name)), "DeleteMessageTemplate", "Template.Name", template.Name)
+		}
+		return utilerrors.NewAggregate(errs)
+	}
+
+	// explicit deletes
+	for _, ref := range config.DeleteRules {
+		collect(ignoreNotFound(grafanaClient.DeleteAlertRule(ref.UID)), "DeleteAlertRule", "AlertRule.UID", ref.UID)
+	}
+	if len(config.ResetPolicies) > 0 {
+		collect(ignoreNotFound(grafanaClient.ResetNotificationPolicy()), "ResetNotificationPolicy")
+	}
+	for _, ref := range config.DeleteMuteTimes {
+		collect(ignoreNotFound(grafanaClient.DeleteMuteTiming(ref.Name)), "DeleteMuteTiming", "MuteTiming.Name", ref.Name)
+	}
+	for _, ref := range config.DeleteContactPoints {
+		collect(ignoreNotFound(grafanaClient.DeleteContactPoint(ref.UID)), "DeleteContactPoint", "ContactPoint.UID", ref.UID)
+	}
+	for _, ref := range config.DeleteTemplates {
+		collect(ignoreNotFound(grafanaClient.DeleteMessageTemplate(ref.Name)), "DeleteMessageTemplate", "Template.Name", ref.Name)
+	}
+
+	for _, template := range config.Templates {
+		collect(grafanaClient.SetMessageTemplate(template.MessageTemplate), "SetMessageTemplate", "Template.Name", template.Name)
+	}
+	if len(config.ContactPoints) > 0 {
+		collect(npc.applyContactPoints(grafanaClient, config.ContactPoints), "ApplyContactPoints")
+	}
+	for _, muteTiming := range config.MuteTimes {
+		collect(applyMuteTiming(grafanaClient, muteTiming.MuteTiming), "ApplyMuteTiming", "MuteTiming.Name", muteTiming.Name)
+	}
+	if len(config.Policies) > 1 {
+		glog.Warningf("Only the last of %d notification policies is applied from Config Map: %s/%s %s", len(config.Policies), configMap.Namespace, configMap.Name, file)
+	}
+	if len(config.Policies) > 0 {
+		collect(grafanaClient.SetNotificationPolicy(config.Policies[len(config.Policies)-1].NotificationPolicy), "SetNotificationPolicy")
+	}
+	// rules are skipped if anything they may depend on failed
+	if len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+	for _, group := range config.Groups {
+		collect(npc.applyAlertRuleGroup(grafanaClient, group, tags), "SetAlertRuleGroup", "RuleGroup.Name", group.Name, "Folder.Name", group.Folder)
+	}
+	if len(errs) == 0 {
+		glog.V(1).Infof("Applied Alerting %s from Config Map: %s/%s", file, configMap.Namespace, configMap.Name)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// Deletes of objects that are already gone succeed
+func ignoreNotFound(err error) error {
+	if grafana.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// Identifies a receiver of a contact point by its uid, or by the name of the
+// contact point and its type if it has none
+func contactPointKey(name string, uid string, receiverType string) string {
+	if uid != "" {
+		return "uid:" + uid
+	}
+	return "name:" + name + "/" + receiverType
+}
+
+// Create or update the receivers of contact points. Receivers without uid are
+// matched by the name of the contact point and their type.
+func (npc *grafanaConfigController) applyContactPoints(grafanaClient *grafana.Client, contactPoints []grafana.ContactPointConfig) error {
+	existing, err := grafanaClient.GetContactPoints()
+	if err != nil {
+		return err
+	}
+	known := make(map[string]string, len(existing)*2)
+	for _, contactPoint := range existing {
+		known[contactPointKey(contactPoint.Name, contactPoint.UID, contactPoint.Type)] = contactPoint.UID
+		known[contactPointKey(contactPoint.Name, "", contactPoint.Type)] = contactPoint.UID
+	}
+
+	errs := []error{}
+	for _, config := range contactPoints {
+		for _, contactPoint := range config.ContactPoints() {
+			uid, found := known[contactPointKey(contactPoint.Name, contactPoint.UID, contactPoint.Type)]
+			if found {
+				contactPoint.UID = uid
+				err = grafanaClient.UpdateContactPoint(contactPoint)
+			} else {
+				_, err = grafanaClient.CreateContactPoint(contactPoint)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("contact point %s (%s): %v", contactPoint.Name, contactPoint.Type, err))
+				continue
+			}
+			glog.V(3).Infof("Applied Contact Point %s (%s)", contactPoint.Name, contactPoint.Type)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// Delete the receivers of contact points
+func (npc *grafanaConfigController) deleteContactPoints(grafanaClient *grafana.Client, contactPoints []grafana.ContactPointConfig) error {
+	existing, err := grafanaClient.GetContactPoints()
+	if err != nil {
+		return err
+	}
+	known := make(map[string]string, len(existing)*2)
+	for _, contactPoint := range existing {
+		known[contactPointKey(contactPoint.Name, contactPoint.UID, contactPoint.Type)] = contactPoint.UID
+		known[contactPointKey(contactPoint.Name, "", contactPoint.Type)] = contactPoint.UID
+	}
+
+	errs := []error{}
+	for _, config := range contactPoints {
+		for _, contactPoint := range config.ContactPoints() {
+			uid, found := known[contactPointKey(contactPoint.Name, contactPoint.UID, contactPoint.Type)]
+			if !found {
+				continue
+			}
+			if err := ignoreNotFound(grafanaClient.DeleteContactPoint(uid)); err != nil {
+				errs = append(errs, fmt.Errorf("contact point %s (%s): %v", contactPoint.Name, contactPoint.Type, err))
+				continue
+			}
+			glog.V(1).Infof("Deleted Contact Point %s (%s)", contactPoint.Name, contactPoint.Type)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// Create or update a mute timing
+func applyMuteTiming(grafanaClient *grafana.Client, muteTiming grafana.MuteTiming) error {
+	_, err := grafanaClient.GetMuteTiming(muteTiming.Name)
+	if grafana.IsNotFound(err) {
+		return grafanaClient.CreateMuteTiming(muteTiming)
+	}
+	if err != nil {
+		return err
+	}
+	return grafanaClient.UpdateMuteTiming(muteTiming)
+}
+
+// Create or replace a rule group in its folder, creating the folder if needed
+func (npc *grafanaConfigController) applyAlertRuleGroup(grafanaClient *grafana.Client, config grafana.AlertRuleGroupConfig, tags map[string]string) error {
+	if config.Folder == "" {
+		return fmt.Errorf("rule group %s has no folder", config.Name)
+	}
+	folderID, err := npc.ensureFolderPath(npc.folderPath(config.Folder), "", tags)
+	if err != nil {
+		return err
+	}
+	folder, err := grafanaClient.GetFolderByID(folderID)
+	if err != nil {
+		return err
+	}
+	group, err := config.RuleGroup(folder.UID)
+	if err != nil {
+		return err
+	}
+	if err := grafanaClient.SetAlertRuleGroup(group); err != nil {
+		return err
+	}
+	glog.V(3).Infof("Applied Rule Group %s in Folder %s", config.Name, config.Folder)
+	return nil
+}
+
+// Delete all rules of a rule group. Nothing is deleted if the folder does not
+// exist.
+func (npc *grafanaConfigController) deleteAlertRuleGroup(grafanaClient *grafana.Client, config grafana.AlertRuleGroupConfig) error {
+	parentUID := ""
+	for _, title := range npc.folderPath(config.Folder) {
+		folder, err := grafanaClient.GetFolderByTitleInParent(title, parentUID)
+		if err != nil {
+			return err
+		}
+		if folder == nil {
+			return nil
+		}
+		parentUID = folder.UID
+	}
+	if parentUID == "" {
+		return nil
+	}
+	group, err := grafanaClient.GetAlertRuleGroup(parentUID, config.Name)
+	if grafana.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	errs := []error{}
+	for _, rule := range group.Rules {
+		if err := ignoreNotFound(grafanaClient.DeleteAlertRule(rule.UID)); err != nil {
+			errs = append(errs, fmt.Errorf("alert rule %s: %v", rule.Title, err))
+		}
+	}
+	if len(errs) == 0 {
+		glog.V(1).Infof("Deleted Rule Group %s in Folder %s", config.Name, config.Folder)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// Key of every object declared by an alerting provisioning file
+func alertingKeys(config *grafana.AlertingConfigFile) map[string]bool {
+	keys := make(map[string]bool)
+	for _, group := range config.Groups {
+		keys["group:"+group.Folder+"/"+group.Name] = true
+	}
+	for _, contactPoint := range config.ContactPoints {
+		for _, receiver := range contactPoint.Receivers {
+			keys["contactPoint:"+contactPointKey(contactPoint.Name, receiver.UID, receiver.Type)] = true
+		}
+	}
+	if len(config.Policies) > 0 {
+		keys["policies"] = true
+	}
+	for _, muteTiming := range config.MuteTimes {
+		keys["muteTiming:"+muteTiming.Name] = true
+	}
+	for _, template := range config.Templates {
+		keys["template:"+template.Name] = true
+	}
+	return keys
+}
+
+// The objects of an alerting provisioning file whose keys are not kept
+func removedAlerting(config *grafana.AlertingConfigFile, keep map[string]bool) *grafana.AlertingConfigFile {
+	removed := &grafana.AlertingConfigFile{ApiVersion: config.ApiVersion}
+	for _, group := range config.Groups {
+		if !keep["group:"+group.Folder+"/"+group.Name] {
+			removed.Groups = append(removed.Groups, group)
+		}
+	}
+	for _, contactPoint := range config.ContactPoints {
+		receivers := []grafana.ContactPointReceiver{}
+		for _, receiver := range contactPoint.Receivers {
+			if !keep["contactPoint:"+contactPointKey(contactPoint.Name, receiver.UID, receiver.Type)] {
+				receivers = append(receivers, receiver)
+			}
+		}
+		if len(receivers) > 0 {
+			contactPoint.Receivers = receivers
+			removed.ContactPoints = append(removed.ContactPoints, contactPoint)
+		}
+	}
+	if !keep["policies"] {
+		removed.Policies = config.Policies
+	}
+	for _, muteTiming := range config.MuteTimes {
+		if !keep["muteTiming:"+muteTiming.Name] {
+			removed.MuteTimes = append(removed.MuteTimes, muteTiming)
+		}
+	}
+	for _, template := range config.Templates {
+		if !keep["template:"+template.Name] {
+			removed.Templates = append(removed.Templates, template)
+		}
+	}
+	return removed
+}
+
+// Whether an alerting provisioning file declares any object
+func alertingEmpty(config *grafana.AlertingConfigFile) bool {
+	return len(config.Groups) == 0 && len(config.ContactPoints) == 0 && len(config.Policies) == 0 && len(config.MuteTimes) == 0 && len(config.Templates) == 0
+}
@@ -1,23 +1,29 @@
 package operator
 
 /*
-Copyright [2019] [autonubil System GmbH] 
- 
-Licensed under the Apache License, Version 2.0 (the "License"); 
-you may not use this file except in compliance with the License. 
-You may obtain a copy of the License at 
- 
-	http://www.apache.org/licenses/LICENSE-2.0 
- 
-Unless required by applicable law or agreed to in writing, software 
-distributed under the License is distributed on an "AS IS" BASIS, 
-WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. 
-See the License for the specific language governing permissions and 
+Copyright [2019] [autonubil System GmbH]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
 limitations under the License.
 */
 
 import (
+	"context"
+	"fmt"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 
 	raven "github.com/getsentry/raven-go"
@@ -28,26 +34,67 @@ import (
 
 	"k8s.io/client-go/kubernetes"
 
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apimachinery/pkg/watch"
 
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
 
 	"github.com/golang/glog"
+	"gitlab.autonubil.net/kubernetes/grafana-config-operator/pkg/apis/grafana/v1alpha1"
+	"gitlab.autonubil.net/kubernetes/grafana-config-operator/pkg/client"
 	"gitlab.autonubil.net/kubernetes/grafana-config-operator/pkg/grafana"
 	"gitlab.autonubil.net/kubernetes/grafana-config-operator/pkg/utils"
 )
 
 // Define a type for the options of grafanaConfigOperator
 type GrafanaControllerOptions struct {
-	KubeConfig      string
-	Namespace       string
-	GrafanaEndpoint string
-	GrafanaAuth     string
-	DashboardLabel  string
-	DatasourceLabel string
-	DbaasFolder     bool
+	KubeConfig            string
+	Namespace             string
+	GrafanaEndpoint       string
+	GrafanaAuth           string
+	DashboardLabel        string
+	DatasourceLabel       string
+	NotifierLabel         string
+	AlertingLabel         string
+	DbaasFolder           bool
+	Workers               int
+	MaxRetries            int
+	RetryBaseDelay        time.Duration
+	RetryMaxDelay         time.Duration
+	ResyncPeriod          time.Duration
+	DriftInterval         time.Duration
+	DriftCorrect          bool
+	Prune                 bool
+	PruneDryRun           bool
+	PruneInterval         time.Duration
+	FolderTemplate        string
+	NestedFolders         bool
+	PermissionsEnabled    bool
+	PermissionsStrict     bool
+	PermissionsMaxLevel   string
+	PermissionsPrincipals string
+	PermissionsState      string
+	DatasourceState       string
+	DashboardCRD          bool
+	DashboardURLPrefixes  string
+	DatasourceCRD         bool
+	FolderCRD             bool
+	Instance              string
+	CrossNamespaceSecrets bool
+	EnvVariablePrefix     string
+	SecretRefreshInterval time.Duration
+	GrafanaTimeout        time.Duration
+	GrafanaRetries        int
+	GrafanaRetryBackoff   time.Duration
+	GrafanaAuthFile       string
+	GrafanaAuthSecret     string
+	GrafanaAuthProxyUser  string
+	GrafanaProxyHeader    string
+	GrafanaOrgID          uint
 }
 
 // Implements an grafanaConfig's controller loop in a particular namespace.
@@ -66,6 +113,73 @@ type grafanaConfigController struct {
 	// The namespace where the operator is running.
 	namespace string
 
+	// Rate limited queue of ConfigMap keys waiting to be processed.
+	queue workqueue.RateLimitingInterface
+
+	// Set to 1 once the initial list of ConfigMaps is cached, ConfigMaps
+	// added before are applied by reconcileAll. Handlers must not ask the
+	// informer whether it has synced, they are called with its queue locked.
+	initialSynced int32
+
+	// Last known state of deleted ConfigMaps, kept until the deletion has
+	// been applied to grafana.
+	tombstones     map[string]*corev1.ConfigMap
+	tombstonesLock sync.Mutex
+
+	// State of each ConfigMap as it was last applied to grafana.
+	lastApplied     map[string]*corev1.ConfigMap
+	lastAppliedLock sync.Mutex
+
+	// Number of drifted objects by kind of the ConfigMaps queued for
+	// correction, counted as corrected once they are applied again.
+	pendingDrift     map[string]map[string]int
+	pendingDriftLock sync.Mutex
+
+	// Permissions applied for each ConfigMap by annotation, persisted in the
+	// state ConfigMap of the operator
+	appliedPermissions     map[string]map[string]string
+	appliedPermissionsLock sync.Mutex
+
+	// Highest permission and principals ConfigMaps may grant
+	permissionsMaxLevel   grafana.PermissionType
+	permissionsPrincipals []string
+
+	// Template for the names of dashboard folders
+	folderTemplate *template.Template
+
+	// REST client for the custom resources of the operator
+	crdClient *client.GrafanaV1alpha1Client
+
+	// Rate limited queues of custom resource keys waiting to be processed.
+	dashboardQueue  workqueue.RateLimitingInterface
+	datasourceQueue workqueue.RateLimitingInterface
+	folderQueue     workqueue.RateLimitingInterface
+
+	// Last known state of deleted custom resources, kept until the deletion
+	// has been applied to grafana.
+	deletedDashboards  map[string]*v1alpha1.GrafanaDashboard
+	deletedDatasources map[string]*v1alpha1.GrafanaDatasource
+	deletedObjectsLock sync.Mutex
+
+	// Hashes of the datasource secrets last written to grafana by organization
+	// and uid or name
+	secretHashes     map[string]string
+	secretHashesLock sync.Mutex
+
+	// Secrets referenced by GrafanaDatasources by namespace/name, nil if the
+	// Secret does not exist
+	secretCache     map[string]*corev1.Secret
+	secretCacheLock sync.Mutex
+
+	// Credentials for the grafana API, swapped when their file or Secret
+	// changes
+	credentials     grafana.Credentials
+	credentialsLock sync.RWMutex
+
+	// Cancels the pending grafana requests once the controller is stopped
+	ctx    context.Context
+	cancel context.CancelFunc
+
 	options *GrafanaControllerOptions
 }
 
@@ -75,6 +189,30 @@ type grafanaConfigControllerInformer struct {
 	// Store & controller for ConfigMap resources
 	configmapStore      cache.Store
 	configmapController cache.Controller
+
+	// Store & controller for Namespace resources, only used if namespace
+	// metadata is required
+	namespaceStore      cache.Store
+	namespaceController cache.Controller
+
+	// Store & controller for GrafanaDashboard resources, only used if
+	// enabled
+	dashboardStore      cache.Store
+	dashboardController cache.Controller
+
+	// Store & controller for GrafanaDatasource resources, only used if
+	// enabled
+	datasourceStore      cache.Store
+	datasourceController cache.Controller
+
+	// Store & controller for GrafanaFolder resources, only used if enabled
+	folderStore      cache.Store
+	folderController cache.Controller
+
+	// Store & controller for the Secret with the grafana credentials, only
+	// used if configured
+	credentialsStore      cache.Store
+	credentialsController cache.Controller
 }
 
 // Create a new Controller for the grafanaConfig operator
@@ -94,12 +232,71 @@ func NewgrafanaConfigController(options *GrafanaControllerOptions) (
 		return nil, err
 	}
 
+	folderTemplate, err := parseFolderTemplate(options.FolderTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid folder template: %v", err)
+	}
+
 	// Create a new k8s REST API client for grafanaConfigs
+	crdClient, err := client.NewForConfig(kubecfg)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create new grafanaConfigController
 	npc := &grafanaConfigController{
-		kubecfg:   kubecfg,
-		clientSet: clientSet,
-		options:   options,
+		kubecfg:            kubecfg,
+		clientSet:          clientSet,
+		namespace:          options.Namespace,
+		queue:              workqueue.NewNamedRateLimitingQueue(newRateLimiter(options), "configmaps"),
+		tombstones:         make(map[string]*corev1.ConfigMap),
+		lastApplied:        make(map[string]*corev1.ConfigMap),
+		pendingDrift:       make(map[string]map[string]int),
+		appliedPermissions: make(map[string]map[string]string),
+		folderTemplate:     folderTemplate,
+		crdClient:          crdClient,
+		dashboardQueue:     workqueue.NewNamedRateLimitingQueue(newRateLimiter(options), "grafanadashboards"),
+		deletedDashboards:  make(map[string]*v1alpha1.GrafanaDashboard),
+		datasourceQueue:    workqueue.NewNamedRateLimitingQueue(newRateLimiter(options), "grafanadatasources"),
+		deletedDatasources: make(map[string]*v1alpha1.GrafanaDatasource),
+		secretHashes:       make(map[string]string),
+		secretCache:        make(map[string]*corev1.Secret),
+		folderQueue:        workqueue.NewNamedRateLimitingQueue(newRateLimiter(options), "grafanafolders"),
+		options:            options,
+	}
+
+	npc.ctx, npc.cancel = context.WithCancel(context.Background())
+
+	npc.credentials = grafana.ParseCredentials(options.GrafanaAuth)
+	if options.GrafanaAuthFile != "" {
+		if npc.credentials, err = readCredentialsFile(options.GrafanaAuthFile); err != nil {
+			return nil, fmt.Errorf("failed to read grafana credentials: %v", err)
+		}
+	}
+	if options.GrafanaAuthSecret != "" {
+		if _, _, err := npc.credentialsSecretRef(); err != nil {
+			return nil, err
+		}
+	}
+	if options.PermissionsEnabled {
+		if npc.permissionsMaxLevel, err = grafana.ParsePermissionType(options.PermissionsMaxLevel); err != nil {
+			return nil, fmt.Errorf("invalid highest permission: %v", err)
+		}
+		if npc.permissionsPrincipals, err = parsePrincipalPatterns(options.PermissionsPrincipals); err != nil {
+			return nil, err
+		}
+		if options.PermissionsState != "" {
+			if _, _, err := npc.permissionsStateRef(); err != nil {
+				return nil, err
+			}
+		} else if !options.PermissionsStrict {
+			glog.Warningf("No state Config Map for permissions given, permissions applied before a restart are not revoked")
+		}
+	}
+	if options.DatasourceState != "" {
+		if _, _, err := stateConfigMapRef(options.DatasourceState, npc.namespace); err != nil {
+			return nil, err
+		}
 	}
 
 	// Create a new Informer for the grafanaConfigController
@@ -108,10 +305,28 @@ func NewgrafanaConfigController(options *GrafanaControllerOptions) (
 	return npc, nil
 }
 
+// Create a client for the grafana API with the configured timeout and retries
+func (npc *grafanaConfigController) grafanaClient() *grafana.Client {
+	grafanaClient := grafana.NewClientWithCredentials(npc.options.GrafanaEndpoint, npc.getCredentials(), grafana.DefaultHTTPClient).
+		WithContext(npc.ctx).
+		WithTimeout(npc.options.GrafanaTimeout).
+		WithRetries(npc.options.GrafanaRetries, npc.options.GrafanaRetryBackoff)
+	if npc.options.GrafanaAuthProxyUser != "" {
+		grafanaClient = grafanaClient.WithAuthProxy(npc.options.GrafanaProxyHeader, npc.options.GrafanaAuthProxyUser)
+	}
+	return grafanaClient.WithOrgID(npc.options.GrafanaOrgID)
+}
+
 // Start the grafanaConfigController until stopped.
 func (npc *grafanaConfigController) Start(stop <-chan struct{}) {
 	// Don't let panics crash the process
 	defer utilruntime.HandleCrash()
+	// Let the workers finish once stopped
+	defer npc.queue.ShutDown()
+	defer npc.dashboardQueue.ShutDown()
+	defer npc.datasourceQueue.ShutDown()
+	defer npc.folderQueue.ShutDown()
+	defer npc.cancel()
 
 	npc.start(stop)
 
@@ -126,21 +341,202 @@ func (npc *grafanaConfigController) start(stop <-chan struct{}) {
 		namespace = "<any>"
 	}
 
-	watched := ""
-	if npc.options.DashboardLabel != "" {
-		watched = watched + npc.options.DashboardLabel
+	glog.V(2).Infof("Start watching Namespace: %s for %s", namespace, strings.Join(npc.watchedLabels(), " and "))
+
+	// Run controller for ConfigMap Informer and handle events via callbacks
+	go npc.informer.configmapController.Run(stop)
+	synced := []cache.InformerSynced{npc.informer.configmapController.HasSynced}
+	if npc.informer.namespaceController != nil {
+		go npc.informer.namespaceController.Run(stop)
+		synced = append(synced, npc.informer.namespaceController.HasSynced)
+	}
+	if npc.informer.folderController != nil {
+		go npc.informer.folderController.Run(stop)
+		synced = append(synced, npc.informer.folderController.HasSynced)
+	}
+	if npc.informer.dashboardController != nil {
+		go npc.informer.dashboardController.Run(stop)
+		synced = append(synced, npc.informer.dashboardController.HasSynced)
+	}
+	if npc.informer.datasourceController != nil {
+		go npc.informer.datasourceController.Run(stop)
+		synced = append(synced, npc.informer.datasourceController.HasSynced)
+	}
+
+	if npc.informer.credentialsController != nil {
+		go npc.informer.credentialsController.Run(stop)
+		synced = append(synced, npc.informer.credentialsController.HasSynced)
+	}
+	if npc.options.GrafanaAuthFile != "" {
+		go npc.watchCredentialsFile(stop)
+	}
+
+	// Wait for the initial list to be cached before reconciling everything
+	// that already exists in the cluster
+	if !cache.WaitForCacheSync(stop, synced...) {
+		glog.Errorf("Timed out waiting for ConfigMap cache to sync")
+		return
+	}
+	if npc.options.PermissionsEnabled && npc.options.PermissionsState != "" {
+		if err := npc.loadAppliedPermissions(); err != nil {
+			glog.Errorf("Failed to load the applied permissions from %s (%v)", npc.options.PermissionsState, err)
+			raven.CaptureError(err, map[string]string{"operation": "loadAppliedPermissions", "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+		}
 	}
-	if npc.options.DatasourceLabel != "" {
-		if watched != "" {
-			watched = watched + " and "
+	if npc.options.DatasourceState != "" {
+		if err := npc.loadSecretHashes(); err != nil {
+			glog.Errorf("Failed to load the secret hashes from %s (%v)", npc.options.DatasourceState, err)
+			raven.CaptureError(err, map[string]string{"operation": "loadSecretHashes", "GrafanaEndpoint": npc.options.GrafanaEndpoint})
 		}
-		watched = watched + npc.options.DatasourceLabel
 	}
-	glog.V(2).Infof("Start watching Namespace: %s for %s", namespace, watched)
 
-	// Run controller for ConfigMap Informer and handle events via callbacks
-	go npc.informer.configmapController.Run(stop)
+	// ConfigMaps added from now on are queued and applied by the workers
+	// started after reconcileAll, the workqueue removes duplicates
+	atomic.StoreInt32(&npc.initialSynced, 1)
+	npc.reconcileAll()
+
+	workers := npc.options.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	glog.V(2).Infof("Starting %d workers", workers)
+	for i := 0; i < workers; i++ {
+		go wait.Until(npc.runWorker, time.Second, stop)
+	}
+	if npc.informer.folderController != nil {
+		for i := 0; i < workers; i++ {
+			go wait.Until(npc.runFolderWorker, time.Second, stop)
+		}
+	}
+	if npc.informer.dashboardController != nil {
+		for i := 0; i < workers; i++ {
+			go wait.Until(npc.runDashboardWorker, time.Second, stop)
+		}
+	}
+	if npc.informer.datasourceController != nil {
+		for i := 0; i < workers; i++ {
+			go wait.Until(npc.runDatasourceWorker, time.Second, stop)
+		}
+	}
+
+	if npc.informer.datasourceController != nil && npc.cachesSecrets() {
+		go wait.Until(npc.refreshSecrets, npc.options.SecretRefreshInterval, stop)
+	}
 
+	if npc.options.DriftInterval > 0 {
+		glog.V(2).Infof("Checking for drift every %s (correct: %t)", npc.options.DriftInterval, npc.options.DriftCorrect)
+		go wait.Until(npc.detectDrift, npc.options.DriftInterval, stop)
+	}
+
+	if npc.options.Prune {
+		if npc.options.PruneInterval > 0 {
+			go wait.Until(npc.prune, npc.options.PruneInterval, stop)
+		} else {
+			go npc.prune()
+		}
+	}
+}
+
+// Apply every watched ConfigMap that is currently known to the informer. Objects
+// are applied in dependency order: datasources and notification channels first,
+// then the folders, the dashboards and finally the alerting objects whose rules
+// may refer to all of them. ConfigMaps that failed are handed over to the
+// workqueue for retries.
+func (npc *grafanaConfigController) reconcileAll() {
+	configMaps := []*corev1.ConfigMap{}
+	for _, obj := range npc.informer.configmapStore.List() {
+		configMap, ok := obj.(*corev1.ConfigMap)
+		if !ok || !npc.isWatchedLabel(configMap) {
+			continue
+		}
+		configMaps = append(configMaps, configMap)
+	}
+	sort.Slice(configMaps, func(i, j int) bool {
+		if configMaps[i].Namespace != configMaps[j].Namespace {
+			return configMaps[i].Namespace < configMaps[j].Namespace
+		}
+		return configMaps[i].Name < configMaps[j].Name
+	})
+	glog.V(2).Infof("Reconciling %d existing Config Maps", len(configMaps))
+
+	entries := make(map[*corev1.ConfigMap][]configMapEntry, len(configMaps))
+	for _, configMap := range configMaps {
+		entries[configMap], _ = npc.parseConfigMap(configMap)
+	}
+	failed := make(map[*corev1.ConfigMap]bool)
+
+	// Datasources
+	for _, configMap := range configMaps {
+		for _, entry := range entries[configMap] {
+			if entry.datasources != nil {
+				if err := npc.processDatasourceConfigMap(configMap, entry.file, entry.datasources, false); err != nil {
+					failed[configMap] = true
+				}
+			}
+		}
+	}
+
+	// Notification channels
+	for _, configMap := range configMaps {
+		for _, entry := range entries[configMap] {
+			if entry.notifiers != nil {
+				if err := npc.processNotifierConfigMap(configMap, entry.file, entry.notifiers, false); err != nil {
+					failed[configMap] = true
+				}
+			}
+		}
+	}
+
+	// Folders
+	folderIDs := make(map[*grafana.Board]uint)
+	for _, configMap := range configMaps {
+		for _, entry := range entries[configMap] {
+			if entry.board == nil {
+				continue
+			}
+			folderID, err := npc.ensureDashboardFolder(configMap, entry.file, entry.board)
+			if err != nil {
+				failed[configMap] = true
+				continue
+			}
+			folderIDs[entry.board] = folderID
+		}
+	}
+
+	// Dashboards
+	for _, configMap := range configMaps {
+		for _, entry := range entries[configMap] {
+			if entry.board == nil {
+				continue
+			}
+			if folderID, ok := folderIDs[entry.board]; ok {
+				if err := npc.applyDashboard(configMap, entry.file, entry.board, folderID); err != nil {
+					failed[configMap] = true
+				}
+			}
+		}
+	}
+
+	// Alerting
+	for _, configMap := range configMaps {
+		for _, entry := range entries[configMap] {
+			if entry.alerting != nil {
+				if err := npc.processAlertingConfigMap(configMap, entry.file, entry.alerting, false); err != nil {
+					failed[configMap] = true
+				}
+			}
+		}
+	}
+
+	for _, configMap := range configMaps {
+		if failed[configMap] {
+			npc.enqueueRateLimited(configMap)
+		} else {
+			npc.setLastApplied(configMap)
+			npc.recordAppliedPermissions(configMap)
+		}
+	}
+	glog.V(2).Infof("Finished reconciling %d existing Config Maps (%d failed)", len(configMaps), len(failed))
 }
 
 // Informers are a combination of a local cache store to buffer the state of a
@@ -155,10 +551,28 @@ func (npc *grafanaConfigController) start(stop <-chan struct{}) {
 func (npc *grafanaConfigController) newGrafanaConfigControllerInformer() *grafanaConfigControllerInformer {
 	configMapStore, configMapController := npc.newConfigMapInformer()
 
-	return &grafanaConfigControllerInformer{
+	informer := &grafanaConfigControllerInformer{
 		configmapStore:      configMapStore,
 		configmapController: configMapController,
 	}
+	if npc.needsNamespaces() {
+		informer.namespaceStore, informer.namespaceController = npc.newNamespaceInformer()
+	}
+	if npc.options.FolderCRD {
+		informer.folderStore, informer.folderController = npc.newFolderInformer()
+	}
+	if npc.options.DashboardCRD {
+		informer.dashboardStore, informer.dashboardController = npc.newDashboardInformer()
+	}
+	if npc.options.DatasourceCRD {
+		informer.datasourceStore, informer.datasourceController = npc.newDatasourceInformer()
+	}
+	if npc.options.GrafanaAuthSecret != "" {
+		// the reference was validated when the controller was created
+		namespace, name, _ := npc.credentialsSecretRef()
+		informer.credentialsStore, informer.credentialsController = npc.newCredentialsInformer(namespace, name)
+	}
+	return informer
 }
 
 // Create a new Informer on the ConfigMap resources in the cluster to track them.
@@ -166,10 +580,8 @@ func (npc *grafanaConfigController) newConfigMapInformer() (cache.Store, cache.C
 	var timeout int64
 	timeout = 30
 	filter := ""
-	if (npc.options.DashboardLabel != "") && (npc.options.DatasourceLabel == "") {
-		filter = npc.options.DashboardLabel
-	} else if (npc.options.DatasourceLabel != "") && (npc.options.DatasourceLabel == "") {
-		filter = npc.options.DatasourceLabel
+	if labels := npc.watchedLabels(); len(labels) == 1 {
+		filter = labels[0]
 	}
 
 	return cache.NewInformer(
@@ -194,31 +606,66 @@ func (npc *grafanaConfigController) newConfigMapInformer() (cache.Store, cache.C
 		// The resource that the informer returns
 		&corev1.ConfigMap{},
 		// The sync interval of the informer
-		0*time.Second,
+		npc.options.ResyncPeriod,
 		// Callback functions for add, delete & update events
 		cache.ResourceEventHandlerFuncs{
-			// AddFunc: func(o interface{}) {}
+			AddFunc:    npc.handleConfigMapAdd,
 			UpdateFunc: npc.handleConfigMapUpdate,
 			DeleteFunc: npc.handleConfigMapDelete,
 		},
 	)
 }
 
-func (npc *grafanaConfigController) isWatchedLabel(configMap *corev1.ConfigMap) bool {
-	if (npc.options.DashboardLabel != "") && utils.IsConfigMapLabeled(configMap, npc.options.DashboardLabel) {
-		return true
+// Labels of the ConfigMaps watched by the operator
+func (npc *grafanaConfigController) watchedLabels() []string {
+	labels := []string{}
+	for _, label := range []string{npc.options.DashboardLabel, npc.options.DatasourceLabel, npc.options.NotifierLabel, npc.options.AlertingLabel} {
+		if label != "" {
+			labels = append(labels, label)
+		}
 	}
-	if (npc.options.DatasourceLabel != "") && utils.IsConfigMapLabeled(configMap, npc.options.DatasourceLabel) {
-		return true
+	return labels
+}
+
+func (npc *grafanaConfigController) isWatchedLabel(configMap *corev1.ConfigMap) bool {
+	for _, label := range npc.watchedLabels() {
+		if utils.IsConfigMapLabeled(configMap, label) {
+			return true
+		}
 	}
 	return false
 }
 
-func (npc *grafanaConfigController) handleConfigMapDelete(obj interface{}) {
+// Callback for ConfigMaps added to the informer
+func (npc *grafanaConfigController) handleConfigMapAdd(obj interface{}) {
 	configMap := obj.(*corev1.ConfigMap)
+	// ConfigMaps from the initial list are applied by reconcileAll
+	if atomic.LoadInt32(&npc.initialSynced) == 0 {
+		return
+	}
+	glog.V(11).Infof("Received add for ConfigMap: %s/%s", configMap.Namespace, configMap.Name)
+	if npc.isWatchedLabel(configMap) {
+		npc.enqueue(configMap)
+	} else {
+		glog.V(12).Infof("Skipping non grafana labeled ConfigMap: %s/%s", configMap.Namespace, configMap.Name)
+	}
+}
+
+func (npc *grafanaConfigController) handleConfigMapDelete(obj interface{}) {
+	configMap, ok := obj.(*corev1.ConfigMap)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			return
+		}
+		if configMap, ok = tombstone.Obj.(*corev1.ConfigMap); !ok {
+			return
+		}
+	}
 	glog.V(11).Infof("Received delete for ConfigMap: %s/%s", configMap.Namespace, configMap.Name)
 	if npc.isWatchedLabel(configMap) {
-		npc.processConfigMap(configMap, true)
+		npc.addTombstone(configMap)
+		npc.enqueue(configMap)
 	} else {
 		glog.V(12).Infof("Skipping non grafana labeled ConfigMap: %s/%s", configMap.Namespace, configMap.Name)
 	}
@@ -227,69 +674,190 @@ func (npc *grafanaConfigController) handleConfigMapDelete(obj interface{}) {
 // Callback for updates to a ConfigMap Informer
 func (npc *grafanaConfigController) handleConfigMapUpdate(oldObj, newObj interface{}) {
 	configMap := newObj.(*corev1.ConfigMap)
-	// oldConfigMap := oldObj.(*corev1.ConfigMap)
+	oldConfigMap := oldObj.(*corev1.ConfigMap)
 	glog.V(11).Infof("Received update for ConfigMap: %s/%s", configMap.Namespace, configMap.Name)
-	if npc.isWatchedLabel(configMap) {
-		npc.processConfigMap(configMap, false)
+	npc.enqueueDashboardsReferencing(configMap)
+	if npc.isWatchedLabel(oldConfigMap) {
+		// the base for deleting entries that were removed by this update
+		npc.initLastApplied(oldConfigMap)
+	}
+	if npc.isWatchedLabel(configMap) || npc.isWatchedLabel(oldConfigMap) {
+		npc.enqueue(configMap)
 	} else {
 		glog.V(12).Infof("Skipping non grafana labeled ConfigMap: %s/%s", configMap.Namespace, configMap.Name)
 	}
 }
 
-func (npc *grafanaConfigController) processConfigMap(configMap *corev1.ConfigMap, deleteMode bool) {
-	glog.V(3).Infof("Processing Config Map: %s/%s", configMap.Namespace, configMap.Name)
+// A single grafana configuration object found in a ConfigMap
+type configMapEntry struct {
+	file        string
+	datasources *grafana.DatasourceConfigFile
+	notifiers   *grafana.NotifierConfigFile
+	alerting    *grafana.AlertingConfigFile
+	board       *grafana.Board
+}
+
+// Parse all entries of a ConfigMap and return those matching the configured labels.
+// Entries that can not be parsed are skipped and reported by the returned error.
+func (npc *grafanaConfigController) parseConfigMap(configMap *corev1.ConfigMap) ([]configMapEntry, error) {
+	entries := []configMapEntry{}
+	errs := []error{}
 	for file, content := range configMap.Data {
-		// yaml or json? DataSource or Dashboard?
-		ds, board, err := grafana.GetGrafanaConfigObjectFromString(content)
+		// yaml or json? DataSource, Dashboard, Notifiers or Alerting?
+		documents, err := grafana.ParseConfigDocuments(file, content)
 		if err != nil {
-			glog.Errorf("Failed to unmarshall grafana configuration object from Config Map: %s/%s %s (%#v)", configMap.Namespace, configMap.Name, file, err)
-			raven.CaptureError(err, map[string]string{"operation": "GetGrafanaConfigObjectFromString", "ConfigMap.Namespace": configMap.Namespace, "CopnfigMap.Name": configMap.Name, "ConfigMap.File": file, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+			glog.Errorf("Failed to unmarshall grafana configuration object from Config Map: %s/%s %s (%v)", configMap.Namespace, configMap.Name, file, err)
+			raven.CaptureError(err, map[string]string{"operation": "ParseConfigDocuments", "ConfigMap.Namespace": configMap.Namespace, "ConfigMap.Name": configMap.Name, "ConfigMap.File": file, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+			errs = append(errs, fmt.Errorf("%s: %v", file, err))
 			continue
 		}
+		for _, document := range documents {
+			if entry, ok := npc.newConfigMapEntry(configMap, file, document); ok {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	return entries, utilerrors.NewAggregate(errs)
+}
 
-		if ds != nil {
-			if npc.options.DatasourceLabel == "" {
-				glog.Errorf("Datasource found, but DatasourceLabel not confgured. Config Map: %s/%s %s", configMap.Namespace, configMap.Name, file)
-				continue
-			} else if !utils.IsConfigMapLabeled(configMap, npc.options.DatasourceLabel) {
-				glog.Errorf("Datasource found, but not with configured label  (%s). Config Map: %s/%s %s", npc.options.DatasourceLabel, configMap.Namespace, configMap.Name, file)
-				continue
-			} else {
-				if ds.ApiVersion != 1 {
-					glog.Errorf("Unsupported API Version %d Config Map: %s/%s %s", ds.ApiVersion, configMap.Namespace, configMap.Name, file)
-					continue
-				}
-				npc.processDatasourceConfigMap(configMap, file, ds, deleteMode)
+// Check a parsed document against the configured labels and prepare it for
+// being applied. Returns false if the document is not handled.
+func (npc *grafanaConfigController) newConfigMapEntry(configMap *corev1.ConfigMap, file string, document grafana.ConfigDocument) (configMapEntry, bool) {
+	switch document.Kind {
+	case grafana.NotifierDocument:
+		if npc.options.NotifierLabel == "" {
+			glog.Errorf("Notifiers found, but NotifierLabel not confgured. Config Map: %s/%s %s", configMap.Namespace, configMap.Name, file)
+			return configMapEntry{}, false
+		} else if !utils.IsConfigMapLabeled(configMap, npc.options.NotifierLabel) {
+			glog.Errorf("Notifiers found, but not with configured label (%s). Config Map: %s/%s %s", npc.options.NotifierLabel, configMap.Namespace, configMap.Name, file)
+			return configMapEntry{}, false
+		}
+		return configMapEntry{file: file, notifiers: document.Notifiers}, true
+
+	case grafana.AlertingDocument:
+		alerting := document.Alerting
+		if npc.options.AlertingLabel == "" {
+			glog.Errorf("Alerting found, but AlertingLabel not confgured. Config Map: %s/%s %s", configMap.Namespace, configMap.Name, file)
+			return configMapEntry{}, false
+		} else if !utils.IsConfigMapLabeled(configMap, npc.options.AlertingLabel) {
+			glog.Errorf("Alerting found, but not with configured label (%s). Config Map: %s/%s %s", npc.options.AlertingLabel, configMap.Namespace, configMap.Name, file)
+			return configMapEntry{}, false
+		} else if alerting.ApiVersion != 1 {
+			glog.Errorf("Unsupported API Version %d Config Map: %s/%s %s", alerting.ApiVersion, configMap.Namespace, configMap.Name, file)
+			return configMapEntry{}, false
+		}
+		return configMapEntry{file: file, alerting: alerting}, true
+
+	case grafana.DatasourceDocument:
+		ds := document.Datasources
+		if npc.options.DatasourceLabel == "" {
+			glog.Errorf("Datasource found, but DatasourceLabel not confgured. Config Map: %s/%s %s", configMap.Namespace, configMap.Name, file)
+			return configMapEntry{}, false
+		} else if !utils.IsConfigMapLabeled(configMap, npc.options.DatasourceLabel) {
+			glog.Errorf("Datasource found, but not with configured label  (%s). Config Map: %s/%s %s", npc.options.DatasourceLabel, configMap.Namespace, configMap.Name, file)
+			return configMapEntry{}, false
+		} else if ds.ApiVersion != 1 {
+			glog.Errorf("Unsupported API Version %d Config Map: %s/%s %s", ds.ApiVersion, configMap.Namespace, configMap.Name, file)
+			return configMapEntry{}, false
+		}
+		if npc.isPrunable(configMap) {
+			for i := range ds.Datasources {
+				ds.Datasources[i].SetJSONDataValue(ownerJSONDataKey, ownerName)
 			}
 		}
-		if board != nil {
-			if npc.options.DashboardLabel == "" {
-				glog.Errorf("Dashboard found, but DashboardLabel not confgured. Config Map: %s/%s %s", configMap.Namespace, configMap.Name, file)
-				continue
-			} else if !utils.IsConfigMapLabeled(configMap, npc.options.DashboardLabel) {
-				glog.Errorf("Dashboard found, but as with configured label (%s). Config Map: %s/%s %s", npc.options.DashboardLabel, configMap.Namespace, configMap.Name, file)
-				continue
+		return configMapEntry{file: file, datasources: ds}, true
+
+	case grafana.DashboardDocument:
+		board := document.Board
+		if npc.options.DashboardLabel == "" {
+			glog.Errorf("Dashboard found, but DashboardLabel not confgured. Config Map: %s/%s %s", configMap.Namespace, configMap.Name, file)
+			return configMapEntry{}, false
+		} else if !utils.IsConfigMapLabeled(configMap, npc.options.DashboardLabel) {
+			glog.Errorf("Dashboard found, but as with configured label (%s). Config Map: %s/%s %s", npc.options.DashboardLabel, configMap.Namespace, configMap.Name, file)
+			return configMapEntry{}, false
+		}
+		if npc.isPrunable(configMap) {
+			board.AddTags(ownerTag)
+		}
+		return configMapEntry{file: file, board: board}, true
+	}
+	return configMapEntry{}, false
+}
+
+// Apply or delete all grafana objects of a ConfigMap. Entries that can not be
+// parsed are logged and skipped, all other failures are returned so the
+// ConfigMap can be retried.
+func (npc *grafanaConfigController) processConfigMap(configMap *corev1.ConfigMap, deleteMode bool) error {
+	glog.V(3).Infof("Processing Config Map: %s/%s", configMap.Namespace, configMap.Name)
+	errs := []error{}
+	entries, _ := npc.parseConfigMap(configMap)
+	for _, entry := range entries {
+		if entry.datasources != nil {
+			if err := npc.processDatasourceConfigMap(configMap, entry.file, entry.datasources, deleteMode); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if entry.notifiers != nil {
+			if err := npc.processNotifierConfigMap(configMap, entry.file, entry.notifiers, deleteMode); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if entry.alerting != nil {
+			if err := npc.processAlertingConfigMap(configMap, entry.file, entry.alerting, deleteMode); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if entry.board != nil {
+			var err error
+			if deleteMode {
+				err = npc.deleteDashboardConfigMap(configMap, entry.file, entry.board)
 			} else {
-				if deleteMode {
-					npc.deleteDashboardConfigMap(configMap, file, board)
-				} else {
-					npc.processDashboardConfigMap(configMap, file, board)
-				}
+				err = npc.processDashboardConfigMap(configMap, entry.file, entry.board)
+			}
+			if err != nil {
+				errs = append(errs, err)
 			}
 		}
-
 	}
+	return utilerrors.NewAggregate(errs)
 }
 
-func (npc *grafanaConfigController) processDatasourceConfigMap(configMap *corev1.ConfigMap, file string, config *grafana.DatasourceConfigFile, deleteMode bool) {
+func (npc *grafanaConfigController) processDatasourceConfigMap(configMap *corev1.ConfigMap, file string, config *grafana.DatasourceConfigFile, deleteMode bool) error {
 	if deleteMode {
 		glog.V(2).Infof("Handling Delete Datasource Config Map in namespace %s/%s", configMap.Namespace, configMap.Name)
 	} else {
 		glog.V(2).Infof("Handling Update Datasource Config Map: %s/%s", configMap.Namespace, configMap.Name)
 	}
 	// via API
-	grafanaClient := grafana.NewClient(npc.options.GrafanaEndpoint, npc.options.GrafanaAuth, grafana.DefaultHTTPClient)
+	grafanaClient := npc.grafanaClient()
+	errs := []error{}
+
+	// datasources of other organizations than the one of the client are skipped
+	currentOrgID := uint(0)
+	inClientOrg := func(name string, orgID uint) bool {
+		if orgID == 0 {
+			return true
+		}
+		if currentOrgID == 0 {
+			org, err := grafanaClient.GetCurrentOrg()
+			if err != nil {
+				glog.Errorf("Failed to get the current organization for Config Map: %s/%s %s (%#v)", configMap.Namespace, configMap.Name, file, err)
+				errs = append(errs, err)
+				return false
+			}
+			currentOrgID = org.ID
+		}
+		if orgID != currentOrgID {
+			glog.V(2).Infof("Skipping Datasource %s of organization %d from Config Map: %s/%s %s, the operator acts in organization %d", name, orgID, configMap.Namespace, configMap.Name, file, currentOrgID)
+			return false
+		}
+		return true
+	}
+
 	for _, datasourceToDelete := range config.DeleteDatasources {
+		if !inClientOrg(datasourceToDelete.Name, datasourceToDelete.OrgID) {
+			continue
+		}
 		existingDs, err := grafanaClient.GetDatasourceByName(datasourceToDelete.Name)
 		if err != nil {
 			glog.V(4).Infof("Datasource %s from Config Map: %s/%s %s does not exist info ", datasourceToDelete.Name, configMap.Namespace, configMap.Name, file)
@@ -297,119 +865,243 @@ func (npc *grafanaConfigController) processDatasourceConfigMap(configMap *corev1
 			_, err := grafanaClient.DeleteDatasource(existingDs.ID)
 			if err != nil {
 				glog.Errorf("Failed to unmarshall datasource info from Config Map: %s/%s %s (%#v)", configMap.Namespace, configMap.Name, file, err)
-				raven.CaptureError(err, map[string]string{"operation": "DeleteDatasource", "ConfigMap.Namespace": configMap.Namespace, "CopnfigMap.Name": configMap.Name, "ConfigMap.File": file, "DataSource.Name": datasourceToDelete.Name, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+				raven.CaptureError(err, map[string]string{"operation": "DeleteDatasource", "ConfigMap.Namespace": configMap.Namespace, "ConfigMap.Name": configMap.Name, "ConfigMap.File": file, "DataSource.Name": datasourceToDelete.Name, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+				errs = append(errs, err)
 			} else {
 				glog.V(1).Infof("Deleted Datasource %s from Config Map: %s/%s %s", datasourceToDelete.Name, configMap.Namespace, configMap.Name, file)
-				raven.Capture(&raven.Packet{Level: raven.INFO, Message: "Deleted Data Source"}, map[string]string{"operation": "DeleteDatasource", "ConfigMap.Namespace": configMap.Namespace, "CopnfigMap.Name": configMap.Name, "ConfigMap.File": file, "DataSource.Name": datasourceToDelete.Name, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+				npc.setSecretsHash(grafana.Datasource{OrgID: datasourceToDelete.OrgID, UID: existingDs.UID, Name: datasourceToDelete.Name}, "")
+				raven.Capture(&raven.Packet{Level: raven.INFO, Message: "Deleted Data Source"}, map[string]string{"operation": "DeleteDatasource", "ConfigMap.Namespace": configMap.Namespace, "ConfigMap.Name": configMap.Name, "ConfigMap.File": file, "DataSource.Name": datasourceToDelete.Name, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
 			}
 		}
 	}
 
 	for _, datasourceToEnsure := range config.Datasources {
-		existingDs, err := grafanaClient.GetDatasourceByName(datasourceToEnsure.Name)
-		if err != nil && err.Error() != "HTTP error 404: returns {\"message\":\"Data source not found\"}" {
+		if !inClientOrg(datasourceToEnsure.Name, datasourceToEnsure.OrgID) {
+			continue
+		}
+		if !deleteMode {
+			expanded, err := datasourceToEnsure.WithExpandedVariables(npc.variableLookup(configMap))
+			if err != nil {
+				glog.Errorf("Failed to interpolate datasource from Config Map: %s/%s %s (%v)", configMap.Namespace, configMap.Name, file, err)
+				raven.CaptureError(err, map[string]string{"operation": "WithExpandedVariables", "ConfigMap.Namespace": configMap.Namespace, "ConfigMap.Name": configMap.Name, "ConfigMap.File": file, "DataSource.Name": datasourceToEnsure.Name, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+				errs = append(errs, err)
+				continue
+			}
+			datasourceToEnsure = expanded
+		}
+		existingDs, err := findDatasource(grafanaClient, datasourceToEnsure)
+		if err != nil {
 			glog.Errorf("Failed to check for existing datasource info from Config Map: %s/%s %s (%#v)", configMap.Namespace, configMap.Name, file, err)
-			raven.CaptureError(err, map[string]string{"operation": "GetDatasourceByName", "ConfigMap.Namespace": configMap.Namespace, "CopnfigMap.Name": configMap.Name, "ConfigMap.File": file, "DataSource.Name": datasourceToEnsure.Name, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+			raven.CaptureError(err, map[string]string{"operation": "GetDatasourceByName", "ConfigMap.Namespace": configMap.Namespace, "ConfigMap.Name": configMap.Name, "ConfigMap.File": file, "DataSource.Name": datasourceToEnsure.Name, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+			errs = append(errs, err)
 			continue
-		} else if existingDs.ID != 0 {
+		} else if existingDs != nil {
+			if existingDs.ReadOnly {
+				glog.Warningf("Datasource %s from Config Map: %s/%s %s is read only in grafana (provisioned from a file), leaving it untouched", datasourceToEnsure.Name, configMap.Namespace, configMap.Name, file)
+				continue
+			}
 			if deleteMode {
 				_, err := grafanaClient.DeleteDatasource(existingDs.ID)
 				if err != nil {
 					glog.Errorf("Failed to unmarshall datasource info from Config Map: %s/%s %s (%#v)", configMap.Namespace, configMap.Name, file, err)
-					raven.CaptureError(err, map[string]string{"operation": "DeleteDatasource", "ConfigMap.Namespace": configMap.Namespace, "CopnfigMap.Name": configMap.Name, "ConfigMap.File": file, "DataSource.Name": datasourceToEnsure.Name, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+					raven.CaptureError(err, map[string]string{"operation": "DeleteDatasource", "ConfigMap.Namespace": configMap.Namespace, "ConfigMap.Name": configMap.Name, "ConfigMap.File": file, "DataSource.Name": datasourceToEnsure.Name, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+					errs = append(errs, err)
 				} else {
 					glog.V(1).Infof("Deleted Datasource %s from Config Map: %s/%s %s", datasourceToEnsure.Name, configMap.Namespace, configMap.Name, file)
-					raven.Capture(&raven.Packet{Level: raven.INFO, Message: "Deleted Data Source"}, map[string]string{"operation": "DeleteDatasource", "ConfigMap.Namespace": configMap.Namespace, "CopnfigMap.Name": configMap.Name, "ConfigMap.File": file, "DataSource.Name": datasourceToEnsure.Name, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+					npc.setSecretsHash(grafana.Datasource{OrgID: datasourceToEnsure.OrgID, UID: existingDs.UID, Name: datasourceToEnsure.Name}, "")
+					raven.Capture(&raven.Packet{Level: raven.INFO, Message: "Deleted Data Source"}, map[string]string{"operation": "DeleteDatasource", "ConfigMap.Namespace": configMap.Namespace, "ConfigMap.Name": configMap.Name, "ConfigMap.File": file, "DataSource.Name": datasourceToEnsure.Name, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
 				}
 			} else {
 				glog.V(3).Infof("Datasource %s from Config Map: %s/%s %s already exists with id %d. Will Update....", datasourceToEnsure.Name, configMap.Namespace, configMap.Name, file, existingDs.ID)
-				datasourceToEnsure.ID = existingDs.ID
-				_, err = grafanaClient.UpdateDatasource(datasourceToEnsure)
+				var secretsHash string
+				datasourceToEnsure, secretsHash = npc.withoutAppliedSecrets(datasourceToEnsure, *existingDs)
+				if datasourceUnchanged(datasourceToEnsure, *existingDs) {
+					glog.V(3).Infof("Datasource %s from Config Map: %s/%s %s is unchanged, skipping update", datasourceToEnsure.Name, configMap.Namespace, configMap.Name, file)
+					writesTotal.WithLabelValues(writeKindDatasource, writeResultSkipped).Inc()
+					continue
+				}
+				_, err = grafanaClient.UpdateDatasource(grafana.MergeDatasource(datasourceToEnsure, *existingDs))
 				if err != nil {
 					glog.Errorf("Failed to Update datasource info from Config Map: %s/%s %s (%#v)", configMap.Namespace, configMap.Name, file, err)
-					raven.CaptureError(err, map[string]string{"operation": "CreateDatasource", "ConfigMap.Namespace": configMap.Namespace, "CopnfigMap.Name": configMap.Name, "ConfigMap.File": file, "DataSource.Name": datasourceToEnsure.Name, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+					raven.CaptureError(err, map[string]string{"operation": "CreateDatasource", "ConfigMap.Namespace": configMap.Namespace, "ConfigMap.Name": configMap.Name, "ConfigMap.File": file, "DataSource.Name": datasourceToEnsure.Name, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+					errs = append(errs, err)
 				} else {
 					glog.V(1).Infof("Updated Datasource %s from Config Map: %s/%s %s", datasourceToEnsure.Name, configMap.Namespace, configMap.Name, file)
-					raven.Capture(&raven.Packet{Level: raven.INFO, Message: "Created Data Source"}, map[string]string{"operation": "CreateDatasource", "ConfigMap.Namespace": configMap.Namespace, "CopnfigMap.Name": configMap.Name, "ConfigMap.File": file, "DataSource.Name": datasourceToEnsure.Name, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+					writesTotal.WithLabelValues(writeKindDatasource, writeResultApplied).Inc()
+					npc.setSecretsHash(datasourceToEnsure, secretsHash)
+					raven.Capture(&raven.Packet{Level: raven.INFO, Message: "Created Data Source"}, map[string]string{"operation": "CreateDatasource", "ConfigMap.Namespace": configMap.Namespace, "ConfigMap.Name": configMap.Name, "ConfigMap.File": file, "DataSource.Name": datasourceToEnsure.Name, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
 				}
 			}
-		} else {
+		} else if !deleteMode {
 			_, err = grafanaClient.CreateDatasource(datasourceToEnsure)
 			if err != nil {
 				glog.Errorf("Failed to create datasource info from Config Map: %s/%s %s (%#v)", configMap.Namespace, configMap.Name, file, err)
-				raven.CaptureError(err, map[string]string{"operation": "CreateDatasource", "ConfigMap.Namespace": configMap.Namespace, "CopnfigMap.Name": configMap.Name, "ConfigMap.File": file, "DataSource.Name": datasourceToEnsure.Name, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+				raven.CaptureError(err, map[string]string{"operation": "CreateDatasource", "ConfigMap.Namespace": configMap.Namespace, "ConfigMap.Name": configMap.Name, "ConfigMap.File": file, "DataSource.Name": datasourceToEnsure.Name, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+				errs = append(errs, err)
 			} else {
 				glog.V(1).Infof("Created Datasource %s from Config Map: %s/%s %s", datasourceToEnsure.Name, configMap.Namespace, configMap.Name, file)
-				raven.Capture(&raven.Packet{Level: raven.INFO, Message: "Created Data Source"}, map[string]string{"operation": "CreateDatasource", "ConfigMap.Namespace": configMap.Namespace, "CopnfigMap.Name": configMap.Name, "ConfigMap.File": file, "DataSource.Name": datasourceToEnsure.Name, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+				writesTotal.WithLabelValues(writeKindDatasource, writeResultApplied).Inc()
+				npc.setSecretsHash(datasourceToEnsure, datasourceToEnsure.SecretsHash())
+				raven.Capture(&raven.Packet{Level: raven.INFO, Message: "Created Data Source"}, map[string]string{"operation": "CreateDatasource", "ConfigMap.Namespace": configMap.Namespace, "ConfigMap.Name": configMap.Name, "ConfigMap.File": file, "DataSource.Name": datasourceToEnsure.Name, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
 			}
 		}
 	}
+	return utilerrors.NewAggregate(errs)
 }
 
-func (npc *grafanaConfigController) processDashboardConfigMap(configMap *corev1.ConfigMap, file string, board *grafana.Board) {
+// Find the existing datasource for a provisioned one, by its uid if it has
+// one and by its name otherwise. Returns nil if there is no such datasource.
+func findDatasource(grafanaClient *grafana.Client, ds grafana.Datasource) (*grafana.Datasource, error) {
+	if ds.UID != "" {
+		existing, err := grafanaClient.GetDatasourceByUID(ds.UID)
+		if err == nil {
+			return &existing, nil
+		}
+		if !grafana.IsNotFound(err) {
+			return nil, err
+		}
+	}
+	existing, err := grafanaClient.GetDatasourceByName(ds.Name)
+	if grafana.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+func (npc *grafanaConfigController) processDashboardConfigMap(configMap *corev1.ConfigMap, file string, board *grafana.Board) error {
 	glog.V(2).Infof("Handling Update Dashboard %s from Config Map: %s/%s", file, configMap.Namespace, configMap.Name)
 
-	grafanaClient := grafana.NewClient(npc.options.GrafanaEndpoint, npc.options.GrafanaAuth, grafana.DefaultHTTPClient)
+	folderID, err := npc.ensureDashboardFolder(configMap, file, board)
+	if err != nil {
+		return err
+	}
+	return npc.applyDashboard(configMap, file, board, folderID)
+}
 
-	folderID := uint(0) // General
+// Resolve the folder a dashboard belongs to and create it if it does not exist yet.
+func (npc *grafanaConfigController) ensureDashboardFolder(configMap *corev1.ConfigMap, file string, board *grafana.Board) (uint, error) {
+	if name := strings.TrimSpace(configMap.Annotations[folderRefAnnotation]); name != "" {
+		folder, err := npc.getGrafanaFolder(configMap.Namespace, name)
+		if err != nil {
+			glog.Warningf("Folder of Config Map: %s/%s %s is not available (%v)", configMap.Namespace, configMap.Name, file, err)
+			return 0, err
+		}
+		return folder.ID, nil
+	}
+	tags := map[string]string{"ConfigMap.Namespace": configMap.Namespace, "ConfigMap.Name": configMap.Name, "ConfigMap.File": file, "Board.Name": board.Title}
+	title, err := npc.dashboardFolderTitle(configMap, file)
+	if err != nil {
+		glog.Errorf("Failed to determine the folder of Dashboard %s from Config Map: %s/%s %s (%v)", board.Title, configMap.Namespace, configMap.Name, file, err)
+		raven.CaptureError(err, npc.ravenTags(tags, "dashboardFolderTitle"))
+		return 0, err
+	}
+	return npc.ensureFolderPath(npc.folderPath(title), annotatedFolderUID(configMap), tags)
+}
+
+// Look up the id of the folder a dashboard belongs in without creating it.
+// Returns false if the folder does not exist (yet).
+func (npc *grafanaConfigController) findDashboardFolder(grafanaClient *grafana.Client, configMap *corev1.ConfigMap, file string) (uint, bool, error) {
+	if name := strings.TrimSpace(configMap.Annotations[folderRefAnnotation]); name != "" {
+		folder, err := npc.getGrafanaFolder(configMap.Namespace, name)
+		if err != nil {
+			return 0, false, err
+		}
+		return folder.ID, true, nil
+	}
+	title, err := npc.dashboardFolderTitle(configMap, file)
+	if err != nil {
+		return 0, false, err
+	}
+	return findFolderPath(grafanaClient, npc.folderPath(title), annotatedFolderUID(configMap))
+}
+
+// Title of the folder a dashboard is placed in, or an empty string for the
+// General folder. The first of these wins:
+//   - the folder annotation of the ConfigMap
+//   - the operator's folder template
+//   - in dbaas folder mode the 'customergroup' label of the namespace
+//   - a key like 'folder.board.json' places the board in 'folder'
+//
+// An error is returned if the folder template can not be evaluated.
+func (npc *grafanaConfigController) dashboardFolderTitle(configMap *corev1.ConfigMap, file string) (string, error) {
+	if title := annotatedFolderTitle(configMap); title != "" {
+		return title, nil
+	}
+	title, err := npc.templatedFolderTitle(configMap, file)
+	if err != nil || title != "" {
+		return title, err
+	}
+	if npc.options.DbaasFolder {
+		if title := npc.customerGroupFolderTitle(configMap); title != "" {
+			return title, nil
+		}
+		glog.V(4).Infof("Namespace %s has no %s label, falling back to the folder of the key %s in Config Map %s", configMap.Namespace, customerGroupLabel, file, configMap.Name)
+	}
 
-	// is the board in a subfolder
 	path := strings.Split(file, ".")
 	if strings.ToLower(path[len(path)-1]) == "json" || strings.ToLower(path[len(path)-1]) == "js" {
 		path = path[:len(path)-1]
 	}
 	path = path[:len(path)-1]
 	if len(path) > 0 {
-		targetFolder, err := grafanaClient.GetFolderByTitle(path[0])
-		if err != nil {
-			glog.Errorf("Failed to check list folders (%#v)", err)
-			raven.CaptureError(err, map[string]string{"operation": "GetAllFolders", "ConfigMap.Namespace": configMap.Namespace, "CopnfigMap.Name": configMap.Name, "ConfigMap.File": file, "Board.Name": board.Title, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
-			return
-		}
-		if targetFolder == nil {
-			statusMessage, err := grafanaClient.CreateFolder(grafana.Folder{Title: path[0]})
-			if err != nil {
-				glog.Errorf("Failed to create folder (%#v)", err)
-				raven.CaptureError(err, map[string]string{"operation": "CreateFolder", "ConfigMap.Namespace": configMap.Namespace, "CopnfigMap.Name": configMap.Name, "ConfigMap.File": file, "Board.Name": board.Title, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
-				return
-			}
-			raven.Capture(&raven.Packet{Level: raven.INFO, Message: "Created new Folder"}, map[string]string{"operation": "CreateFolder", "ConfigMap.Namespace": configMap.Namespace, "CopnfigMap.Name": configMap.Name, "ConfigMap.File": file, "GrafanaEndpoint": npc.options.GrafanaEndpoint, "Folder.Name": path[0]})
-			folderID = *statusMessage.ID
-		} else {
-			folderID = targetFolder.ID
-		}
+		return path[0], nil
+	}
+	return "", nil
+}
+
+func (npc *grafanaConfigController) applyDashboard(configMap *corev1.ConfigMap, file string, board *grafana.Board, folderID uint) error {
+	grafanaClient := npc.grafanaClient()
+
+	if dashboardID, unchanged := dashboardUnchanged(grafanaClient, board, folderID); unchanged {
+		glog.V(3).Infof("Dashboard %s from Config Map: %s/%s %s is unchanged, skipping update", board.Title, configMap.Namespace, configMap.Name, file)
+		writesTotal.WithLabelValues(writeKindDashboard, writeResultSkipped).Inc()
+		return npc.applyPermissions(configMap, file, board, folderID, dashboardID)
 	}
 
-	err := grafanaClient.SetDashboard(*board, true, folderID)
+	statusMessage, err := grafanaClient.SaveDashboard(*board, true, folderID)
 	if err != nil {
 		glog.Errorf("Failed to check for existing dashboard info from Config Map: %s/%s %s (%#v)", configMap.Namespace, configMap.Name, file, err)
-		raven.CaptureError(err, map[string]string{"operation": "GetDashboardByName", "ConfigMap.Namespace": configMap.Namespace, "CopnfigMap.Name": configMap.Name, "ConfigMap.File": file, "Board.Name": board.Title, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
-		return
+		raven.CaptureError(err, map[string]string{"operation": "GetDashboardByName", "ConfigMap.Namespace": configMap.Namespace, "ConfigMap.Name": configMap.Name, "ConfigMap.File": file, "Board.Name": board.Title, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+		return err
 	}
 
 	glog.V(1).Infof("Created or Updated Dashboard %s from Config Map: %s/%s %s", board.Title, configMap.Namespace, configMap.Name, file)
-	raven.Capture(&raven.Packet{Level: raven.INFO, Message: "Created Dashboard"}, map[string]string{"operation": "CreateDashboard", "ConfigMap.Namespace": configMap.Namespace, "CopnfigMap.Name": configMap.Name, "ConfigMap.File": file, "Board.Name": board.Title, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+	writesTotal.WithLabelValues(writeKindDashboard, writeResultApplied).Inc()
+	raven.Capture(&raven.Packet{Level: raven.INFO, Message: "Created Dashboard"}, map[string]string{"operation": "CreateDashboard", "ConfigMap.Namespace": configMap.Namespace, "ConfigMap.Name": configMap.Name, "ConfigMap.File": file, "Board.Name": board.Title, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+
+	if statusMessage.ID == nil {
+		return nil
+	}
+	return npc.applyPermissions(configMap, file, board, folderID, *statusMessage.ID)
 }
 
-func (npc *grafanaConfigController) deleteDashboardConfigMap(configMap *corev1.ConfigMap, file string, board *grafana.Board) {
-	glog.V(2).Infof("Handling Delete Dashboard %s from Config Map: %s/%s %s", file, configMap.Namespace, configMap.Name)
+func (npc *grafanaConfigController) deleteDashboardConfigMap(configMap *corev1.ConfigMap, file string, board *grafana.Board) error {
+	glog.V(2).Infof("Handling Delete Dashboard %s from Config Map: %s/%s", file, configMap.Namespace, configMap.Name)
 
-	grafanaClient := grafana.NewClient(npc.options.GrafanaEndpoint, npc.options.GrafanaAuth, grafana.DefaultHTTPClient)
+	grafanaClient := npc.grafanaClient()
 	if board.UID != "" {
 		_, _, err := grafanaClient.GetDashboard(board.UID)
+		if grafana.IsNotFound(err) {
+			glog.V(4).Infof("Dashboard %s from Config Map: %s/%s %s does not exist", board.UID, configMap.Namespace, configMap.Name, file)
+			return nil
+		}
 		if err != nil {
 			glog.Errorf("Failed to check for existing dashboard info from Config Map: %s/%s %s (%#v)", configMap.Namespace, configMap.Name, file, err)
-			raven.CaptureError(err, map[string]string{"operation": "GetDashboardBy", "ConfigMap.Namespace": configMap.Namespace, "CopnfigMap.Name": configMap.Name, "ConfigMap.File": file, "Board.Name": board.Title, "Board.UID": board.UID, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
-			return
+			raven.CaptureError(err, map[string]string{"operation": "GetDashboardBy", "ConfigMap.Namespace": configMap.Namespace, "ConfigMap.Name": configMap.Name, "ConfigMap.File": file, "Board.Name": board.Title, "Board.UID": board.UID, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+			return err
 		}
 		_, err = grafanaClient.DeleteDashboard(board.UID)
 		if err != nil {
 			glog.Errorf("Failed to Delete  existing dashboard info from Config Map: %s/%s %s (%#v)", configMap.Namespace, configMap.Name, file, err)
-			raven.CaptureError(err, map[string]string{"operation": "DeleteDashboard", "ConfigMap.Namespace": configMap.Namespace, "CopnfigMap.Name": configMap.Name, "ConfigMap.File": file, "Board.Name": board.Title, "Board.UID": board.UID, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
-			return
+			raven.CaptureError(err, map[string]string{"operation": "DeleteDashboard", "ConfigMap.Namespace": configMap.Namespace, "ConfigMap.Name": configMap.Name, "ConfigMap.File": file, "Board.Name": board.Title, "Board.UID": board.UID, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+			return err
 		}
-		raven.Capture(&raven.Packet{Level: raven.INFO, Message: "Delete Dashboard"}, map[string]string{"operation": "DeleteDashboard", "ConfigMap.Namespace": configMap.Namespace, "CopnfigMap.Name": configMap.Name, "ConfigMap.File": file, "Board.Name": board.Title, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
-		return
+		raven.Capture(&raven.Packet{Level: raven.INFO, Message: "Delete Dashboard"}, map[string]string{"operation": "DeleteDashboard", "ConfigMap.Namespace": configMap.Namespace, "ConfigMap.Name": configMap.Name, "ConfigMap.File": file, "Board.Name": board.Title, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+		return nil
 	}
-	raven.Capture(&raven.Packet{Level: raven.WARNING, Message: "Canont delete Dashboard without UID"}, map[string]string{"operation": "deleteDashboardConfigMap", "ConfigMap.Namespace": configMap.Namespace, "CopnfigMap.Name": configMap.Name, "ConfigMap.File": file, "Board.Name": board.Title, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+	raven.Capture(&raven.Packet{Level: raven.WARNING, Message: "Canont delete Dashboard without UID"}, map[string]string{"operation": "deleteDashboardConfigMap", "ConfigMap.Namespace": configMap.Namespace, "ConfigMap.Name": configMap.Name, "ConfigMap.File": file, "Board.Name": board.Title, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+	return nil
 }
@@ -0,0 +1,165 @@
+package operator
+
+/*
+Copyright [2019] [autonubil System GmbH]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+
+	"gitlab.autonubil.net/kubernetes/grafana-config-operator/pkg/grafana"
+)
+
+// How often the credentials file is checked for changes
+const credentialsFileInterval = 10 * time.Second
+
+// Keys of a credentials Secret: a token (API key or service account token),
+// a user and password for basic auth, or 'auth' in the format of --grafana.auth
+const (
+	credentialsTokenKey    = "token"
+	credentialsUserKey     = "user"
+	credentialsPasswordKey = "password"
+	credentialsAuthKey     = "auth"
+)
+
+// Current credentials for the grafana API
+func (npc *grafanaConfigController) getCredentials() grafana.Credentials {
+	npc.credentialsLock.RLock()
+	defer npc.credentialsLock.RUnlock()
+	return npc.credentials
+}
+
+// Swap the credentials used by all following grafana requests
+func (npc *grafanaConfigController) setCredentials(credentials grafana.Credentials, source string) {
+	npc.credentialsLock.Lock()
+	defer npc.credentialsLock.Unlock()
+	if credentials == npc.credentials {
+		return
+	}
+	npc.credentials = credentials
+	glog.V(1).Infof("Updated grafana credentials from %s", source)
+}
+
+// Read the credentials file, in the format of --grafana.auth
+func readCredentialsFile(file string) (grafana.Credentials, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return grafana.Credentials{}, err
+	}
+	auth := strings.TrimRight(string(content), "\r\n")
+	if auth == "" {
+		return grafana.Credentials{}, fmt.Errorf("%s is empty", file)
+	}
+	return grafana.ParseCredentials(auth), nil
+}
+
+// Check the credentials file for changes until stopped. Kubelet replaces
+// mounted Secrets by swapping a symlink, which changes the modification time
+// of the file as seen through the link.
+func (npc *grafanaConfigController) watchCredentialsFile(stop <-chan struct{}) {
+	var stamp time.Time
+	ticker := time.NewTicker(credentialsFileInterval)
+	defer ticker.Stop()
+	for {
+		if info, err := os.Stat(npc.options.GrafanaAuthFile); err != nil {
+			glog.Warningf("Failed to check grafana credentials file %s (%v)", npc.options.GrafanaAuthFile, err)
+		} else if !info.ModTime().Equal(stamp) {
+			if credentials, err := readCredentialsFile(npc.options.GrafanaAuthFile); err != nil {
+				glog.Warningf("Failed to read grafana credentials file, keeping the previous credentials (%v)", err)
+			} else {
+				stamp = info.ModTime()
+				npc.setCredentials(credentials, npc.options.GrafanaAuthFile)
+			}
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Credentials stored in a Secret
+func secretCredentials(secret *corev1.Secret) (grafana.Credentials, error) {
+	if token := secret.Data[credentialsTokenKey]; len(token) > 0 {
+		return grafana.Credentials{Token: strings.TrimSpace(string(token))}, nil
+	}
+	if user := secret.Data[credentialsUserKey]; len(user) > 0 {
+		return grafana.Credentials{User: string(user), Password: string(secret.Data[credentialsPasswordKey])}, nil
+	}
+	if auth := secret.Data[credentialsAuthKey]; len(auth) > 0 {
+		return grafana.ParseCredentials(strings.TrimRight(string(auth), "\r\n")), nil
+	}
+	return grafana.Credentials{}, fmt.Errorf("none of the keys %s, %s or %s in Secret %s/%s", credentialsTokenKey, credentialsUserKey, credentialsAuthKey, secret.Namespace, secret.Name)
+}
+
+// Namespace and name of the credentials Secret, given as [namespace/]name.
+// The namespace defaults to the watched namespace.
+func (npc *grafanaConfigController) credentialsSecretRef() (string, string, error) {
+	ref := npc.options.GrafanaAuthSecret
+	namespace, name := npc.namespace, ref
+	if slash := strings.Index(ref, "/"); slash >= 0 {
+		namespace, name = ref[:slash], ref[slash+1:]
+	}
+	if namespace == "" || name == "" {
+		return "", "", fmt.Errorf("invalid credentials Secret '%s', expected <namespace>/<name>", ref)
+	}
+	return namespace, name, nil
+}
+
+// Create a new Informer on the credentials Secret to swap the credentials
+// whenever it changes
+func (npc *grafanaConfigController) newCredentialsInformer(namespace string, name string) (cache.Store, cache.Controller) {
+	selector := fields.OneTermEqualSelector("metadata.name", name).String()
+	update := func(obj interface{}) {
+		secret := obj.(*corev1.Secret)
+		credentials, err := secretCredentials(secret)
+		if err != nil {
+			glog.Errorf("Failed to read grafana credentials, keeping the previous credentials (%v)", err)
+			return
+		}
+		npc.setCredentials(credentials, "Secret "+secret.Namespace+"/"+secret.Name)
+	}
+	return cache.NewInformer(
+		&cache.ListWatch{
+			ListFunc: func(alo metav1.ListOptions) (runtime.Object, error) {
+				return npc.clientSet.CoreV1().Secrets(namespace).List(metav1.ListOptions{FieldSelector: selector})
+			},
+			WatchFunc: func(alo metav1.ListOptions) (watch.Interface, error) {
+				return npc.clientSet.CoreV1().Secrets(namespace).Watch(metav1.ListOptions{FieldSelector: selector, ResourceVersion: alo.ResourceVersion})
+			},
+		},
+		&corev1.Secret{},
+		0,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: update,
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				update(newObj)
+			},
+		},
+	)
+}
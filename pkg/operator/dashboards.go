@@ -0,0 +1,388 @@
+package operator
+
+/*
+Copyright [2019] [autonubil System GmbH]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	raven "github.com/getsentry/raven-go"
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+
+	"gitlab.autonubil.net/kubernetes/grafana-config-operator/pkg/apis/grafana/v1alpha1"
+	"gitlab.autonubil.net/kubernetes/grafana-config-operator/pkg/grafana"
+)
+
+// HTTP client used to download dashboards referenced by URL
+var dashboardSourceClient = &http.Client{Timeout: 30 * time.Second}
+
+// Largest dashboard model downloaded from a URL
+const maxDashboardSourceSize = 10 << 20
+
+// Check a dashboard URL against the URL prefixes allowed by the operator.
+// Scheme and host have to match exactly.
+func (npc *grafanaConfigController) checkDashboardURL(u *url.URL) error {
+	for _, prefix := range strings.Split(npc.options.DashboardURLPrefixes, ",") {
+		allowed, err := url.Parse(strings.TrimSpace(prefix))
+		if err != nil || allowed.Host == "" {
+			continue
+		}
+		if strings.EqualFold(u.Scheme, allowed.Scheme) && strings.EqualFold(u.Host, allowed.Host) && strings.HasPrefix(u.Path, allowed.Path) {
+			return nil
+		}
+	}
+	return fmt.Errorf("downloading dashboards from %s://%s%s is not allowed", u.Scheme, u.Host, u.Path)
+}
+
+// Download a dashboard model. The URL and all redirects have to be allowed.
+func (npc *grafanaConfigController) downloadDashboard(source string) (string, error) {
+	u, err := url.Parse(source)
+	if err != nil {
+		return "", err
+	}
+	if err := npc.checkDashboardURL(u); err != nil {
+		return "", err
+	}
+	client := *dashboardSourceClient
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return fmt.Errorf("stopped after 10 redirects")
+		}
+		return npc.checkDashboardURL(req.URL)
+	}
+	resp, err := client.Get(source)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	raw, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxDashboardSourceSize+1))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("HTTP error %d", resp.StatusCode)
+	}
+	if len(raw) > maxDashboardSourceSize {
+		return "", fmt.Errorf("dashboard exceeds %d bytes", maxDashboardSourceSize)
+	}
+	return string(raw), nil
+}
+
+// Create a new Informer on the GrafanaDashboard resources in the cluster.
+func (npc *grafanaConfigController) newDashboardInformer() (cache.Store, cache.Controller) {
+	return cache.NewInformer(
+		&cache.ListWatch{
+			ListFunc: func(alo metav1.ListOptions) (runtime.Object, error) {
+				return npc.crdClient.GrafanaDashboards(npc.namespace).List(metav1.ListOptions{})
+			},
+			WatchFunc: func(alo metav1.ListOptions) (watch.Interface, error) {
+				return npc.crdClient.GrafanaDashboards(npc.namespace).Watch(metav1.ListOptions{ResourceVersion: alo.ResourceVersion})
+			},
+		},
+		&v1alpha1.GrafanaDashboard{},
+		npc.options.ResyncPeriod,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc:    npc.handleDashboardAdd,
+			UpdateFunc: npc.handleDashboardUpdate,
+			DeleteFunc: npc.handleDashboardDelete,
+		},
+	)
+}
+
+func (npc *grafanaConfigController) handleDashboardAdd(obj interface{}) {
+	dashboard := obj.(*v1alpha1.GrafanaDashboard)
+	glog.V(11).Infof("Received add for GrafanaDashboard: %s/%s", dashboard.Namespace, dashboard.Name)
+	npc.enqueueObject(npc.dashboardQueue, dashboard)
+}
+
+func (npc *grafanaConfigController) handleDashboardUpdate(oldObj, newObj interface{}) {
+	dashboard := newObj.(*v1alpha1.GrafanaDashboard)
+	oldDashboard := oldObj.(*v1alpha1.GrafanaDashboard)
+	// status updates written by the operator itself do not change the generation
+	if dashboard.ResourceVersion != oldDashboard.ResourceVersion && dashboard.Generation == oldDashboard.Generation {
+		return
+	}
+	glog.V(11).Infof("Received update for GrafanaDashboard: %s/%s", dashboard.Namespace, dashboard.Name)
+	npc.enqueueObject(npc.dashboardQueue, dashboard)
+}
+
+func (npc *grafanaConfigController) handleDashboardDelete(obj interface{}) {
+	dashboard, ok := obj.(*v1alpha1.GrafanaDashboard)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			return
+		}
+		if dashboard, ok = tombstone.Obj.(*v1alpha1.GrafanaDashboard); !ok {
+			return
+		}
+	}
+	glog.V(11).Infof("Received delete for GrafanaDashboard: %s/%s", dashboard.Namespace, dashboard.Name)
+	key, err := cache.MetaNamespaceKeyFunc(dashboard)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	npc.deletedObjectsLock.Lock()
+	npc.deletedDashboards[key] = dashboard
+	npc.deletedObjectsLock.Unlock()
+	npc.dashboardQueue.Add(key)
+}
+
+// Re-apply the GrafanaDashboards that reference a changed ConfigMap
+func (npc *grafanaConfigController) enqueueDashboardsReferencing(configMap *corev1.ConfigMap) {
+	if npc.informer.dashboardStore == nil {
+		return
+	}
+	for _, obj := range npc.informer.dashboardStore.List() {
+		dashboard, ok := obj.(*v1alpha1.GrafanaDashboard)
+		if ok && dashboard.Namespace == configMap.Namespace && dashboard.Spec.ConfigMapRef != nil && dashboard.Spec.ConfigMapRef.Name == configMap.Name {
+			npc.enqueueObject(npc.dashboardQueue, dashboard)
+		}
+	}
+}
+
+// Whether this operator instance is responsible for a custom resource
+func (npc *grafanaConfigController) isResponsible(instance string) bool {
+	return instance == "" || instance == npc.options.Instance
+}
+
+// Bring grafana in line with the GrafanaDashboard identified by key.
+func (npc *grafanaConfigController) syncGrafanaDashboard(key string) error {
+	obj, exists, err := npc.informer.dashboardStore.GetByKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to get GrafanaDashboard %s from cache: %v", key, err)
+	}
+
+	if !exists {
+		npc.deletedObjectsLock.Lock()
+		dashboard, found := npc.deletedDashboards[key]
+		npc.deletedObjectsLock.Unlock()
+		if !found {
+			return nil
+		}
+		if npc.isResponsible(dashboard.Spec.Instance) {
+			if err := npc.deleteGrafanaDashboard(dashboard, dashboard.Status.UID); err != nil {
+				return err
+			}
+		}
+		npc.deletedObjectsLock.Lock()
+		delete(npc.deletedDashboards, key)
+		npc.deletedObjectsLock.Unlock()
+		return nil
+	}
+
+	// recreated before the deletion was processed
+	npc.deletedObjectsLock.Lock()
+	delete(npc.deletedDashboards, key)
+	npc.deletedObjectsLock.Unlock()
+
+	dashboard := obj.(*v1alpha1.GrafanaDashboard)
+	if !npc.isResponsible(dashboard.Spec.Instance) {
+		glog.V(4).Infof("Skipping GrafanaDashboard %s for instance %s", key, dashboard.Spec.Instance)
+		return nil
+	}
+
+	board, reason, err := npc.loadGrafanaDashboard(dashboard)
+	if err != nil {
+		glog.Errorf("Failed to load GrafanaDashboard %s (%v)", key, err)
+		npc.updateDashboardStatus(dashboard, nil, reason, err)
+		if reason == v1alpha1.ReasonInvalidSpec {
+			// retrying does not help until the spec is changed
+			return nil
+		}
+		return err
+	}
+
+	statusMessage, err := npc.applyGrafanaDashboard(dashboard, board)
+	if err != nil {
+		npc.updateDashboardStatus(dashboard, nil, v1alpha1.ReasonGrafanaError, err)
+		return err
+	}
+	npc.updateDashboardStatus(dashboard, &statusMessage, v1alpha1.ReasonSynced, nil)
+	return nil
+}
+
+// Get the dashboard model from the source declared in the spec. Returns the
+// reason to report along with any error.
+func (npc *grafanaConfigController) loadGrafanaDashboard(dashboard *v1alpha1.GrafanaDashboard) (*grafana.Board, string, error) {
+	sources := 0
+	if dashboard.Spec.JSON != "" {
+		sources++
+	}
+	if dashboard.Spec.ConfigMapRef != nil {
+		sources++
+	}
+	if dashboard.Spec.URL != "" {
+		sources++
+	}
+	if sources != 1 {
+		return nil, v1alpha1.ReasonInvalidSpec, fmt.Errorf("exactly one of json, configMapRef and url has to be set")
+	}
+
+	content := dashboard.Spec.JSON
+	switch {
+	case dashboard.Spec.ConfigMapRef != nil:
+		ref := dashboard.Spec.ConfigMapRef
+		configMap, err := npc.clientSet.CoreV1().ConfigMaps(dashboard.Namespace).Get(ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, v1alpha1.ReasonSourceError, fmt.Errorf("failed to get Config Map %s: %v", ref.Name, err)
+		}
+		var found bool
+		if content, found = configMap.Data[ref.Key]; !found {
+			return nil, v1alpha1.ReasonSourceError, fmt.Errorf("Config Map %s has no key %s", ref.Name, ref.Key)
+		}
+	case dashboard.Spec.URL != "":
+		var err error
+		if content, err = npc.downloadDashboard(dashboard.Spec.URL); err != nil {
+			return nil, v1alpha1.ReasonSourceError, fmt.Errorf("failed to download %s: %v", dashboard.Spec.URL, err)
+		}
+	}
+
+	board, err := grafana.BoardFromString(content)
+	if err != nil {
+		return nil, v1alpha1.ReasonInvalidSpec, fmt.Errorf("invalid dashboard model: %v", err)
+	}
+	return board, "", nil
+}
+
+// Save the dashboard of a GrafanaDashboard into its folder. Dashboards of
+// custom resources are not tagged as owned, their lifecycle follows the
+// resource instead of garbage collection.
+func (npc *grafanaConfigController) applyGrafanaDashboard(dashboard *v1alpha1.GrafanaDashboard, board *grafana.Board) (grafana.StatusMessage, error) {
+	tags := map[string]string{"GrafanaDashboard.Namespace": dashboard.Namespace, "GrafanaDashboard.Name": dashboard.Name, "Board.Name": board.Title}
+	previousUID := dashboard.Status.UID
+	if board.UID == "" {
+		// keep updating the dashboard grafana created on the first sync
+		board.UID = previousUID
+	}
+
+	var folderID uint
+	if dashboard.Spec.FolderRef != "" {
+		folder, err := npc.getGrafanaFolder(dashboard.Namespace, dashboard.Spec.FolderRef)
+		if err != nil {
+			return grafana.StatusMessage{}, err
+		}
+		folderID = folder.ID
+	} else {
+		var err error
+		if folderID, err = npc.ensureFolderPath(npc.folderPath(dashboard.Spec.Folder), dashboard.Spec.FolderUID, tags); err != nil {
+			return grafana.StatusMessage{}, err
+		}
+	}
+
+	grafanaClient := npc.grafanaClient()
+	var statusMessage grafana.StatusMessage
+	if _, unchanged := dashboardUnchanged(grafanaClient, board, folderID); unchanged {
+		glog.V(3).Infof("Dashboard %s from GrafanaDashboard: %s/%s is unchanged, skipping update", board.Title, dashboard.Namespace, dashboard.Name)
+		writesTotal.WithLabelValues(writeKindDashboard, writeResultSkipped).Inc()
+		uid := board.UID
+		statusMessage.UID = &uid
+	} else {
+		var err error
+		if statusMessage, err = grafanaClient.SaveDashboard(*board, true, folderID); err != nil {
+			glog.Errorf("Failed to save dashboard of GrafanaDashboard: %s/%s (%#v)", dashboard.Namespace, dashboard.Name, err)
+			raven.CaptureError(err, npc.ravenTags(tags, "SaveDashboard"))
+			return statusMessage, err
+		}
+		glog.V(1).Infof("Created or Updated Dashboard %s from GrafanaDashboard: %s/%s", board.Title, dashboard.Namespace, dashboard.Name)
+		raven.Capture(&raven.Packet{Level: raven.INFO, Message: "Created Dashboard"}, npc.ravenTags(tags, "CreateDashboard"))
+		writesTotal.WithLabelValues(writeKindDashboard, writeResultApplied).Inc()
+	}
+
+	// the uid was changed in the model, so the old dashboard is left behind
+	if previousUID != "" && statusMessage.UID != nil && *statusMessage.UID != previousUID {
+		if err := npc.deleteGrafanaDashboard(dashboard, previousUID); err != nil {
+			return statusMessage, err
+		}
+	}
+	return statusMessage, nil
+}
+
+// Delete the dashboard of a GrafanaDashboard from grafana
+func (npc *grafanaConfigController) deleteGrafanaDashboard(dashboard *v1alpha1.GrafanaDashboard, uid string) error {
+	if uid == "" {
+		glog.V(4).Infof("GrafanaDashboard %s/%s was never applied, nothing to delete", dashboard.Namespace, dashboard.Name)
+		return nil
+	}
+	grafanaClient := npc.grafanaClient()
+	_, err := grafanaClient.DeleteDashboard(uid)
+	if grafana.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		glog.Errorf("Failed to delete dashboard %s of GrafanaDashboard: %s/%s (%#v)", uid, dashboard.Namespace, dashboard.Name, err)
+		raven.CaptureError(err, npc.ravenTags(map[string]string{"GrafanaDashboard.Namespace": dashboard.Namespace, "GrafanaDashboard.Name": dashboard.Name, "Board.UID": uid}, "DeleteDashboard"))
+		return err
+	}
+	glog.V(1).Infof("Deleted Dashboard %s of GrafanaDashboard: %s/%s", uid, dashboard.Namespace, dashboard.Name)
+	return nil
+}
+
+// Absolute URL of a dashboard. The URL returned by grafana already contains
+// the sub-path grafana is served under, so only the scheme and host of the
+// endpoint are used.
+func dashboardURL(endpoint string, dashboardPath string) string {
+	base, err := url.Parse(endpoint)
+	if err == nil {
+		var ref *url.URL
+		if ref, err = url.Parse(dashboardPath); err == nil {
+			return base.ResolveReference(ref).String()
+		}
+	}
+	return strings.TrimSuffix(endpoint, "/") + dashboardPath
+}
+
+// Report the outcome of a sync in the status of a GrafanaDashboard
+func (npc *grafanaConfigController) updateDashboardStatus(dashboard *v1alpha1.GrafanaDashboard, statusMessage *grafana.StatusMessage, reason string, syncErr error) {
+	updated := dashboard.DeepCopy()
+	now := metav1.Now()
+	condition := v1alpha1.Condition{Type: v1alpha1.ConditionReady, Status: corev1.ConditionTrue, Reason: reason, LastTransitionTime: now}
+	if syncErr != nil {
+		condition.Status = corev1.ConditionFalse
+		condition.Message = syncErr.Error()
+	}
+	updated.Status.Conditions = v1alpha1.SetCondition(updated.Status.Conditions, condition)
+	updated.Status.ObservedGeneration = dashboard.Generation
+	if statusMessage != nil {
+		if statusMessage.UID != nil {
+			updated.Status.UID = *statusMessage.UID
+		}
+		if statusMessage.URL != nil {
+			updated.Status.URL = dashboardURL(npc.options.GrafanaEndpoint, *statusMessage.URL)
+		}
+		if statusMessage.Version != nil {
+			updated.Status.Version = *statusMessage.Version
+		}
+		updated.Status.LastSyncTime = &now
+	}
+
+	if _, err := npc.crdClient.GrafanaDashboards(dashboard.Namespace).UpdateStatus(updated); err != nil {
+		glog.Warningf("Failed to update status of GrafanaDashboard %s/%s (%v)", dashboard.Namespace, dashboard.Name, err)
+	}
+}
@@ -0,0 +1,57 @@
+package operator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDownloadDashboard(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/dashboards/board.json":
+			w.Write([]byte(`{"title": "Board"}`))
+		case "/dashboards/redirect":
+			http.Redirect(w, r, "/private/board.json", http.StatusFound)
+		case "/dashboards/huge.json":
+			w.Write([]byte(strings.Repeat(" ", maxDashboardSourceSize+1)))
+		default:
+			w.Write([]byte(`{"title": "Private"}`))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		prefixes string
+		url      string
+		wantErr  string
+	}{
+		{name: "allowed", prefixes: server.URL + "/dashboards/", url: server.URL + "/dashboards/board.json"},
+		{name: "disabled", prefixes: "", url: server.URL + "/dashboards/board.json", wantErr: "is not allowed"},
+		{name: "other path", prefixes: server.URL + "/dashboards/", url: server.URL + "/private/board.json", wantErr: "is not allowed"},
+		{name: "other scheme", prefixes: strings.Replace(server.URL, "http:", "https:", 1), url: server.URL + "/dashboards/board.json", wantErr: "is not allowed"},
+		{name: "redirect", prefixes: server.URL + "/dashboards/", url: server.URL + "/dashboards/redirect", wantErr: "is not allowed"},
+		{name: "too large", prefixes: server.URL + "/dashboards/", url: server.URL + "/dashboards/huge.json", wantErr: "dashboard exceeds"},
+	}
+	npc := newTestController("http://grafana")
+	defer npc.cancel()
+	for _, test := range tests {
+		npc.options.DashboardURLPrefixes = "https://grafana.com/api/dashboards/, " + test.prefixes
+		content, err := npc.downloadDashboard(test.url)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: error = %v, want %q", test.name, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if content != `{"title": "Board"}` {
+			t.Errorf("%s: content = %s", test.name, content)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package operator
+
+/*
+Copyright [2019] [autonubil System GmbH]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+
+	raven "github.com/getsentry/raven-go"
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+
+	"gitlab.autonubil.net/kubernetes/grafana-config-operator/pkg/apis/grafana/v1alpha1"
+	"gitlab.autonubil.net/kubernetes/grafana-config-operator/pkg/grafana"
+)
+
+// Create a new Informer on the GrafanaDatasource resources in the cluster.
+func (npc *grafanaConfigController) newDatasourceInformer() (cache.Store, cache.Controller) {
+	return cache.NewInformer(
+		&cache.ListWatch{
+			ListFunc: func(alo metav1.ListOptions) (runtime.Object, error) {
+				return npc.crdClient.GrafanaDatasources(npc.namespace).List(metav1.ListOptions{})
+			},
+			WatchFunc: func(alo metav1.ListOptions) (watch.Interface, error) {
+				return npc.crdClient.GrafanaDatasources(npc.namespace).Watch(metav1.ListOptions{ResourceVersion: alo.ResourceVersion})
+			},
+		},
+		&v1alpha1.GrafanaDatasource{},
+		npc.options.ResyncPeriod,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc:    npc.handleDatasourceAdd,
+			UpdateFunc: npc.handleDatasourceUpdate,
+			DeleteFunc: npc.handleDatasourceDelete,
+		},
+	)
+}
+
+func (npc *grafanaConfigController) handleDatasourceAdd(obj interface{}) {
+	datasource := obj.(*v1alpha1.GrafanaDatasource)
+	glog.V(11).Infof("Received add for GrafanaDatasource: %s/%s", datasource.Namespace, datasource.Name)
+	npc.enqueueObject(npc.datasourceQueue, datasource)
+}
+
+func (npc *grafanaConfigController) handleDatasourceUpdate(oldObj, newObj interface{}) {
+	datasource := newObj.(*v1alpha1.GrafanaDatasource)
+	oldDatasource := oldObj.(*v1alpha1.GrafanaDatasource)
+	// status updates written by the operator itself do not change the generation
+	if datasource.ResourceVersion != oldDatasource.ResourceVersion && datasource.Generation == oldDatasource.Generation {
+		return
+	}
+	glog.V(11).Infof("Received update for GrafanaDatasource: %s/%s", datasource.Namespace, datasource.Name)
+	npc.enqueueObject(npc.datasourceQueue, datasource)
+}
+
+func (npc *grafanaConfigController) handleDatasourceDelete(obj interface{}) {
+	datasource, ok := obj.(*v1alpha1.GrafanaDatasource)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			return
+		}
+		if datasource, ok = tombstone.Obj.(*v1alpha1.GrafanaDatasource); !ok {
+			return
+		}
+	}
+	glog.V(11).Infof("Received delete for GrafanaDatasource: %s/%s", datasource.Namespace, datasource.Name)
+	key, err := cache.MetaNamespaceKeyFunc(datasource)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	npc.deletedObjectsLock.Lock()
+	npc.deletedDatasources[key] = datasource
+	npc.deletedObjectsLock.Unlock()
+	npc.datasourceQueue.Add(key)
+}
+
+// Bring grafana in line with the GrafanaDatasource identified by key.
+func (npc *grafanaConfigController) syncGrafanaDatasource(key string) error {
+	obj, exists, err := npc.informer.datasourceStore.GetByKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to get GrafanaDatasource %s from cache: %v", key, err)
+	}
+
+	if !exists {
+		npc.deletedObjectsLock.Lock()
+		datasource, found := npc.deletedDatasources[key]
+		npc.deletedObjectsLock.Unlock()
+		if !found {
+			return nil
+		}
+		if npc.isResponsible(datasource.Spec.Instance) {
+			if err := npc.deleteGrafanaDatasource(datasource); err != nil {
+				return err
+			}
+		}
+		npc.deletedObjectsLock.Lock()
+		delete(npc.deletedDatasources, key)
+		npc.deletedObjectsLock.Unlock()
+		return nil
+	}
+
+	// recreated before the deletion was processed
+	npc.deletedObjectsLock.Lock()
+	delete(npc.deletedDatasources, key)
+	npc.deletedObjectsLock.Unlock()
+
+	datasource := obj.(*v1alpha1.GrafanaDatasource)
+	if !npc.isResponsible(datasource.Spec.Instance) {
+		glog.V(4).Infof("Skipping GrafanaDatasource %s for instance %s", key, datasource.Spec.Instance)
+		return nil
+	}
+
+	desired, reason, err := npc.buildGrafanaDatasource(datasource)
+	if err != nil {
+		glog.Errorf("Failed to build GrafanaDatasource %s (%v)", key, err)
+		npc.updateDatasourceStatus(datasource, 0, reason, err)
+		if reason == v1alpha1.ReasonInvalidSpec {
+			// retrying does not help until the spec is changed
+			return nil
+		}
+		return err
+	}
+
+	id, err := npc.applyGrafanaDatasource(datasource, desired)
+	if err != nil {
+		npc.updateDatasourceStatus(datasource, 0, v1alpha1.ReasonGrafanaError, err)
+		return err
+	}
+	npc.updateDatasourceStatus(datasource, id, v1alpha1.ReasonSynced, nil)
+	return nil
+}
+
+// Convert the spec to a grafana datasource, reading all sensitive values from
+// their Secrets. Returns the reason to report along with any error.
+func (npc *grafanaConfigController) buildGrafanaDatasource(datasource *v1alpha1.GrafanaDatasource) (grafana.Datasource, string, error) {
+	spec := datasource.Spec
+	desired := grafana.Datasource{
+		Name:            datasource.DatasourceName(),
+		UID:             spec.UID,
+		OrgID:           spec.OrgID,
+		Type:            spec.Type,
+		Access:          spec.Access,
+		URL:             spec.URL,
+		BasicAuth:       spec.BasicAuth,
+		WithCredentials: spec.WithCredentials,
+		IsDefault:       spec.IsDefault,
+		Editable:        spec.Editable,
+	}
+	if desired.Type == "" {
+		return desired, v1alpha1.ReasonInvalidSpec, fmt.Errorf("type is required")
+	}
+	if desired.Access == "" {
+		desired.Access = "proxy"
+	}
+	if spec.User != "" {
+		desired.User = &spec.User
+	}
+	if spec.Database != "" {
+		desired.Database = &spec.Database
+	}
+	if spec.BasicAuthUser != "" {
+		desired.BasicAuthUser = &spec.BasicAuthUser
+	}
+	if spec.JSONData != nil && len(spec.JSONData.Raw) > 0 {
+		var jsonData map[string]interface{}
+		if err := json.Unmarshal(spec.JSONData.Raw, &jsonData); err != nil {
+			return desired, v1alpha1.ReasonInvalidSpec, fmt.Errorf("invalid jsonData: %v", err)
+		}
+		desired.JSONData = jsonData
+	}
+
+	if value, found, err := npc.resolveSecretValue(datasource.Namespace, spec.Password); err != nil {
+		return desired, v1alpha1.ReasonSourceError, fmt.Errorf("password: %v", err)
+	} else if found {
+		desired.Password = &value
+	}
+	if value, found, err := npc.resolveSecretValue(datasource.Namespace, spec.BasicAuthPassword); err != nil {
+		return desired, v1alpha1.ReasonSourceError, fmt.Errorf("basicAuthPassword: %v", err)
+	} else if found {
+		desired.BasicAuthPassword = &value
+	}
+	for key := range spec.SecureJSONData {
+		secureValue := spec.SecureJSONData[key]
+		value, found, err := npc.resolveSecretValue(datasource.Namespace, &secureValue)
+		if err != nil {
+			return desired, v1alpha1.ReasonSourceError, fmt.Errorf("secureJsonData.%s: %v", key, err)
+		}
+		if found {
+			if desired.SecureJSONData == nil {
+				desired.SecureJSONData = make(map[string]string)
+			}
+			desired.SecureJSONData[key] = value
+		}
+	}
+	return desired, "", nil
+}
+
+// Create or update the datasource of a GrafanaDatasource and return its id.
+// Datasources of custom resources are not marked as owned, their lifecycle
+// follows the resource instead of garbage collection.
+func (npc *grafanaConfigController) applyGrafanaDatasource(datasource *v1alpha1.GrafanaDatasource, desired grafana.Datasource) (uint, error) {
+	tags := map[string]string{"GrafanaDatasource.Namespace": datasource.Namespace, "GrafanaDatasource.Name": datasource.Name, "DataSource.Name": desired.Name}
+	grafanaClient := npc.datasourceClient(desired.OrgID)
+
+	// by uid first like for Config Maps, then by name
+	existing, err := findDatasource(grafanaClient, desired)
+	if err == nil && existing == nil && datasource.Status.ID != 0 && datasource.Status.Name != desired.Name {
+		// the name was changed, rename the datasource applied before
+		var previous grafana.Datasource
+		if previous, err = grafanaClient.GetDatasource(datasource.Status.ID); err == nil {
+			existing = &previous
+		} else if grafana.IsNotFound(err) {
+			err = nil
+		}
+	}
+	if err != nil {
+		glog.Errorf("Failed to check for existing datasource of GrafanaDatasource: %s/%s (%#v)", datasource.Namespace, datasource.Name, err)
+		raven.CaptureError(err, npc.ravenTags(tags, "GetDatasourceByName"))
+		return 0, err
+	}
+
+	if existing != nil {
+		var secretsHash string
+		desired, secretsHash = npc.withoutAppliedSecrets(desired, *existing)
+		if datasourceUnchanged(desired, *existing) {
+			glog.V(3).Infof("Datasource %s from GrafanaDatasource: %s/%s is unchanged, skipping update", desired.Name, datasource.Namespace, datasource.Name)
+			writesTotal.WithLabelValues(writeKindDatasource, writeResultSkipped).Inc()
+			return existing.ID, nil
+		}
+		if _, err := grafanaClient.UpdateDatasource(grafana.MergeDatasource(desired, *existing)); err != nil {
+			glog.Errorf("Failed to update datasource of GrafanaDatasource: %s/%s (%#v)", datasource.Namespace, datasource.Name, err)
+			raven.CaptureError(err, npc.ravenTags(tags, "UpdateDatasource"))
+			return 0, err
+		}
+		glog.V(1).Infof("Updated Datasource %s from GrafanaDatasource: %s/%s", desired.Name, datasource.Namespace, datasource.Name)
+		writesTotal.WithLabelValues(writeKindDatasource, writeResultApplied).Inc()
+		npc.setSecretsHash(desired, secretsHash)
+		return existing.ID, nil
+	}
+
+	statusMessage, err := grafanaClient.CreateDatasource(desired)
+	if err == nil && statusMessage.ID == nil {
+		err = fmt.Errorf("no datasource id returned for %s", desired.Name)
+		if statusMessage.Message != nil {
+			err = fmt.Errorf("failed to create datasource %s: %s", desired.Name, *statusMessage.Message)
+		}
+	}
+	if err != nil {
+		glog.Errorf("Failed to create datasource of GrafanaDatasource: %s/%s (%#v)", datasource.Namespace, datasource.Name, err)
+		raven.CaptureError(err, npc.ravenTags(tags, "CreateDatasource"))
+		return 0, err
+	}
+	glog.V(1).Infof("Created Datasource %s from GrafanaDatasource: %s/%s", desired.Name, datasource.Namespace, datasource.Name)
+	writesTotal.WithLabelValues(writeKindDatasource, writeResultApplied).Inc()
+	npc.setSecretsHash(desired, desired.SecretsHash())
+	raven.Capture(&raven.Packet{Level: raven.INFO, Message: "Created Data Source"}, npc.ravenTags(tags, "CreateDatasource"))
+	return *statusMessage.ID, nil
+}
+
+// Delete the datasource of a GrafanaDatasource from grafana
+func (npc *grafanaConfigController) deleteGrafanaDatasource(datasource *v1alpha1.GrafanaDatasource) error {
+	name := datasource.Status.Name
+	if name == "" {
+		name = datasource.DatasourceName()
+	}
+	grafanaClient := npc.datasourceClient(datasource.Spec.OrgID)
+	existing, err := findDatasource(grafanaClient, grafana.Datasource{UID: datasource.Spec.UID, Name: name})
+	if err == nil && existing == nil {
+		return nil
+	}
+	if err == nil {
+		_, err = grafanaClient.DeleteDatasource(existing.ID)
+	}
+	if err != nil {
+		glog.Errorf("Failed to delete datasource %s of GrafanaDatasource: %s/%s (%#v)", name, datasource.Namespace, datasource.Name, err)
+		raven.CaptureError(err, npc.ravenTags(map[string]string{"GrafanaDatasource.Namespace": datasource.Namespace, "GrafanaDatasource.Name": datasource.Name, "DataSource.Name": name}, "DeleteDatasource"))
+		return err
+	}
+	glog.V(1).Infof("Deleted Datasource %s of GrafanaDatasource: %s/%s", name, datasource.Namespace, datasource.Name)
+	npc.setSecretsHash(grafana.Datasource{OrgID: datasource.Spec.OrgID, UID: existing.UID, Name: name}, "")
+	return nil
+}
+
+// Client for the organization of a GrafanaDatasource, the one of the operator
+// if orgID is 0
+func (npc *grafanaConfigController) datasourceClient(orgID uint) *grafana.Client {
+	grafanaClient := npc.grafanaClient()
+	if orgID != 0 {
+		grafanaClient = grafanaClient.WithOrgID(orgID)
+	}
+	return grafanaClient
+}
+
+// Report the outcome of a sync in the status of a GrafanaDatasource
+func (npc *grafanaConfigController) updateDatasourceStatus(datasource *v1alpha1.GrafanaDatasource, id uint, reason string, syncErr error) {
+	updated := datasource.DeepCopy()
+	now := metav1.Now()
+	condition := v1alpha1.Condition{Type: v1alpha1.ConditionReady, Status: corev1.ConditionTrue, Reason: reason, LastTransitionTime: now}
+	if syncErr != nil {
+		condition.Status = corev1.ConditionFalse
+		condition.Message = syncErr.Error()
+	}
+	updated.Status.Conditions = v1alpha1.SetCondition(updated.Status.Conditions, condition)
+	updated.Status.ObservedGeneration = datasource.Generation
+	if syncErr == nil {
+		updated.Status.ID = id
+		updated.Status.Name = datasource.DatasourceName()
+		updated.Status.LastSyncTime = &now
+	}
+
+	if _, err := npc.crdClient.GrafanaDatasources(datasource.Namespace).UpdateStatus(updated); err != nil {
+		glog.Warningf("Failed to update status of GrafanaDatasource %s/%s (%v)", datasource.Namespace, datasource.Name, err)
+	}
+}
@@ -0,0 +1,211 @@
+package operator
+
+/*
+Copyright [2019] [autonubil System GmbH]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/cache"
+
+	"gitlab.autonubil.net/kubernetes/grafana-config-operator/pkg/grafana"
+)
+
+// Remember the state of a ConfigMap that has been applied to grafana. It is the
+// base for finding entries removed by later updates.
+func (npc *grafanaConfigController) setLastApplied(configMap *corev1.ConfigMap) {
+	key, err := cache.MetaNamespaceKeyFunc(configMap)
+	if err != nil {
+		return
+	}
+	npc.lastAppliedLock.Lock()
+	defer npc.lastAppliedLock.Unlock()
+	npc.lastApplied[key] = configMap
+}
+
+// Remember the previous state of a ConfigMap unless a newer one was already applied.
+func (npc *grafanaConfigController) initLastApplied(configMap *corev1.ConfigMap) {
+	key, err := cache.MetaNamespaceKeyFunc(configMap)
+	if err != nil {
+		return
+	}
+	npc.lastAppliedLock.Lock()
+	defer npc.lastAppliedLock.Unlock()
+	if _, exists := npc.lastApplied[key]; !exists {
+		npc.lastApplied[key] = configMap
+	}
+}
+
+func (npc *grafanaConfigController) getLastApplied(key string) (*corev1.ConfigMap, bool) {
+	npc.lastAppliedLock.Lock()
+	defer npc.lastAppliedLock.Unlock()
+	configMap, exists := npc.lastApplied[key]
+	return configMap, exists
+}
+
+func (npc *grafanaConfigController) removeLastApplied(key string) {
+	npc.lastAppliedLock.Lock()
+	defer npc.lastAppliedLock.Unlock()
+	delete(npc.lastApplied, key)
+}
+
+// Identifies a dashboard without uid by its title and folder
+func dashboardKey(title string, folder string) string {
+	return folder + "/" + title
+}
+
+// Identifies a notification channel by its uid, or by its name if it has none
+func notifierKey(name string, uid string) string {
+	if uid != "" {
+		return "uid:" + uid
+	}
+	return "name:" + name
+}
+
+// Delete all datasources, notification channels, alerting objects and dashboards that were declared by the previous
+// state of a ConfigMap but are no longer declared by the current one. Objects
+// that only moved to another key of the ConfigMap (or another folder, for
+// dashboards with a uid) are kept.
+func (npc *grafanaConfigController) deleteRemovedEntries(previous *corev1.ConfigMap, current *corev1.ConfigMap) error {
+	oldEntries, _ := npc.parseConfigMap(previous)
+	newEntries, err := npc.parseConfigMap(current)
+	if err != nil {
+		// a broken entry would look like all of its objects were removed
+		glog.Warningf("Not deleting removed entries of Config Map %s/%s, not all entries could be parsed: %v", current.Namespace, current.Name, err)
+		return nil
+	}
+
+	datasources := make(map[string]bool)
+	notifiers := make(map[string]bool)
+	alerting := make(map[string]bool)
+	boardUIDs := make(map[string]bool)
+	boardKeys := make(map[string]bool)
+	for _, entry := range newEntries {
+		if entry.datasources != nil {
+			for _, ds := range entry.datasources.Datasources {
+				datasources[ds.Name] = true
+			}
+		}
+		if entry.notifiers != nil {
+			for _, notifier := range entry.notifiers.Notifiers {
+				notifiers[notifierKey(notifier.Name, notifier.UID)] = true
+			}
+		}
+		if entry.alerting != nil {
+			for key := range alertingKeys(entry.alerting) {
+				alerting[key] = true
+			}
+		}
+		if entry.board != nil {
+			if entry.board.UID != "" {
+				boardUIDs[entry.board.UID] = true
+			} else if folder, err := npc.dashboardFolderTitle(current, entry.file); err == nil {
+				boardKeys[dashboardKey(entry.board.Title, folder)] = true
+			} else {
+				// the dashboard can not be told apart from removed ones
+				return err
+			}
+		}
+	}
+
+	errs := []error{}
+	for _, entry := range oldEntries {
+		if entry.datasources != nil {
+			removed := &grafana.DatasourceConfigFile{ApiVersion: entry.datasources.ApiVersion}
+			for _, ds := range entry.datasources.Datasources {
+				if !datasources[ds.Name] {
+					removed.Datasources = append(removed.Datasources, ds)
+				}
+			}
+			if len(removed.Datasources) > 0 {
+				if err := npc.processDatasourceConfigMap(previous, entry.file, removed, true); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+		if entry.notifiers != nil {
+			removed := &grafana.NotifierConfigFile{}
+			for _, notifier := range entry.notifiers.Notifiers {
+				if !notifiers[notifierKey(notifier.Name, notifier.UID)] {
+					removed.Notifiers = append(removed.Notifiers, notifier)
+				}
+			}
+			if len(removed.Notifiers) > 0 {
+				if err := npc.processNotifierConfigMap(previous, entry.file, removed, true); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+		if entry.alerting != nil {
+			if removed := removedAlerting(entry.alerting, alerting); !alertingEmpty(removed) {
+				if err := npc.processAlertingConfigMap(previous, entry.file, removed, true); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+		if entry.board != nil {
+			if entry.board.UID != "" {
+				if boardUIDs[entry.board.UID] {
+					continue
+				}
+				if err := npc.deleteDashboardConfigMap(previous, entry.file, entry.board); err != nil {
+					errs = append(errs, err)
+				}
+				continue
+			}
+			folder, err := npc.dashboardFolderTitle(previous, entry.file)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if boardKeys[dashboardKey(entry.board.Title, folder)] {
+				continue
+			}
+			if err := npc.deleteDashboardByTitle(previous, entry.file, entry.board, folder, boardUIDs); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// Delete a dashboard without uid by looking it up by its title and folder.
+// Dashboards whose uid is still declared are never deleted.
+func (npc *grafanaConfigController) deleteDashboardByTitle(configMap *corev1.ConfigMap, file string, board *grafana.Board, folder string, keep map[string]bool) error {
+	grafanaClient := npc.grafanaClient()
+	found, err := grafanaClient.SearchDashboards(board.Title, false)
+	if err != nil {
+		glog.Errorf("Failed to search for removed dashboard %s from Config Map: %s/%s %s (%#v)", board.Title, configMap.Namespace, configMap.Name, file, err)
+		return err
+	}
+	// search results only carry the title of the innermost folder
+	path := npc.folderPath(folder)
+	folderTitle := ""
+	if len(path) > 0 {
+		folderTitle = path[len(path)-1]
+	}
+	for _, candidate := range found {
+		if candidate.Type != "dash-db" || candidate.Title != board.Title || candidate.FolderTitle != folderTitle || candidate.UID == "" || keep[candidate.UID] {
+			continue
+		}
+		removed := *board
+		removed.UID = candidate.UID
+		return npc.deleteDashboardConfigMap(configMap, file, &removed)
+	}
+	glog.V(4).Infof("Removed dashboard %s from Config Map: %s/%s %s does not exist", board.Title, configMap.Namespace, configMap.Name, file)
+	return nil
+}
@@ -0,0 +1,159 @@
+package operator
+
+/*
+Copyright [2019] [autonubil System GmbH]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	raven "github.com/getsentry/raven-go"
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"gitlab.autonubil.net/kubernetes/grafana-config-operator/pkg/grafana"
+)
+
+const (
+	driftKindDashboard  = "dashboard"
+	driftKindDatasource = "datasource"
+)
+
+// Compare the live state of all managed dashboards and datasources with their
+// config maps. Drift is always reported; if correction is enabled the config
+// map is queued to be applied again.
+func (npc *grafanaConfigController) detectDrift() {
+	glog.V(3).Infof("Checking grafana for drifted objects")
+	grafanaClient := npc.grafanaClient()
+
+	drifted := map[string]int{driftKindDashboard: 0, driftKindDatasource: 0}
+	for _, obj := range npc.informer.configmapStore.List() {
+		configMap, ok := obj.(*corev1.ConfigMap)
+		if !ok || !npc.isWatchedLabel(configMap) {
+			continue
+		}
+
+		found := map[string]int{}
+		entries, _ := npc.parseConfigMap(configMap)
+		for _, entry := range entries {
+			if entry.datasources != nil {
+				for _, ds := range entry.datasources.Datasources {
+					if npc.datasourceDrifted(grafanaClient, configMap, entry.file, ds) {
+						found[driftKindDatasource]++
+					}
+				}
+			}
+			if entry.board != nil && npc.dashboardDrifted(grafanaClient, configMap, entry.file, entry.board) {
+				found[driftKindDashboard]++
+			}
+		}
+
+		for kind, count := range found {
+			drifted[kind] += count
+		}
+		if len(found) > 0 && npc.options.DriftCorrect {
+			glog.V(1).Infof("Re-applying drifted Config Map: %s/%s", configMap.Namespace, configMap.Name)
+			npc.setPendingDrift(configMap, found)
+			npc.enqueue(configMap)
+		}
+	}
+
+	for kind, count := range drifted {
+		driftedObjects.WithLabelValues(kind).Set(float64(count))
+	}
+}
+
+// Remember the drifted objects of a ConfigMap queued for correction.
+func (npc *grafanaConfigController) setPendingDrift(configMap *corev1.ConfigMap, drifted map[string]int) {
+	key, err := cache.MetaNamespaceKeyFunc(configMap)
+	if err != nil {
+		return
+	}
+	npc.pendingDriftLock.Lock()
+	defer npc.pendingDriftLock.Unlock()
+	npc.pendingDrift[key] = drifted
+}
+
+// Forget the drifted objects of a ConfigMap and return them.
+func (npc *grafanaConfigController) clearPendingDrift(key string) map[string]int {
+	npc.pendingDriftLock.Lock()
+	defer npc.pendingDriftLock.Unlock()
+	drifted := npc.pendingDrift[key]
+	delete(npc.pendingDrift, key)
+	return drifted
+}
+
+func (npc *grafanaConfigController) dashboardDrifted(grafanaClient *grafana.Client, configMap *corev1.ConfigMap, file string, board *grafana.Board) bool {
+	if board.UID == "" {
+		glog.V(4).Infof("Skipping drift detection for Dashboard %s without UID from Config Map: %s/%s %s", board.Title, configMap.Namespace, configMap.Name, file)
+		return false
+	}
+	live, meta, err := grafanaClient.GetRawDashboardByUID(board.UID)
+	if err != nil {
+		glog.Warningf("Failed to get Dashboard %s for drift detection from Config Map: %s/%s %s (%v)", board.UID, configMap.Namespace, configMap.Name, file, err)
+		return false
+	}
+	changed, err := grafana.DashboardDrifted(board, live)
+	if err != nil {
+		glog.Errorf("Failed to compare Dashboard %s from Config Map: %s/%s %s (%#v)", board.UID, configMap.Namespace, configMap.Name, file, err)
+		raven.CaptureError(err, map[string]string{"operation": "DashboardDrifted", "ConfigMap.Namespace": configMap.Namespace, "ConfigMap.Name": configMap.Name, "ConfigMap.File": file, "Board.Name": board.Title, "Board.UID": board.UID, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+		return false
+	}
+	// a dashboard moved to another folder has drifted as well
+	if !changed {
+		folderID, found, err := npc.findDashboardFolder(grafanaClient, configMap, file)
+		if err != nil {
+			glog.Warningf("Failed to get the folder of Dashboard %s for drift detection from Config Map: %s/%s %s (%v)", board.UID, configMap.Namespace, configMap.Name, file, err)
+		} else if !found || folderID != meta.FolderID {
+			glog.Warningf("Dashboard %s (%s) is not in the folder of Config Map: %s/%s %s", board.Title, board.UID, configMap.Namespace, configMap.Name, file)
+			changed = true
+		}
+	}
+	if changed {
+		glog.Warningf("Dashboard %s (%s) differs from Config Map: %s/%s %s", board.Title, board.UID, configMap.Namespace, configMap.Name, file)
+		driftDetectedTotal.WithLabelValues(driftKindDashboard).Inc()
+	}
+	return changed
+}
+
+func (npc *grafanaConfigController) datasourceDrifted(grafanaClient *grafana.Client, configMap *corev1.ConfigMap, file string, ds grafana.Datasource) bool {
+	ds, err := ds.WithExpandedVariables(npc.variableLookup(configMap))
+	if err != nil {
+		glog.Warningf("Skipping drift detection for Datasource %s from Config Map: %s/%s %s (%v)", ds.Name, configMap.Namespace, configMap.Name, file, err)
+		return false
+	}
+	// resolve by uid first like the apply path, so a datasource renamed in
+	// grafana is reported as drifted
+	live, err := findDatasource(grafanaClient, ds)
+	if err != nil {
+		glog.Warningf("Failed to get Datasource %s for drift detection from Config Map: %s/%s %s (%v)", ds.Name, configMap.Namespace, configMap.Name, file, err)
+		return false
+	}
+	if live == nil {
+		glog.Warningf("Datasource %s from Config Map: %s/%s %s does not exist", ds.Name, configMap.Namespace, configMap.Name, file)
+		driftDetectedTotal.WithLabelValues(driftKindDatasource).Inc()
+		return true
+	}
+	changed, err := grafana.DatasourceDrifted(ds, *live)
+	if err != nil {
+		glog.Errorf("Failed to compare Datasource %s from Config Map: %s/%s %s (%#v)", ds.Name, configMap.Namespace, configMap.Name, file, err)
+		raven.CaptureError(err, map[string]string{"operation": "DatasourceDrifted", "ConfigMap.Namespace": configMap.Namespace, "ConfigMap.Name": configMap.Name, "ConfigMap.File": file, "DataSource.Name": ds.Name, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+		return false
+	}
+	if changed {
+		glog.Warningf("Datasource %s differs from Config Map: %s/%s %s", ds.Name, configMap.Namespace, configMap.Name, file)
+		driftDetectedTotal.WithLabelValues(driftKindDatasource).Inc()
+	}
+	return changed
+}
@@ -0,0 +1,246 @@
+package operator
+
+/*
+Copyright [2019] [autonubil System GmbH]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	raven "github.com/getsentry/raven-go"
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+
+	"gitlab.autonubil.net/kubernetes/grafana-config-operator/pkg/grafana"
+)
+
+const (
+	// ConfigMap annotation with the folder for all of its dashboards
+	folderAnnotation = "grafana.autonubil.net/folder"
+	// ConfigMap annotation with a fixed uid for the (innermost) folder, which
+	// allows renaming the folder by changing its title
+	folderUIDAnnotation = "grafana.autonubil.net/folder-uid"
+)
+
+// Values available to the folder name template
+type folderTemplateData struct {
+	Namespace            string
+	Name                 string
+	File                 string
+	Labels               map[string]string
+	Annotations          map[string]string
+	NamespaceLabels      map[string]string
+	NamespaceAnnotations map[string]string
+}
+
+// Parse the operator wide folder name template. Missing labels or annotations
+// are errors, they would place dashboards in the wrong folder.
+func parseFolderTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	return template.New("folder").Option("missingkey=error").Parse(text)
+}
+
+// Evaluate the folder name template for a dashboard of a ConfigMap
+func (npc *grafanaConfigController) templatedFolderTitle(configMap *corev1.ConfigMap, file string) (string, error) {
+	if npc.folderTemplate == nil {
+		return "", nil
+	}
+	data := folderTemplateData{
+		Namespace:   configMap.Namespace,
+		Name:        configMap.Name,
+		File:        file,
+		Labels:      configMap.Labels,
+		Annotations: configMap.Annotations,
+	}
+	if namespace, found := npc.getNamespace(configMap.Namespace); found {
+		data.NamespaceLabels = namespace.Labels
+		data.NamespaceAnnotations = namespace.Annotations
+	}
+
+	var buf bytes.Buffer
+	if err := npc.folderTemplate.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to evaluate folder template: %v", err)
+	}
+	title := strings.TrimSpace(buf.String())
+	if npc.options.NestedFolders && title != "" {
+		for _, segment := range strings.Split(title, "/") {
+			if strings.TrimSpace(segment) == "" {
+				return "", fmt.Errorf("folder template evaluated to '%s', which contains an empty folder name", title)
+			}
+		}
+	}
+	return title, nil
+}
+
+// Split a folder title into the titles of nested folders. Without nested
+// folders the title is used as is.
+func (npc *grafanaConfigController) folderPath(title string) []string {
+	if title == "" {
+		return []string{}
+	}
+	if !npc.options.NestedFolders {
+		return []string{title}
+	}
+	path := []string{}
+	for _, segment := range strings.Split(title, "/") {
+		if segment = strings.TrimSpace(segment); segment != "" {
+			path = append(path, segment)
+		}
+	}
+	return path
+}
+
+// Folder explicitly requested by the ConfigMap
+func annotatedFolderTitle(configMap *corev1.ConfigMap) string {
+	return strings.TrimSpace(configMap.Annotations[folderAnnotation])
+}
+
+// Folder uid explicitly requested by the ConfigMap
+func annotatedFolderUID(configMap *corev1.ConfigMap) string {
+	return strings.TrimSpace(configMap.Annotations[folderUIDAnnotation])
+}
+
+// Make sure the folder with a fixed uid exists with the given title below the
+// given parent. An existing folder is renamed or moved as required.
+func (npc *grafanaConfigController) ensurePinnedFolder(grafanaClient *grafana.Client, uid string, title string, parentUID string) (*grafana.Folder, error) {
+	folder, err := grafanaClient.GetFolder(uid)
+	if grafana.IsNotFound(err) {
+		statusMessage, err := grafanaClient.CreateFolder(grafana.Folder{UID: uid, Title: title, ParentUID: parentUID})
+		if err == nil && statusMessage.ID == nil {
+			err = fmt.Errorf("no folder id returned for %s", title)
+		}
+		if err != nil {
+			return nil, err
+		}
+		glog.V(1).Infof("Created Folder %s (%s)", title, uid)
+		raven.Capture(&raven.Packet{Level: raven.INFO, Message: "Created new Folder"}, map[string]string{"operation": "CreateFolder", "Folder.Name": title, "Folder.UID": uid, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+		return &grafana.Folder{ID: *statusMessage.ID, UID: uid, Title: title, ParentUID: parentUID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if folder.Title != title {
+		if folder, err = grafanaClient.RenameFolder(uid, title); err != nil {
+			return nil, err
+		}
+		glog.V(1).Infof("Renamed Folder %s to %s", uid, title)
+		raven.Capture(&raven.Packet{Level: raven.INFO, Message: "Renamed Folder"}, map[string]string{"operation": "RenameFolder", "Folder.Name": title, "Folder.UID": uid, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+	}
+	if npc.options.NestedFolders && folder.ParentUID != parentUID {
+		if folder, err = grafanaClient.MoveFolder(uid, parentUID); err != nil {
+			return nil, err
+		}
+		glog.V(1).Infof("Moved Folder %s (%s) below '%s'", title, uid, parentUID)
+		raven.Capture(&raven.Packet{Level: raven.INFO, Message: "Moved Folder"}, map[string]string{"operation": "MoveFolder", "Folder.Name": title, "Folder.UID": uid, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+	}
+	return &folder, nil
+}
+
+// Walk down a folder hierarchy and create missing folders on the way. The
+// innermost folder gets the pinned uid if one is given. Returns the id of the
+// innermost folder, 0 (General) for an empty path.
+func (npc *grafanaConfigController) ensureFolderPath(path []string, pinnedUID string, tags map[string]string) (uint, error) {
+	grafanaClient := npc.grafanaClient()
+
+	folderID := uint(0) // General
+	parentUID := ""
+	for i, title := range path {
+		if pinnedUID != "" && i == len(path)-1 {
+			targetFolder, err := npc.ensurePinnedFolder(grafanaClient, pinnedUID, title, parentUID)
+			if err != nil {
+				glog.Errorf("Failed to ensure folder %s (%s) (%#v)", title, pinnedUID, err)
+				raven.CaptureError(err, npc.ravenTags(tags, "ensurePinnedFolder", "Folder.Name", title, "Folder.UID", pinnedUID))
+				return folderID, err
+			}
+			return targetFolder.ID, nil
+		}
+
+		targetFolder, err := grafanaClient.GetFolderByTitleInParent(title, parentUID)
+		if err != nil {
+			glog.Errorf("Failed to check list folders (%#v)", err)
+			raven.CaptureError(err, npc.ravenTags(tags, "GetFolders"))
+			return folderID, err
+		}
+		if targetFolder == nil {
+			uid := ownedFolderUID(strings.Join(path[:i+1], "/"))
+			statusMessage, err := grafanaClient.CreateFolder(grafana.Folder{UID: uid, Title: title, ParentUID: parentUID})
+			if err == nil && statusMessage.ID == nil {
+				err = fmt.Errorf("no folder id returned for %s", title)
+			}
+			if err != nil {
+				glog.Errorf("Failed to create folder (%#v)", err)
+				raven.CaptureError(err, npc.ravenTags(tags, "CreateFolder"))
+				return folderID, err
+			}
+			raven.Capture(&raven.Packet{Level: raven.INFO, Message: "Created new Folder"}, npc.ravenTags(tags, "CreateFolder", "Folder.Name", title))
+			folderID = *statusMessage.ID
+			parentUID = uid
+		} else {
+			folderID = targetFolder.ID
+			parentUID = targetFolder.UID
+		}
+	}
+	return folderID, nil
+}
+
+// Walk down a folder hierarchy like ensureFolderPath, but without creating
+// or changing folders. Returns false if a folder of the path does not exist.
+func findFolderPath(grafanaClient *grafana.Client, path []string, pinnedUID string) (uint, bool, error) {
+	folderID := uint(0) // General
+	parentUID := ""
+	for i, title := range path {
+		if pinnedUID != "" && i == len(path)-1 {
+			folder, err := grafanaClient.GetFolder(pinnedUID)
+			if grafana.IsNotFound(err) {
+				return 0, false, nil
+			}
+			if err != nil {
+				return 0, false, err
+			}
+			return folder.ID, true, nil
+		}
+		folder, err := grafanaClient.GetFolderByTitleInParent(title, parentUID)
+		if err != nil {
+			return 0, false, err
+		}
+		if folder == nil {
+			return 0, false, nil
+		}
+		folderID = folder.ID
+		parentUID = folder.UID
+	}
+	return folderID, true, nil
+}
+
+// Tags for sentry events: the given tags plus the operation, the grafana
+// endpoint and further key value pairs.
+func (npc *grafanaConfigController) ravenTags(tags map[string]string, operation string, keyValues ...string) map[string]string {
+	result := make(map[string]string, len(tags)+len(keyValues)/2+2)
+	for k, v := range tags {
+		result[k] = v
+	}
+	result["operation"] = operation
+	result["GrafanaEndpoint"] = npc.options.GrafanaEndpoint
+	for i := 0; i+1 < len(keyValues); i += 2 {
+		result[keyValues[i]] = keyValues[i+1]
+	}
+	return result
+}
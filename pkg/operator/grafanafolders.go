@@ -0,0 +1,423 @@
+package operator
+
+/*
+Copyright [2019] [autonubil System GmbH]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	raven "github.com/getsentry/raven-go"
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+
+	"gitlab.autonubil.net/kubernetes/grafana-config-operator/pkg/apis/grafana/v1alpha1"
+	"gitlab.autonubil.net/kubernetes/grafana-config-operator/pkg/grafana"
+)
+
+const (
+	// Finalizer that keeps a GrafanaFolder until its folder was deleted
+	folderFinalizer = "grafana.autonubil.net/folder"
+	// ConfigMap annotation with the name of a GrafanaFolder in the same
+	// namespace for all of its dashboards
+	folderRefAnnotation = "grafana.autonubil.net/folder-ref"
+	// Delay before checking again whether a folder can be deleted
+	folderNotEmptyRetry = time.Minute
+)
+
+// Create a new Informer on the GrafanaFolder resources in the cluster.
+func (npc *grafanaConfigController) newFolderInformer() (cache.Store, cache.Controller) {
+	return cache.NewInformer(
+		&cache.ListWatch{
+			ListFunc: func(alo metav1.ListOptions) (runtime.Object, error) {
+				return npc.crdClient.GrafanaFolders(npc.namespace).List(metav1.ListOptions{})
+			},
+			WatchFunc: func(alo metav1.ListOptions) (watch.Interface, error) {
+				return npc.crdClient.GrafanaFolders(npc.namespace).Watch(metav1.ListOptions{ResourceVersion: alo.ResourceVersion})
+			},
+		},
+		&v1alpha1.GrafanaFolder{},
+		npc.options.ResyncPeriod,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc:    npc.handleFolderAdd,
+			UpdateFunc: npc.handleFolderUpdate,
+		},
+	)
+}
+
+func (npc *grafanaConfigController) handleFolderAdd(obj interface{}) {
+	folder := obj.(*v1alpha1.GrafanaFolder)
+	glog.V(11).Infof("Received add for GrafanaFolder: %s/%s", folder.Namespace, folder.Name)
+	npc.enqueueObject(npc.folderQueue, folder)
+}
+
+func (npc *grafanaConfigController) handleFolderUpdate(oldObj, newObj interface{}) {
+	folder := newObj.(*v1alpha1.GrafanaFolder)
+	oldFolder := oldObj.(*v1alpha1.GrafanaFolder)
+	// status updates written by the operator itself do not change the
+	// generation, deletions are handled through the finalizer
+	if folder.ResourceVersion != oldFolder.ResourceVersion && folder.Generation == oldFolder.Generation && folder.DeletionTimestamp == nil {
+		return
+	}
+	glog.V(11).Infof("Received update for GrafanaFolder: %s/%s", folder.Namespace, folder.Name)
+	npc.enqueueObject(npc.folderQueue, folder)
+}
+
+// Bring grafana in line with the GrafanaFolder identified by key.
+func (npc *grafanaConfigController) syncGrafanaFolder(key string) error {
+	obj, exists, err := npc.informer.folderStore.GetByKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to get GrafanaFolder %s from cache: %v", key, err)
+	}
+	if !exists {
+		// the finalizer was removed after deleting the folder
+		return nil
+	}
+
+	folder := obj.(*v1alpha1.GrafanaFolder)
+	if !npc.isResponsible(folder.Spec.Instance) {
+		glog.V(4).Infof("Skipping GrafanaFolder %s for instance %s", key, folder.Spec.Instance)
+		return nil
+	}
+
+	if folder.DeletionTimestamp != nil {
+		return npc.finalizeGrafanaFolder(key, folder)
+	}
+
+	if !hasFinalizer(folder.Finalizers, folderFinalizer) {
+		updated := folder.DeepCopy()
+		updated.Finalizers = append(updated.Finalizers, folderFinalizer)
+		if folder, err = npc.crdClient.GrafanaFolders(folder.Namespace).Update(updated); err != nil {
+			return fmt.Errorf("failed to add finalizer to GrafanaFolder %s: %v", key, err)
+		}
+	}
+
+	parentUID, err := npc.folderParentUID(folder)
+	if err != nil {
+		glog.Warningf("Parent of GrafanaFolder %s is not available (%v)", key, err)
+		npc.updateFolderStatus(folder, nil, nil, v1alpha1.ReasonSourceError, err)
+		return err
+	}
+
+	applied, created, err := npc.applyGrafanaFolder(folder, parentUID)
+	if _, exists := err.(*folderExistsError); exists {
+		// retried once the resource changes
+		glog.Warningf("Not adopting folder for GrafanaFolder %s: %v", key, err)
+		npc.updateFolderStatus(folder, nil, nil, v1alpha1.ReasonExists, err)
+		return nil
+	}
+	if err != nil {
+		npc.updateFolderStatus(folder, nil, nil, v1alpha1.ReasonGrafanaError, err)
+		return err
+	}
+	if created != folder.Status.Created {
+		folder = folder.DeepCopy()
+		folder.Status.Created = created
+	}
+
+	managed, reason, err := npc.applyGrafanaFolderPermissions(folder, applied)
+	if err != nil {
+		npc.updateFolderStatus(folder, applied, managed, reason, err)
+		if reason == v1alpha1.ReasonInvalidSpec {
+			return nil
+		}
+		return err
+	}
+	npc.updateFolderStatus(folder, applied, managed, v1alpha1.ReasonSynced, nil)
+
+	if folder.Status.UID != applied.UID || folder.Status.ID != applied.ID {
+		npc.enqueueFolderDependents(folder)
+	}
+	return nil
+}
+
+func hasFinalizer(finalizers []string, finalizer string) bool {
+	for _, f := range finalizers {
+		if f == finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// Uid of the folder a GrafanaFolder is nested in, if any
+func (npc *grafanaConfigController) folderParentUID(folder *v1alpha1.GrafanaFolder) (string, error) {
+	if folder.Spec.ParentRef == "" {
+		return folder.Spec.ParentUID, nil
+	}
+	parent, err := npc.getGrafanaFolder(folder.Namespace, folder.Spec.ParentRef)
+	if err != nil {
+		return "", err
+	}
+	return parent.UID, nil
+}
+
+// Get the folder of a GrafanaFolder that was already applied to grafana
+func (npc *grafanaConfigController) getGrafanaFolder(namespace string, name string) (*grafana.Folder, error) {
+	if npc.informer.folderStore == nil {
+		return nil, fmt.Errorf("GrafanaFolder %s/%s can not be used, GrafanaFolders are not watched", namespace, name)
+	}
+	obj, exists, err := npc.informer.folderStore.GetByKey(namespace + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("GrafanaFolder %s/%s not found", namespace, name)
+	}
+	folder := obj.(*v1alpha1.GrafanaFolder)
+	if folder.Status.UID == "" || folder.DeletionTimestamp != nil {
+		return nil, fmt.Errorf("GrafanaFolder %s/%s is not ready", namespace, name)
+	}
+	return &grafana.Folder{ID: folder.Status.ID, UID: folder.Status.UID, Title: folder.FolderTitle()}, nil
+}
+
+// A folder that exists in grafana but was neither created for a GrafanaFolder
+// nor may be adopted by it
+type folderExistsError struct {
+	title string
+	uid   string
+}
+
+func (e *folderExistsError) Error() string {
+	return fmt.Sprintf("folder %s (%s) already exists in grafana, set spec.adopt to manage it", e.title, e.uid)
+}
+
+// Create, rename or move the folder of a GrafanaFolder. Returns whether the
+// folder was created for the resource, existing folders are only taken over
+// if the resource asks for it. Folders created by a GrafanaFolder do not
+// carry the uid prefix of owned folders, so they are never garbage collected.
+func (npc *grafanaConfigController) applyGrafanaFolder(folder *v1alpha1.GrafanaFolder, parentUID string) (*grafana.Folder, bool, error) {
+	tags := map[string]string{"GrafanaFolder.Namespace": folder.Namespace, "GrafanaFolder.Name": folder.Name, "Folder.Name": folder.FolderTitle()}
+	grafanaClient := npc.grafanaClient()
+
+	title := folder.FolderTitle()
+	uid := folder.Spec.UID
+	if uid == "" {
+		uid = folder.Status.UID
+	}
+	if uid != "" {
+		created := folder.Status.Created && folder.Status.UID == uid
+		if folder.Status.UID != uid {
+			// a pinned uid the resource did not manage before
+			existing, err := grafanaClient.GetFolder(uid)
+			switch {
+			case grafana.IsNotFound(err):
+				created = true
+			case err != nil:
+				glog.Errorf("Failed to get folder %s (%s) of GrafanaFolder: %s/%s (%#v)", title, uid, folder.Namespace, folder.Name, err)
+				raven.CaptureError(err, npc.ravenTags(tags, "GetFolder", "Folder.UID", uid))
+				return nil, false, err
+			case !folder.Spec.Adopt:
+				return nil, false, &folderExistsError{title: existing.Title, uid: uid}
+			}
+		}
+		applied, err := npc.ensurePinnedFolder(grafanaClient, uid, title, parentUID)
+		if err != nil {
+			glog.Errorf("Failed to ensure folder %s (%s) of GrafanaFolder: %s/%s (%#v)", title, uid, folder.Namespace, folder.Name, err)
+			raven.CaptureError(err, npc.ravenTags(tags, "ensurePinnedFolder", "Folder.UID", uid))
+		}
+		return applied, created, err
+	}
+
+	// adopt an existing folder with the same title if asked to, or let
+	// grafana choose a uid
+	existing, err := grafanaClient.GetFolderByTitleInParent(title, parentUID)
+	if err != nil {
+		glog.Errorf("Failed to list folders for GrafanaFolder: %s/%s (%#v)", folder.Namespace, folder.Name, err)
+		raven.CaptureError(err, npc.ravenTags(tags, "GetFolders"))
+		return nil, false, err
+	}
+	if existing != nil {
+		if !folder.Spec.Adopt {
+			return nil, false, &folderExistsError{title: existing.Title, uid: existing.UID}
+		}
+		glog.V(1).Infof("Adopted Folder %s (%s) for GrafanaFolder: %s/%s", existing.Title, existing.UID, folder.Namespace, folder.Name)
+		return existing, false, nil
+	}
+	statusMessage, err := grafanaClient.CreateFolder(grafana.Folder{Title: title, ParentUID: parentUID})
+	if err == nil && (statusMessage.ID == nil || statusMessage.UID == nil) {
+		err = fmt.Errorf("no folder id returned for %s", title)
+	}
+	if err != nil {
+		glog.Errorf("Failed to create folder %s of GrafanaFolder: %s/%s (%#v)", title, folder.Namespace, folder.Name, err)
+		raven.CaptureError(err, npc.ravenTags(tags, "CreateFolder"))
+		return nil, false, err
+	}
+	glog.V(1).Infof("Created Folder %s from GrafanaFolder: %s/%s", title, folder.Namespace, folder.Name)
+	raven.Capture(&raven.Packet{Level: raven.INFO, Message: "Created new Folder"}, npc.ravenTags(tags, "CreateFolder"))
+	return &grafana.Folder{ID: *statusMessage.ID, UID: *statusMessage.UID, Title: title, ParentUID: parentUID}, true, nil
+}
+
+// Apply the permissions declared by a GrafanaFolder. Returns the principals
+// managed by the operator afterwards.
+func (npc *grafanaConfigController) applyGrafanaFolderPermissions(folder *v1alpha1.GrafanaFolder, applied *grafana.Folder) ([]string, string, error) {
+	if folder.Spec.Permissions == nil && len(folder.Status.ManagedPermissions) == 0 {
+		return nil, "", nil
+	}
+	grants := []permissionGrant{}
+	for _, permission := range folder.Spec.Permissions {
+		var grant permissionGrant
+		var err error
+		switch {
+		case permission.Team != "":
+			grant, err = newPermissionGrant("team", permission.Team, permission.Permission)
+		case permission.User != "":
+			grant, err = newPermissionGrant("user", permission.User, permission.Permission)
+		default:
+			grant, err = newPermissionGrant("role", permission.Role, permission.Permission)
+		}
+		if err != nil {
+			return folder.Status.ManagedPermissions, v1alpha1.ReasonInvalidSpec, fmt.Errorf("invalid permission %+v: %v", permission, err)
+		}
+		grants = append(grants, grant)
+	}
+
+	grafanaClient := npc.grafanaClient()
+	desired, err := resolvePermissions(grafanaClient, grants)
+	if err != nil {
+		return folder.Status.ManagedPermissions, v1alpha1.ReasonSourceError, err
+	}
+	previous := make(map[string]bool)
+	for _, principal := range folder.Status.ManagedPermissions {
+		previous[principal] = true
+	}
+	err = npc.updatePermissions(
+		func() ([]grafana.Permission, error) { return grafanaClient.GetFolderPermissions(applied.UID) },
+		func(items []grafana.PermissionItem) (grafana.StatusMessage, error) {
+			return grafanaClient.UpdateFolderPermissions(applied.UID, items)
+		},
+		desired, previous)
+	if err != nil {
+		glog.Errorf("Failed to update permissions of GrafanaFolder: %s/%s (%#v)", folder.Namespace, folder.Name, err)
+		raven.CaptureError(err, npc.ravenTags(map[string]string{"GrafanaFolder.Namespace": folder.Namespace, "GrafanaFolder.Name": folder.Name, "Folder.UID": applied.UID}, "UpdateFolderPermissions"))
+		return folder.Status.ManagedPermissions, v1alpha1.ReasonGrafanaError, err
+	}
+	managed := []string{}
+	for _, item := range desired {
+		managed = append(managed, permissionPrincipal(item))
+	}
+	return managed, "", nil
+}
+
+// Delete the folder of a deleted GrafanaFolder and release the resource.
+// Folders that still contain dashboards or folders are only deleted if they
+// were created for the resource and it asks for a cascading delete. Adopted
+// folders are left in grafana.
+func (npc *grafanaConfigController) finalizeGrafanaFolder(key string, folder *v1alpha1.GrafanaFolder) error {
+	if !hasFinalizer(folder.Finalizers, folderFinalizer) {
+		return nil
+	}
+	tags := map[string]string{"GrafanaFolder.Namespace": folder.Namespace, "GrafanaFolder.Name": folder.Name, "Folder.Name": folder.FolderTitle(), "Folder.UID": folder.Status.UID}
+	grafanaClient := npc.grafanaClient()
+
+	if folder.Status.UID != "" && folder.Status.Created {
+		existing, err := grafanaClient.GetFolder(folder.Status.UID)
+		if err != nil && !grafana.IsNotFound(err) {
+			return err
+		}
+		if err == nil {
+			if !folder.Spec.Cascade {
+				boards, err := grafanaClient.SearchDashboardsInFolder(existing.ID)
+				if err != nil {
+					return err
+				}
+				children, err := grafanaClient.GetFolders(existing.UID)
+				if err != nil {
+					return err
+				}
+				if len(boards) > 0 || len(children) > 0 {
+					err := fmt.Errorf("folder %s still contains %d dashboards and %d folders", existing.Title, len(boards), len(children))
+					glog.Warningf("Not deleting folder of GrafanaFolder %s: %v", key, err)
+					npc.updateFolderStatus(folder, nil, folder.Status.ManagedPermissions, v1alpha1.ReasonNotEmpty, err)
+					npc.folderQueue.AddAfter(key, folderNotEmptyRetry)
+					return nil
+				}
+			}
+			if _, err := grafanaClient.DeleteFolder(existing.UID); err != nil && !grafana.IsNotFound(err) {
+				glog.Errorf("Failed to delete folder of GrafanaFolder %s (%#v)", key, err)
+				raven.CaptureError(err, npc.ravenTags(tags, "DeleteFolder"))
+				return err
+			}
+			glog.V(1).Infof("Deleted Folder %s of GrafanaFolder: %s", existing.Title, key)
+			raven.Capture(&raven.Packet{Level: raven.INFO, Message: "Deleted Folder"}, npc.ravenTags(tags, "DeleteFolder"))
+		}
+	}
+
+	updated := folder.DeepCopy()
+	updated.Finalizers = []string{}
+	for _, f := range folder.Finalizers {
+		if f != folderFinalizer {
+			updated.Finalizers = append(updated.Finalizers, f)
+		}
+	}
+	if _, err := npc.crdClient.GrafanaFolders(folder.Namespace).Update(updated); err != nil {
+		return fmt.Errorf("failed to remove finalizer from GrafanaFolder %s: %v", key, err)
+	}
+	return nil
+}
+
+// Re-apply the dashboards and folders that refer to a GrafanaFolder once its
+// folder changed
+func (npc *grafanaConfigController) enqueueFolderDependents(folder *v1alpha1.GrafanaFolder) {
+	for _, obj := range npc.informer.folderStore.List() {
+		if child, ok := obj.(*v1alpha1.GrafanaFolder); ok && child.Namespace == folder.Namespace && child.Spec.ParentRef == folder.Name {
+			npc.enqueueObject(npc.folderQueue, child)
+		}
+	}
+	if npc.informer.dashboardStore != nil {
+		for _, obj := range npc.informer.dashboardStore.List() {
+			if dashboard, ok := obj.(*v1alpha1.GrafanaDashboard); ok && dashboard.Namespace == folder.Namespace && dashboard.Spec.FolderRef == folder.Name {
+				npc.enqueueObject(npc.dashboardQueue, dashboard)
+			}
+		}
+	}
+	for _, obj := range npc.informer.configmapStore.List() {
+		if configMap, ok := obj.(*corev1.ConfigMap); ok && configMap.Namespace == folder.Namespace && strings.TrimSpace(configMap.Annotations[folderRefAnnotation]) == folder.Name && npc.isWatchedLabel(configMap) {
+			npc.enqueue(configMap)
+		}
+	}
+}
+
+// Report the outcome of a sync in the status of a GrafanaFolder
+func (npc *grafanaConfigController) updateFolderStatus(folder *v1alpha1.GrafanaFolder, applied *grafana.Folder, managed []string, reason string, syncErr error) {
+	updated := folder.DeepCopy()
+	now := metav1.Now()
+	condition := v1alpha1.Condition{Type: v1alpha1.ConditionReady, Status: corev1.ConditionTrue, Reason: reason, LastTransitionTime: now}
+	if syncErr != nil {
+		condition.Status = corev1.ConditionFalse
+		condition.Message = syncErr.Error()
+	}
+	updated.Status.Conditions = v1alpha1.SetCondition(updated.Status.Conditions, condition)
+	updated.Status.ObservedGeneration = folder.Generation
+	if applied != nil {
+		updated.Status.UID = applied.UID
+		updated.Status.ID = applied.ID
+		updated.Status.URL = strings.TrimSuffix(npc.options.GrafanaEndpoint, "/") + "/dashboards/f/" + applied.UID
+		updated.Status.ManagedPermissions = managed
+		if syncErr == nil {
+			updated.Status.LastSyncTime = &now
+		}
+	}
+
+	if _, err := npc.crdClient.GrafanaFolders(folder.Namespace).UpdateStatus(updated); err != nil {
+		glog.Warningf("Failed to update status of GrafanaFolder %s/%s (%v)", folder.Namespace, folder.Name, err)
+	}
+}
@@ -0,0 +1,66 @@
+package operator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gitlab.autonubil.net/kubernetes/grafana-config-operator/pkg/apis/grafana/v1alpha1"
+)
+
+func TestApplyGrafanaFolderAdoption(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/folders":
+			w.Write([]byte(`[{"id":7,"uid":"ops","title":"Ops"}]`))
+		case r.Method == "GET" && r.URL.Path == "/api/folders/ops":
+			w.Write([]byte(`{"id":7,"uid":"ops","title":"Ops"}`))
+		case r.Method == "POST" && r.URL.Path == "/api/folders":
+			w.Write([]byte(`{"id":8,"uid":"new","title":"Ops"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"folder not found"}`))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		spec        v1alpha1.GrafanaFolderSpec
+		status      v1alpha1.GrafanaFolderStatus
+		wantExists  bool
+		wantUID     string
+		wantCreated bool
+	}{
+		{name: "existing title", spec: v1alpha1.GrafanaFolderSpec{Title: "Ops"}, wantExists: true},
+		{name: "existing title adopted", spec: v1alpha1.GrafanaFolderSpec{Title: "Ops", Adopt: true}, wantUID: "ops"},
+		{name: "existing uid", spec: v1alpha1.GrafanaFolderSpec{Title: "Ops", UID: "ops"}, wantExists: true},
+		{name: "existing uid adopted", spec: v1alpha1.GrafanaFolderSpec{Title: "Ops", UID: "ops", Adopt: true}, wantUID: "ops"},
+		{name: "new uid", spec: v1alpha1.GrafanaFolderSpec{Title: "Ops", UID: "new"}, wantUID: "new", wantCreated: true},
+		{name: "new title", spec: v1alpha1.GrafanaFolderSpec{Title: "Platform"}, wantUID: "new", wantCreated: true},
+		{name: "created before", spec: v1alpha1.GrafanaFolderSpec{Title: "Ops"}, status: v1alpha1.GrafanaFolderStatus{UID: "ops", Created: true}, wantUID: "ops", wantCreated: true},
+		{name: "adopted before", spec: v1alpha1.GrafanaFolderSpec{Title: "Ops", Adopt: true}, status: v1alpha1.GrafanaFolderStatus{UID: "ops"}, wantUID: "ops"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			npc := newTestController(server.URL)
+			defer npc.cancel()
+			folder := &v1alpha1.GrafanaFolder{Spec: test.spec, Status: test.status}
+			folder.Namespace, folder.Name = "monitoring", "ops"
+
+			applied, created, err := npc.applyGrafanaFolder(folder, "")
+			if _, exists := err.(*folderExistsError); exists != test.wantExists {
+				t.Fatalf("error = %v, want an existing folder error: %t", err, test.wantExists)
+			}
+			if test.wantExists {
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if applied.UID != test.wantUID || created != test.wantCreated {
+				t.Errorf("applied %s (created %t), want %s (created %t)", applied.UID, created, test.wantUID, test.wantCreated)
+			}
+		})
+	}
+}
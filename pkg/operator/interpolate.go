@@ -0,0 +1,84 @@
+package operator
+
+/*
+Copyright [2019] [autonubil System GmbH]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"gitlab.autonubil.net/kubernetes/grafana-config-operator/pkg/apis/grafana/v1alpha1"
+)
+
+// Prefix of variable references that read a key of a Secret, e.g.
+// ${secret:monitoring/loki/password} or ${secret:loki/password} for a Secret in
+// the namespace of the ConfigMap
+const secretVariablePrefix = "secret:"
+
+// Resolves the variable references of the provisioning files of a ConfigMap:
+// keys of Secrets and environment variables of the operator. Only variables
+// with the configured prefix may be read, so ConfigMaps can not leak the rest
+// of the operator's environment.
+func (npc *grafanaConfigController) variableLookup(configMap *corev1.ConfigMap) func(string) (string, error) {
+	return func(name string) (string, error) {
+		if strings.HasPrefix(name, secretVariablePrefix) {
+			return npc.lookupSecretVariable(configMap, strings.TrimPrefix(name, secretVariablePrefix))
+		}
+		prefix := npc.options.EnvVariablePrefix
+		if prefix == "" {
+			return "", fmt.Errorf("environment variable %s may not be used, environment variables are disabled", name)
+		}
+		if !strings.HasPrefix(name, prefix) {
+			return "", fmt.Errorf("environment variable %s may not be used, only variables starting with %s are allowed", name, prefix)
+		}
+		value, found := os.LookupEnv(name)
+		if !found {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value, nil
+	}
+}
+
+// Read the key of a Secret given as [namespace/]name/key. Secrets of other
+// namespaces than the one of the ConfigMap have to be allowed explicitly.
+func (npc *grafanaConfigController) lookupSecretVariable(configMap *corev1.ConfigMap, reference string) (string, error) {
+	parts := strings.Split(reference, "/")
+	namespace := configMap.Namespace
+	switch len(parts) {
+	case 2:
+	case 3:
+		namespace = parts[0]
+		parts = parts[1:]
+	default:
+		return "", fmt.Errorf("invalid secret reference '%s', expected [namespace/]name/key", reference)
+	}
+	if parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("invalid secret reference '%s', expected [namespace/]name/key", reference)
+	}
+	if namespace != configMap.Namespace && !npc.options.CrossNamespaceSecrets {
+		return "", fmt.Errorf("secret reference '%s' points to namespace %s, but only Secrets of namespace %s may be used", reference, namespace, configMap.Namespace)
+	}
+	value, _, err := npc.resolveSecretValue(namespace, &v1alpha1.SecretValue{
+		SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: parts[0]},
+			Key:                  parts[1],
+		},
+	})
+	return value, err
+}
@@ -0,0 +1,51 @@
+package operator
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestVariableLookupEnvPrefix(t *testing.T) {
+	os.Setenv("GRAFANA_DS_TOKEN", "token")
+	os.Setenv("GRAFANA_DS_UNRELATED_SECRET", "secret")
+	defer os.Unsetenv("GRAFANA_DS_TOKEN")
+	defer os.Unsetenv("GRAFANA_DS_UNRELATED_SECRET")
+
+	tests := []struct {
+		name    string
+		prefix  string
+		value   string
+		want    string
+		wantErr string
+	}{
+		{name: "disabled", value: "GRAFANA_DS_TOKEN", wantErr: "disabled"},
+		{name: "allowed", prefix: "GRAFANA_DS_TOKEN", value: "GRAFANA_DS_TOKEN", want: "token"},
+		{name: "other prefix", prefix: "GRAFANA_DS_TOKEN", value: "GRAFANA_DS_UNRELATED_SECRET", wantErr: "only variables starting with GRAFANA_DS_TOKEN"},
+		{name: "operator environment", prefix: "GRAFANA_DS_", value: "HOME", wantErr: "only variables starting with GRAFANA_DS_"},
+		{name: "not set", prefix: "GRAFANA_DS_", value: "GRAFANA_DS_MISSING", wantErr: "is not set"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			npc := newTestController("http://grafana")
+			defer npc.cancel()
+			npc.options.EnvVariablePrefix = test.prefix
+
+			value, err := npc.variableLookup(&corev1.ConfigMap{})(test.value)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("error = %v, want %s", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if value != test.want {
+				t.Errorf("value = %s, want %s", value, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package operator
+
+/*
+Copyright [2019] [autonubil System GmbH]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	driftDetectedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "grafana_config_operator_drift_detected_total",
+			Help: "Number of grafana objects found to differ from their config map.",
+		},
+		[]string{"kind"},
+	)
+	driftCorrectedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "grafana_config_operator_drift_corrected_total",
+			Help: "Number of drifted grafana objects whose config map was applied again.",
+		},
+		[]string{"kind"},
+	)
+	driftedObjects = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "grafana_config_operator_drifted_objects",
+			Help: "Number of grafana objects that differed from their config map in the last drift detection run.",
+		},
+		[]string{"kind"},
+	)
+	prunedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "grafana_config_operator_pruned_total",
+			Help: "Number of orphaned grafana objects deleted by the garbage collection.",
+		},
+		[]string{"kind"},
+	)
+	writesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "grafana_config_operator_writes_total",
+			Help: "Number of dashboard and datasource writes, applied or skipped because grafana already had the desired state.",
+		},
+		[]string{"kind", "result"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(driftDetectedTotal)
+	prometheus.MustRegister(driftCorrectedTotal)
+	prometheus.MustRegister(driftedObjects)
+	prometheus.MustRegister(prunedTotal)
+	prometheus.MustRegister(writesTotal)
+}
@@ -0,0 +1,96 @@
+package operator
+
+/*
+Copyright [2019] [autonubil System GmbH]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"reflect"
+
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Namespace label holding the folder for dashboards in dbaas folder mode
+const customerGroupLabel = "customergroup"
+
+// Namespace metadata is only required to place dashboards into folders and
+// for default permissions
+func (npc *grafanaConfigController) needsNamespaces() bool {
+	return npc.options.DbaasFolder || npc.options.FolderTemplate != "" || npc.options.PermissionsEnabled
+}
+
+// Create a new Informer on the Namespaces in the cluster to track their labels.
+func (npc *grafanaConfigController) newNamespaceInformer() (cache.Store, cache.Controller) {
+	return cache.NewInformer(
+		&cache.ListWatch{
+			ListFunc: func(alo metav1.ListOptions) (runtime.Object, error) {
+				return npc.clientSet.CoreV1().Namespaces().List(metav1.ListOptions{IncludeUninitialized: false})
+			},
+			WatchFunc: func(alo metav1.ListOptions) (watch.Interface, error) {
+				return npc.clientSet.CoreV1().Namespaces().Watch(metav1.ListOptions{IncludeUninitialized: false, ResourceVersion: alo.ResourceVersion})
+			},
+		},
+		&corev1.Namespace{},
+		npc.options.ResyncPeriod,
+		cache.ResourceEventHandlerFuncs{
+			UpdateFunc: npc.handleNamespaceUpdate,
+		},
+	)
+}
+
+// Dashboards may have to move to another folder or get other permissions when
+// the labels or annotations of their namespace change.
+func (npc *grafanaConfigController) handleNamespaceUpdate(oldObj, newObj interface{}) {
+	namespace := newObj.(*corev1.Namespace)
+	oldNamespace := oldObj.(*corev1.Namespace)
+	if reflect.DeepEqual(namespace.Labels, oldNamespace.Labels) && reflect.DeepEqual(namespace.Annotations, oldNamespace.Annotations) {
+		return
+	}
+	glog.V(3).Infof("Metadata of Namespace %s changed, requeuing its Config Maps", namespace.Name)
+	for _, obj := range npc.informer.configmapStore.List() {
+		configMap, ok := obj.(*corev1.ConfigMap)
+		if ok && configMap.Namespace == namespace.Name && npc.isWatchedLabel(configMap) {
+			npc.enqueue(configMap)
+		}
+	}
+}
+
+// Get a namespace from the informer cache
+func (npc *grafanaConfigController) getNamespace(name string) (*corev1.Namespace, bool) {
+	if npc.informer.namespaceStore == nil {
+		return nil, false
+	}
+	obj, exists, err := npc.informer.namespaceStore.GetByKey(name)
+	if err != nil || !exists {
+		return nil, false
+	}
+	namespace, ok := obj.(*corev1.Namespace)
+	return namespace, ok
+}
+
+// Folder named after the 'customergroup' label of the ConfigMap's namespace
+func (npc *grafanaConfigController) customerGroupFolderTitle(configMap *corev1.ConfigMap) string {
+	namespace, found := npc.getNamespace(configMap.Namespace)
+	if !found {
+		glog.V(3).Infof("Namespace %s of Config Map %s not found", configMap.Namespace, configMap.Name)
+		return ""
+	}
+	return namespace.Labels[customerGroupLabel]
+}
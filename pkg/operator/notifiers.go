@@ -0,0 +1,165 @@
+package operator
+
+/*
+Copyright [2019] [autonubil System GmbH]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+
+	raven "github.com/getsentry/raven-go"
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	"gitlab.autonubil.net/kubernetes/grafana-config-operator/pkg/apis/grafana/v1alpha1"
+	"gitlab.autonubil.net/kubernetes/grafana-config-operator/pkg/grafana"
+)
+
+// Apply or delete the notification channels of a notifier provisioning file
+func (npc *grafanaConfigController) processNotifierConfigMap(configMap *corev1.ConfigMap, file string, config *grafana.NotifierConfigFile, deleteMode bool) error {
+	if deleteMode {
+		glog.V(2).Infof("Handling Delete Notifiers %s from Config Map: %s/%s", file, configMap.Namespace, configMap.Name)
+	} else {
+		glog.V(2).Infof("Handling Update Notifiers %s from Config Map: %s/%s", file, configMap.Namespace, configMap.Name)
+	}
+	grafanaClient := npc.grafanaClient()
+	tags := map[string]string{"ConfigMap.Namespace": configMap.Namespace, "ConfigMap.Name": configMap.Name, "ConfigMap.File": file}
+	errs := []error{}
+
+	toDelete := config.DeleteNotifiers
+	if deleteMode {
+		for _, notifier := range config.Notifiers {
+			toDelete = append(toDelete, grafana.NotifierRef{Name: notifier.Name, UID: notifier.UID})
+		}
+	}
+	for _, ref := range toDelete {
+		if err := npc.deleteNotifier(grafanaClient, ref, tags); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if deleteMode {
+		return utilerrors.NewAggregate(errs)
+	}
+
+	for _, notifier := range config.Notifiers {
+		if err := npc.applyNotifier(grafanaClient, configMap.Namespace, notifier, tags); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// Find an existing notification channel by uid, or by name if no uid is given
+func findNotifier(grafanaClient *grafana.Client, name string, uid string) (*grafana.AlertNotification, error) {
+	if uid == "" {
+		return grafanaClient.GetAlertNotificationByName(name)
+	}
+	notification, err := grafanaClient.GetAlertNotificationByUID(uid)
+	if grafana.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &notification, nil
+}
+
+// Create or update a single notification channel
+func (npc *grafanaConfigController) applyNotifier(grafanaClient *grafana.Client, namespace string, notifier grafana.Notifier, tags map[string]string) error {
+	secureSettings, err := npc.resolveNotifierSecureSettings(namespace, notifier)
+	if err != nil {
+		glog.Errorf("Failed to resolve secure settings of notifier %s (%v)", notifier.Name, err)
+		return err
+	}
+	desired := notifier.AlertNotification(secureSettings)
+
+	existing, err := findNotifier(grafanaClient, notifier.Name, notifier.UID)
+	if err != nil {
+		glog.Errorf("Failed to check for existing notifier %s (%#v)", notifier.Name, err)
+		raven.CaptureError(err, npc.ravenTags(tags, "GetAlertNotification", "Notifier.Name", notifier.Name))
+		return err
+	}
+	if existing == nil {
+		if _, err := grafanaClient.CreateAlertNotification(desired); err != nil {
+			glog.Errorf("Failed to create notifier %s (%#v)", notifier.Name, err)
+			raven.CaptureError(err, npc.ravenTags(tags, "CreateAlertNotification", "Notifier.Name", notifier.Name))
+			return err
+		}
+		glog.V(1).Infof("Created Notifier %s", notifier.Name)
+		raven.Capture(&raven.Packet{Level: raven.INFO, Message: "Created Notifier"}, npc.ravenTags(tags, "CreateAlertNotification", "Notifier.Name", notifier.Name))
+		return nil
+	}
+
+	desired.ID = existing.ID
+	desired.UID = existing.UID
+	if _, err := grafanaClient.UpdateAlertNotification(desired); err != nil {
+		glog.Errorf("Failed to update notifier %s (%#v)", notifier.Name, err)
+		raven.CaptureError(err, npc.ravenTags(tags, "UpdateAlertNotification", "Notifier.Name", notifier.Name))
+		return err
+	}
+	glog.V(1).Infof("Updated Notifier %s", notifier.Name)
+	return nil
+}
+
+// Delete a notification channel if it exists
+func (npc *grafanaConfigController) deleteNotifier(grafanaClient *grafana.Client, ref grafana.NotifierRef, tags map[string]string) error {
+	existing, err := findNotifier(grafanaClient, ref.Name, ref.UID)
+	if err != nil {
+		glog.Errorf("Failed to check for existing notifier %s (%#v)", ref.Name, err)
+		raven.CaptureError(err, npc.ravenTags(tags, "GetAlertNotification", "Notifier.Name", ref.Name, "Notifier.UID", ref.UID))
+		return err
+	}
+	if existing == nil {
+		glog.V(4).Infof("Notifier %s (%s) does not exist", ref.Name, ref.UID)
+		return nil
+	}
+	if _, err := grafanaClient.DeleteAlertNotification(existing.UID); err != nil && !grafana.IsNotFound(err) {
+		glog.Errorf("Failed to delete notifier %s (%#v)", existing.Name, err)
+		raven.CaptureError(err, npc.ravenTags(tags, "DeleteAlertNotification", "Notifier.Name", existing.Name, "Notifier.UID", existing.UID))
+		return err
+	}
+	glog.V(1).Infof("Deleted Notifier %s", existing.Name)
+	raven.Capture(&raven.Packet{Level: raven.INFO, Message: "Deleted Notifier"}, npc.ravenTags(tags, "DeleteAlertNotification", "Notifier.Name", existing.Name))
+	return nil
+}
+
+// Read the secure settings of a notifier, taking referenced values from
+// Secrets in the namespace of the ConfigMap
+func (npc *grafanaConfigController) resolveNotifierSecureSettings(namespace string, notifier grafana.Notifier) (map[string]string, error) {
+	if len(notifier.SecureSettings) == 0 {
+		return nil, nil
+	}
+	settings := make(map[string]string, len(notifier.SecureSettings))
+	for key, secureValue := range notifier.SecureSettings {
+		value := &v1alpha1.SecretValue{Value: secureValue.Value}
+		if ref := secureValue.SecretKeyRef; ref != nil {
+			optional := ref.Optional
+			value.SecretKeyRef = &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: ref.Name},
+				Key:                  ref.Key,
+				Optional:             &optional,
+			}
+		}
+		resolved, found, err := npc.resolveSecretValue(namespace, value)
+		if err != nil {
+			return nil, fmt.Errorf("secure_settings.%s: %v", key, err)
+		}
+		if found {
+			settings[key] = resolved
+		}
+	}
+	return settings, nil
+}
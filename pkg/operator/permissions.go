@@ -0,0 +1,512 @@
+package operator
+
+/*
+Copyright [2019] [autonubil System GmbH]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	raven "github.com/getsentry/raven-go"
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+
+	"gitlab.autonubil.net/kubernetes/grafana-config-operator/pkg/grafana"
+	"gitlab.autonubil.net/kubernetes/grafana-config-operator/pkg/utils"
+)
+
+const (
+	// ConfigMap or Namespace annotation with the permissions of the folder of
+	// the dashboards, e.g. 'team:ops=Edit, user:jane=View, role:Viewer=View'
+	folderPermissionsAnnotation = "grafana.autonubil.net/folder-permissions"
+	// ConfigMap or Namespace annotation with the permissions of the dashboards
+	dashboardPermissionsAnnotation = "grafana.autonubil.net/dashboard-permissions"
+)
+
+// A single permission granted to a team, user or role
+type permissionGrant struct {
+	kind       string
+	name       string
+	permission grafana.PermissionType
+}
+
+// Parse a list of grants like 'team:ops=Edit, user:jane=View, role:Viewer=View'.
+// Entries are separated by commas or newlines.
+func parsePermissions(text string) ([]permissionGrant, error) {
+	grants := []permissionGrant{}
+	entries := strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == '\n' })
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		eq := strings.LastIndex(entry, "=")
+		colon := strings.Index(entry, ":")
+		if eq < 0 || colon < 0 || colon > eq {
+			return nil, fmt.Errorf("invalid permission '%s', expected <team|user|role>:<name>=<View|Edit|Admin>", entry)
+		}
+		grant, err := newPermissionGrant(entry[:colon], entry[colon+1:eq], entry[eq+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid permission '%s': %v", entry, err)
+		}
+		grants = append(grants, grant)
+	}
+	return grants, nil
+}
+
+// Validate a single grant
+func newPermissionGrant(kind string, name string, permission string) (permissionGrant, error) {
+	grant := permissionGrant{
+		kind: strings.ToLower(strings.TrimSpace(kind)),
+		name: strings.TrimSpace(name),
+	}
+	if grant.name == "" {
+		return grant, fmt.Errorf("missing name")
+	}
+	switch grant.kind {
+	case "team", "user":
+	case "role":
+		switch grant.name {
+		case "Viewer", "Editor":
+		default:
+			return grant, fmt.Errorf("role must be Viewer or Editor")
+		}
+	default:
+		return grant, fmt.Errorf("unknown kind '%s'", grant.kind)
+	}
+	var err error
+	grant.permission, err = grafana.ParsePermissionType(permission)
+	return grant, err
+}
+
+// Parse the principals a ConfigMap may grant permissions to, like
+// 'team:*, role:Viewer'. An empty list allows all principals.
+func parsePrincipalPatterns(text string) ([]string, error) {
+	patterns := []string{}
+	for _, pattern := range strings.Split(text, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern == "" {
+			continue
+		}
+		colon := strings.Index(pattern, ":")
+		if colon < 0 {
+			return nil, fmt.Errorf("invalid principal '%s', expected <team|user|role>:<name or *>", pattern)
+		}
+		switch kind := strings.ToLower(pattern[:colon]); kind {
+		case "team", "user", "role":
+			patterns = append(patterns, kind+pattern[colon:])
+		default:
+			return nil, fmt.Errorf("invalid principal '%s': unknown kind '%s'", pattern, kind)
+		}
+	}
+	return patterns, nil
+}
+
+// Check grants against the highest permission and the principals ConfigMaps
+// may grant
+func checkGrants(grants []permissionGrant, maxPermission grafana.PermissionType, principals []string) error {
+	for _, grant := range grants {
+		if grant.permission > maxPermission {
+			return fmt.Errorf("permission of %s:%s exceeds the allowed %s", grant.kind, grant.name, maxPermission)
+		}
+		if len(principals) == 0 {
+			continue
+		}
+		allowed := false
+		for _, pattern := range principals {
+			if pattern == grant.kind+":*" || pattern == grant.kind+":"+grant.name {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("permissions may not be granted to %s:%s", grant.kind, grant.name)
+		}
+	}
+	return nil
+}
+
+// Permissions declared for a ConfigMap, either by its own annotation or by the
+// annotation of its namespace. Returns false if nothing is declared.
+func (npc *grafanaConfigController) declaredPermissions(configMap *corev1.ConfigMap, annotation string) (string, bool) {
+	if text, ok := configMap.Annotations[annotation]; ok {
+		return text, true
+	}
+	if namespace, found := npc.getNamespace(configMap.Namespace); found {
+		if text, ok := namespace.Annotations[annotation]; ok {
+			return text, true
+		}
+	}
+	return "", false
+}
+
+// Resolve the teams and users of grants to their grafana ids
+func resolvePermissions(grafanaClient *grafana.Client, grants []permissionGrant) ([]grafana.PermissionItem, error) {
+	items := []grafana.PermissionItem{}
+	for _, grant := range grants {
+		item := grafana.PermissionItem{Permission: grant.permission}
+		switch grant.kind {
+		case "team":
+			team, err := grafanaClient.GetTeamByName(grant.name)
+			if err != nil {
+				return nil, err
+			}
+			if team == nil {
+				return nil, fmt.Errorf("team '%s' not found", grant.name)
+			}
+			item.TeamID = team.ID
+		case "user":
+			user, err := grafanaClient.LookupUser(grant.name)
+			if err != nil {
+				return nil, fmt.Errorf("user '%s' not found (%v)", grant.name, err)
+			}
+			item.UserID = user.ID
+		case "role":
+			item.Role = grant.name
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// Identifies the team, user or role of a permission
+func permissionPrincipal(item grafana.PermissionItem) string {
+	switch {
+	case item.TeamID != 0:
+		return fmt.Sprintf("team:%d", item.TeamID)
+	case item.UserID != 0:
+		return fmt.Sprintf("user:%d", item.UserID)
+	}
+	return "role:" + item.Role
+}
+
+// Compute the access control list from the current entries and the desired
+// ones. In strict mode the desired entries replace the list, otherwise
+// entries of principals that are not managed by the operator are kept.
+// Inherited entries are never part of the result.
+func mergePermissions(current []grafana.Permission, desired []grafana.PermissionItem, managed map[string]bool, strict bool) []grafana.PermissionItem {
+	merged := []grafana.PermissionItem{}
+	declared := make(map[string]bool, len(desired))
+	for _, item := range desired {
+		declared[permissionPrincipal(item)] = true
+	}
+	if !strict {
+		for _, permission := range current {
+			if permission.Inherited {
+				continue
+			}
+			principal := permissionPrincipal(permission.Item())
+			if !declared[principal] && !managed[principal] {
+				merged = append(merged, permission.Item())
+			}
+		}
+	}
+	merged = append(merged, desired...)
+	return merged
+}
+
+// Whether the explicit entries of an access control list match the items
+func permissionsEqual(current []grafana.Permission, items []grafana.PermissionItem) bool {
+	key := func(item grafana.PermissionItem) string {
+		return fmt.Sprintf("%s=%d", permissionPrincipal(item), item.Permission)
+	}
+	have := []string{}
+	for _, permission := range current {
+		if !permission.Inherited {
+			have = append(have, key(permission.Item()))
+		}
+	}
+	want := []string{}
+	for _, item := range items {
+		want = append(want, key(item))
+	}
+	if len(have) != len(want) {
+		return false
+	}
+	sort.Strings(have)
+	sort.Strings(want)
+	for i := range have {
+		if have[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Add the principals of the grants in text to managed
+func addManagedPrincipals(grafanaClient *grafana.Client, text string, managed map[string]bool) {
+	if grants, err := parsePermissions(text); err == nil {
+		if items, err := resolvePermissions(grafanaClient, grants); err == nil {
+			for _, item := range items {
+				managed[permissionPrincipal(item)] = true
+			}
+		}
+	}
+}
+
+// Desired permissions of a ConfigMap together with the principals that were
+// granted permissions by the previously applied state of the ConfigMap, as
+// known in memory or recorded in the state ConfigMap of the operator. The
+// latter are removed in non-strict mode once they are no longer declared.
+func (npc *grafanaConfigController) permissionItems(grafanaClient *grafana.Client, configMap *corev1.ConfigMap, annotation string) ([]grafana.PermissionItem, map[string]bool, bool, error) {
+	managed := make(map[string]bool)
+	if key, err := cache.MetaNamespaceKeyFunc(configMap); err == nil {
+		if previous, found := npc.getLastApplied(key); found {
+			if text, declared := npc.declaredPermissions(previous, annotation); declared {
+				addManagedPrincipals(grafanaClient, text, managed)
+			}
+		}
+		if text, found := npc.getAppliedPermissions(key)[annotation]; found {
+			addManagedPrincipals(grafanaClient, text, managed)
+		}
+	}
+
+	text, declared := npc.declaredPermissions(configMap, annotation)
+	if !declared {
+		// nothing to do, unless the operator has to revoke what it granted before
+		return nil, managed, len(managed) > 0 && !npc.options.PermissionsStrict, nil
+	}
+	grants, err := parsePermissions(text)
+	if err == nil {
+		err = checkGrants(grants, npc.permissionsMaxLevel, npc.permissionsPrincipals)
+	}
+	if err != nil {
+		return nil, managed, false, err
+	}
+	items, err := resolvePermissions(grafanaClient, grants)
+	return items, managed, err == nil, err
+}
+
+// Apply the folder and dashboard permissions declared for a ConfigMap after
+// the dashboard has been saved.
+func (npc *grafanaConfigController) applyPermissions(configMap *corev1.ConfigMap, file string, board *grafana.Board, folderID uint, dashboardID uint) error {
+	if !npc.options.PermissionsEnabled {
+		return nil
+	}
+	grafanaClient := npc.grafanaClient()
+
+	// Folder
+	desired, managed, apply, err := npc.permissionItems(grafanaClient, configMap, folderPermissionsAnnotation)
+	if err != nil {
+		glog.Errorf("Invalid folder permissions for Config Map: %s/%s (%v)", configMap.Namespace, configMap.Name, err)
+		raven.CaptureError(err, map[string]string{"operation": "resolvePermissions", "ConfigMap.Namespace": configMap.Namespace, "ConfigMap.Name": configMap.Name, "ConfigMap.File": file, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+		return err
+	}
+	if apply && folderID == 0 {
+		glog.Warningf("Cannot set folder permissions of the General folder for Config Map: %s/%s %s", configMap.Namespace, configMap.Name, file)
+	} else if apply {
+		folder, err := grafanaClient.GetFolderByID(folderID)
+		if err == nil {
+			err = npc.updatePermissions(
+				func() ([]grafana.Permission, error) { return grafanaClient.GetFolderPermissions(folder.UID) },
+				func(items []grafana.PermissionItem) (grafana.StatusMessage, error) {
+					return grafanaClient.UpdateFolderPermissions(folder.UID, items)
+				},
+				desired, managed)
+		}
+		if err != nil {
+			glog.Errorf("Failed to update permissions of folder %d for Config Map: %s/%s %s (%#v)", folderID, configMap.Namespace, configMap.Name, file, err)
+			raven.CaptureError(err, map[string]string{"operation": "UpdateFolderPermissions", "ConfigMap.Namespace": configMap.Namespace, "ConfigMap.Name": configMap.Name, "ConfigMap.File": file, "Folder.Name": folder.Title, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+			return err
+		}
+		glog.V(3).Infof("Applied permissions of folder %s for Config Map: %s/%s %s", folder.Title, configMap.Namespace, configMap.Name, file)
+	}
+
+	// Dashboard
+	desired, managed, apply, err = npc.permissionItems(grafanaClient, configMap, dashboardPermissionsAnnotation)
+	if err != nil {
+		glog.Errorf("Invalid dashboard permissions for Config Map: %s/%s (%v)", configMap.Namespace, configMap.Name, err)
+		raven.CaptureError(err, map[string]string{"operation": "resolvePermissions", "ConfigMap.Namespace": configMap.Namespace, "ConfigMap.Name": configMap.Name, "ConfigMap.File": file, "Board.Name": board.Title, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+		return err
+	}
+	if apply {
+		err = npc.updatePermissions(
+			func() ([]grafana.Permission, error) { return grafanaClient.GetDashboardPermissions(dashboardID) },
+			func(items []grafana.PermissionItem) (grafana.StatusMessage, error) {
+				return grafanaClient.UpdateDashboardPermissions(dashboardID, items)
+			},
+			desired, managed)
+		if err != nil {
+			glog.Errorf("Failed to update permissions of dashboard %s from Config Map: %s/%s %s (%#v)", board.Title, configMap.Namespace, configMap.Name, file, err)
+			raven.CaptureError(err, map[string]string{"operation": "UpdateDashboardPermissions", "ConfigMap.Namespace": configMap.Namespace, "ConfigMap.Name": configMap.Name, "ConfigMap.File": file, "Board.Name": board.Title, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+			return err
+		}
+		glog.V(3).Infof("Applied permissions of dashboard %s from Config Map: %s/%s %s", board.Title, configMap.Namespace, configMap.Name, file)
+	}
+	return nil
+}
+
+// Record the permissions applied for a dashboard ConfigMap in the state
+// ConfigMap of the operator, so they are still known to be managed by the
+// operator after a restart. Called once the ConfigMap has been applied
+// successfully.
+func (npc *grafanaConfigController) recordAppliedPermissions(configMap *corev1.ConfigMap) {
+	if !npc.options.PermissionsEnabled || npc.options.DashboardLabel == "" || !utils.IsConfigMapLabeled(configMap, npc.options.DashboardLabel) {
+		return
+	}
+	key, err := cache.MetaNamespaceKeyFunc(configMap)
+	if err != nil {
+		return
+	}
+	applied := map[string]string{}
+	for _, annotation := range []string{folderPermissionsAnnotation, dashboardPermissionsAnnotation} {
+		if text, declared := npc.declaredPermissions(configMap, annotation); declared {
+			applied[annotation] = text
+		}
+	}
+	npc.setAppliedPermissions(key, applied)
+}
+
+// Forget the permissions applied for a deleted ConfigMap
+func (npc *grafanaConfigController) removeAppliedPermissions(key string) {
+	if !npc.options.PermissionsEnabled {
+		return
+	}
+	npc.setAppliedPermissions(key, map[string]string{})
+}
+
+func (npc *grafanaConfigController) getAppliedPermissions(key string) map[string]string {
+	npc.appliedPermissionsLock.Lock()
+	defer npc.appliedPermissionsLock.Unlock()
+	return npc.appliedPermissions[key]
+}
+
+// Remember the permissions applied for a ConfigMap and write them to the
+// state ConfigMap if they changed.
+func (npc *grafanaConfigController) setAppliedPermissions(key string, applied map[string]string) {
+	npc.appliedPermissionsLock.Lock()
+	defer npc.appliedPermissionsLock.Unlock()
+	if reflect.DeepEqual(npc.appliedPermissions[key], applied) || (len(applied) == 0 && len(npc.appliedPermissions[key]) == 0) {
+		return
+	}
+	if len(applied) == 0 {
+		delete(npc.appliedPermissions, key)
+	} else {
+		npc.appliedPermissions[key] = applied
+	}
+	if npc.options.PermissionsState == "" {
+		return
+	}
+	if err := npc.saveAppliedPermissions(key, applied); err != nil {
+		glog.Errorf("Failed to record the applied permissions of Config Map %s in %s (%v)", key, npc.options.PermissionsState, err)
+		raven.CaptureError(err, map[string]string{"operation": "saveAppliedPermissions", "ConfigMap.Key": key, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+		return
+	}
+	glog.V(3).Infof("Recorded the applied permissions of Config Map %s in %s", key, npc.options.PermissionsState)
+}
+
+// Data key of a ConfigMap in the state ConfigMap. Namespaces and names can not
+// contain underscores.
+func appliedPermissionsDataKey(key string) string {
+	return strings.Replace(key, "/", "_", 1)
+}
+
+// Namespace and name of the permissions state ConfigMap
+func (npc *grafanaConfigController) permissionsStateRef() (string, string, error) {
+	return stateConfigMapRef(npc.options.PermissionsState, npc.namespace)
+}
+
+// Namespace and name of a ConfigMap owned by the operator given as
+// <namespace>/<name>, or as name in the watched namespace
+func stateConfigMapRef(ref string, defaultNamespace string) (string, string, error) {
+	namespace, name := defaultNamespace, ref
+	if slash := strings.Index(ref, "/"); slash >= 0 {
+		namespace, name = ref[:slash], ref[slash+1:]
+	}
+	if namespace == "" || name == "" {
+		return "", "", fmt.Errorf("invalid state Config Map '%s', expected <namespace>/<name>", ref)
+	}
+	return namespace, name, nil
+}
+
+// Write the permissions applied for a ConfigMap to the state ConfigMap, which
+// is created if it does not exist yet.
+func (npc *grafanaConfigController) saveAppliedPermissions(key string, applied map[string]string) error {
+	namespace, name, err := npc.permissionsStateRef()
+	if err != nil {
+		return err
+	}
+	var value interface{} // removes the key
+	if len(applied) > 0 {
+		raw, err := json.Marshal(applied)
+		if err != nil {
+			return err
+		}
+		value = string(raw)
+	}
+	patch, err := json.Marshal(map[string]interface{}{"data": map[string]interface{}{appliedPermissionsDataKey(key): value}})
+	if err != nil {
+		return err
+	}
+	configMaps := npc.clientSet.CoreV1().ConfigMaps(namespace)
+	_, err = configMaps.Patch(name, types.MergePatchType, patch)
+	if !apierrors.IsNotFound(err) || value == nil {
+		return err
+	}
+	_, err = configMaps.Create(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Data:       map[string]string{appliedPermissionsDataKey(key): value.(string)},
+	})
+	return err
+}
+
+// Load the permissions applied before a restart from the state ConfigMap
+func (npc *grafanaConfigController) loadAppliedPermissions() error {
+	namespace, name, err := npc.permissionsStateRef()
+	if err != nil {
+		return err
+	}
+	state, err := npc.clientSet.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	npc.appliedPermissionsLock.Lock()
+	defer npc.appliedPermissionsLock.Unlock()
+	for dataKey, raw := range state.Data {
+		applied := map[string]string{}
+		if err := json.Unmarshal([]byte(raw), &applied); err != nil {
+			glog.Warningf("Ignoring invalid applied permissions %s in %s/%s (%v)", dataKey, namespace, name, err)
+			continue
+		}
+		npc.appliedPermissions[strings.Replace(dataKey, "_", "/", 1)] = applied
+	}
+	glog.V(2).Infof("Loaded the applied permissions of %d Config Maps from %s/%s", len(npc.appliedPermissions), namespace, name)
+	return nil
+}
+
+// Merge the desired permissions into the current access control list and
+// write it back if anything changed.
+func (npc *grafanaConfigController) updatePermissions(get func() ([]grafana.Permission, error), update func([]grafana.PermissionItem) (grafana.StatusMessage, error), desired []grafana.PermissionItem, managed map[string]bool) error {
+	current, err := get()
+	if err != nil {
+		return err
+	}
+	merged := mergePermissions(current, desired, managed, npc.options.PermissionsStrict)
+	if permissionsEqual(current, merged) {
+		return nil
+	}
+	_, err = update(merged)
+	return err
+}
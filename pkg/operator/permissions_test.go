@@ -0,0 +1,196 @@
+package operator
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"gitlab.autonubil.net/kubernetes/grafana-config-operator/pkg/grafana"
+)
+
+func TestParsePermissions(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    []permissionGrant
+		wantErr string
+	}{
+		{text: "", want: []permissionGrant{}},
+		{
+			text: "team:ops=Edit, user:jane=View, role:Viewer=View",
+			want: []permissionGrant{
+				{kind: "team", name: "ops", permission: grafana.PermissionEdit},
+				{kind: "user", name: "jane", permission: grafana.PermissionView},
+				{kind: "role", name: "Viewer", permission: grafana.PermissionView},
+			},
+		},
+		{
+			text: "Team: Site Reliability = admin\nuser:jane@example.com=edit\n\n",
+			want: []permissionGrant{
+				{kind: "team", name: "Site Reliability", permission: grafana.PermissionAdmin},
+				{kind: "user", name: "jane@example.com", permission: grafana.PermissionEdit},
+			},
+		},
+		{
+			// user names may contain '=' and ':', the last '=' separates the permission
+			text: "user:a=b:c=View",
+			want: []permissionGrant{{kind: "user", name: "a=b:c", permission: grafana.PermissionView}},
+		},
+		{text: "team:ops", wantErr: "expected <team|user|role>:<name>=<View|Edit|Admin>"},
+		{text: "ops=Edit", wantErr: "expected <team|user|role>:<name>=<View|Edit|Admin>"},
+		{text: "group:ops=Edit", wantErr: "unknown kind 'group'"},
+		{text: "team:=Edit", wantErr: "missing name"},
+		{text: "role:Admin=Admin", wantErr: "role must be Viewer or Editor"},
+		{text: "team:ops=Owner", wantErr: "unknown permission 'Owner'"},
+		{text: "team:ops=Edit, team:dev=Read", wantErr: "invalid permission 'team:dev=Read'"},
+	}
+	for _, test := range tests {
+		got, err := parsePermissions(test.text)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("parsePermissions(%q) error = %v, want %q", test.text, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parsePermissions(%q) unexpected error: %v", test.text, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parsePermissions(%q) = %+v, want %+v", test.text, got, test.want)
+		}
+	}
+}
+
+func TestCheckGrants(t *testing.T) {
+	tests := []struct {
+		text       string
+		principals string
+		wantErr    string
+	}{
+		{text: "team:ops=Edit, user:jane=View, role:Viewer=View"},
+		{text: "team:ops=Admin", wantErr: "permission of team:ops exceeds the allowed Edit"},
+		{text: "team:ops=Edit, role:Viewer=View", principals: "team:*, Role:Viewer"},
+		{text: "team:ops=Edit, user:jane=View", principals: "team:*, role:Viewer", wantErr: "may not be granted to user:jane"},
+		{text: "team:ops=Edit", principals: "team:dev", wantErr: "may not be granted to team:ops"},
+	}
+	for _, test := range tests {
+		grants, err := parsePermissions(test.text)
+		if err != nil {
+			t.Fatalf("parsePermissions(%q) unexpected error: %v", test.text, err)
+		}
+		principals, err := parsePrincipalPatterns(test.principals)
+		if err != nil {
+			t.Fatalf("parsePrincipalPatterns(%q) unexpected error: %v", test.principals, err)
+		}
+		err = checkGrants(grants, grafana.PermissionEdit, principals)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("checkGrants(%q, %q) error = %v, want %q", test.text, test.principals, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("checkGrants(%q, %q) unexpected error: %v", test.text, test.principals, err)
+		}
+	}
+
+	if _, err := parsePrincipalPatterns("group:*"); err == nil || !strings.Contains(err.Error(), "unknown kind 'group'") {
+		t.Errorf("parsePrincipalPatterns(group:*) error = %v, want an unknown kind", err)
+	}
+}
+
+func TestMergePermissions(t *testing.T) {
+	current := []grafana.Permission{
+		{Role: "Viewer", Permission: grafana.PermissionView},
+		{Role: "Editor", Permission: grafana.PermissionEdit},
+		{TeamID: 1, Permission: grafana.PermissionView},
+		{TeamID: 2, Permission: grafana.PermissionEdit},
+		{UserID: 9, Permission: grafana.PermissionAdmin, Inherited: true},
+	}
+	tests := []struct {
+		name    string
+		desired []grafana.PermissionItem
+		managed map[string]bool
+		strict  bool
+		want    []string
+	}{
+		{
+			name:    "declared entries are added and unmanaged ones kept",
+			desired: []grafana.PermissionItem{{UserID: 5, Permission: grafana.PermissionEdit}},
+			want:    []string{"role:Editor=2", "role:Viewer=1", "team:1=1", "team:2=2", "user:5=2"},
+		},
+		{
+			name:    "declared entries replace the current ones of the same principal",
+			desired: []grafana.PermissionItem{{TeamID: 1, Permission: grafana.PermissionAdmin}},
+			want:    []string{"role:Editor=2", "role:Viewer=1", "team:1=4", "team:2=2"},
+		},
+		{
+			name:    "entries the operator granted before are revoked",
+			desired: []grafana.PermissionItem{{TeamID: 1, Permission: grafana.PermissionView}},
+			managed: map[string]bool{"team:2": true, "team:1": true},
+			want:    []string{"role:Editor=2", "role:Viewer=1", "team:1=1"},
+		},
+		{
+			name:    "strict mode replaces the list",
+			desired: []grafana.PermissionItem{{TeamID: 2, Permission: grafana.PermissionView}},
+			strict:  true,
+			want:    []string{"team:2=1"},
+		},
+		{
+			name:   "strict mode without declared entries clears the list",
+			strict: true,
+			want:   []string{},
+		},
+	}
+	for _, test := range tests {
+		merged := mergePermissions(current, test.desired, test.managed, test.strict)
+		got := []string{}
+		for _, item := range merged {
+			got = append(got, fmt.Sprintf("%s=%d", permissionPrincipal(item), item.Permission))
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: mergePermissions = %v, want %v", test.name, got, test.want)
+		}
+		// inherited entries are never sent back
+		for _, item := range merged {
+			if item.UserID == 9 {
+				t.Errorf("%s: inherited entry in result", test.name)
+			}
+		}
+	}
+}
+
+func TestPermissionsEqual(t *testing.T) {
+	current := []grafana.Permission{
+		{TeamID: 1, Permission: grafana.PermissionView},
+		{Role: "Viewer", Permission: grafana.PermissionView},
+		{UserID: 9, Permission: grafana.PermissionAdmin, Inherited: true},
+	}
+	tests := []struct {
+		name  string
+		items []grafana.PermissionItem
+		equal bool
+	}{
+		{
+			name:  "same entries in another order",
+			items: []grafana.PermissionItem{{Role: "Viewer", Permission: grafana.PermissionView}, {TeamID: 1, Permission: grafana.PermissionView}},
+			equal: true,
+		},
+		{
+			name:  "changed permission",
+			items: []grafana.PermissionItem{{Role: "Viewer", Permission: grafana.PermissionView}, {TeamID: 1, Permission: grafana.PermissionEdit}},
+		},
+		{
+			name:  "missing entry",
+			items: []grafana.PermissionItem{{TeamID: 1, Permission: grafana.PermissionView}},
+		},
+	}
+	for _, test := range tests {
+		if got := permissionsEqual(current, test.items); got != test.equal {
+			t.Errorf("%s: permissionsEqual = %t, want %t", test.name, got, test.equal)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package operator
+
+/*
+Copyright [2019] [autonubil System GmbH]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	raven "github.com/getsentry/raven-go"
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	"gitlab.autonubil.net/kubernetes/grafana-config-operator/pkg/grafana"
+)
+
+const (
+	// ConfigMap annotation to exclude its objects from garbage collection
+	pruneAnnotation = "grafana.autonubil.net/prune"
+
+	ownerName = "grafana-config-operator"
+	// Tag added to dashboards created by the operator
+	ownerTag = "managed-by:" + ownerName
+	// jsonData key added to datasources created by the operator
+	ownerJSONDataKey = "managedBy"
+	// Prefix of the uid of folders created by the operator
+	ownedFolderUIDPrefix = "gco-"
+
+	pruneKindDashboard  = "dashboard"
+	pruneKindDatasource = "datasource"
+	pruneKindFolder     = "folder"
+)
+
+// Objects of a ConfigMap are marked as owned (and hence garbage collected) unless
+// the ConfigMap opts out with the prune annotation.
+func (npc *grafanaConfigController) isPrunable(configMap *corev1.ConfigMap) bool {
+	value, exists := configMap.Annotations[pruneAnnotation]
+	if !exists {
+		return true
+	}
+	prunable, err := strconv.ParseBool(value)
+	if err != nil {
+		glog.Warningf("Invalid value '%s' for annotation %s on Config Map: %s/%s", value, pruneAnnotation, configMap.Namespace, configMap.Name)
+		return true
+	}
+	return prunable
+}
+
+// Stable uid for folders created by the operator, which marks them as owned.
+func ownedFolderUID(title string) string {
+	sum := sha1.Sum([]byte(title))
+	return ownedFolderUIDPrefix + hex.EncodeToString(sum[:])[:16]
+}
+
+// Everything that is currently declared by the watched ConfigMaps. Folders are
+// keyed by their path, which includes the folders above.
+type desiredObjects struct {
+	dashboardUIDs   map[string]bool
+	dashboardTitles map[string]bool
+	datasources     map[string]bool
+	folders         map[string]bool
+}
+
+func (desired *desiredObjects) addFolderPath(path []string) {
+	for i := range path {
+		desired.folders[strings.Join(path[:i+1], "/")] = true
+	}
+}
+
+func (npc *grafanaConfigController) desiredObjects() (*desiredObjects, error) {
+	desired := &desiredObjects{
+		dashboardUIDs:   make(map[string]bool),
+		dashboardTitles: make(map[string]bool),
+		datasources:     make(map[string]bool),
+		folders:         make(map[string]bool),
+	}
+	errs := []error{}
+	for _, obj := range npc.informer.configmapStore.List() {
+		configMap, ok := obj.(*corev1.ConfigMap)
+		if !ok || !npc.isWatchedLabel(configMap) {
+			continue
+		}
+		entries, err := npc.parseConfigMap(configMap)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s/%s: %v", configMap.Namespace, configMap.Name, err))
+		}
+		for _, entry := range entries {
+			if entry.datasources != nil {
+				for _, ds := range entry.datasources.Datasources {
+					desired.datasources[ds.Name] = true
+				}
+			}
+			if entry.alerting != nil {
+				// deleting a folder deletes its alert rules
+				for _, group := range entry.alerting.Groups {
+					desired.addFolderPath(npc.folderPath(group.Folder))
+				}
+			}
+			if entry.board != nil {
+				if entry.board.UID != "" {
+					desired.dashboardUIDs[entry.board.UID] = true
+				}
+				desired.dashboardTitles[entry.board.Title] = true
+				folder, err := npc.dashboardFolderTitle(configMap, entry.file)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s/%s: %s: %v", configMap.Namespace, configMap.Name, entry.file, err))
+					continue
+				}
+				desired.addFolderPath(npc.folderPath(folder))
+			}
+		}
+	}
+	return desired, utilerrors.NewAggregate(errs)
+}
+
+// Delete all owned grafana objects that are no longer declared by any ConfigMap.
+func (npc *grafanaConfigController) prune() {
+	desired, err := npc.desiredObjects()
+	if err != nil {
+		// an unparseable ConfigMap would look like its objects were removed
+		glog.Warningf("Skipping garbage collection, not all Config Maps could be parsed: %v", err)
+		return
+	}
+
+	glog.V(3).Infof("Collecting orphaned grafana objects (dry run: %t)", npc.options.PruneDryRun)
+	grafanaClient := npc.grafanaClient()
+	if npc.options.DashboardLabel != "" {
+		npc.pruneDashboards(grafanaClient, desired)
+		npc.pruneFolders(grafanaClient, desired)
+	}
+	if npc.options.DatasourceLabel != "" {
+		npc.pruneDatasources(grafanaClient, desired)
+	}
+}
+
+func (npc *grafanaConfigController) pruneDashboards(grafanaClient *grafana.Client, desired *desiredObjects) {
+	boards, err := grafanaClient.SearchDashboards("", false, ownerTag)
+	if err != nil {
+		glog.Errorf("Failed to list owned dashboards (%#v)", err)
+		raven.CaptureError(err, map[string]string{"operation": "SearchDashboards", "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+		return
+	}
+	for _, board := range boards {
+		if board.UID == "" || desired.dashboardUIDs[board.UID] || desired.dashboardTitles[board.Title] {
+			continue
+		}
+		if npc.options.PruneDryRun {
+			glog.V(1).Infof("Would delete orphaned Dashboard %s (%s)", board.Title, board.UID)
+			continue
+		}
+		if _, err := grafanaClient.DeleteDashboard(board.UID); err != nil {
+			glog.Errorf("Failed to delete orphaned Dashboard %s (%s) (%#v)", board.Title, board.UID, err)
+			raven.CaptureError(err, map[string]string{"operation": "DeleteDashboard", "Board.Name": board.Title, "Board.UID": board.UID, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+			continue
+		}
+		glog.V(1).Infof("Deleted orphaned Dashboard %s (%s)", board.Title, board.UID)
+		raven.Capture(&raven.Packet{Level: raven.INFO, Message: "Deleted orphaned Dashboard"}, map[string]string{"operation": "DeleteDashboard", "Board.Name": board.Title, "Board.UID": board.UID, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+		prunedTotal.WithLabelValues(pruneKindDashboard).Inc()
+	}
+}
+
+func (npc *grafanaConfigController) pruneFolders(grafanaClient *grafana.Client, desired *desiredObjects) {
+	if _, err := npc.pruneFolderTree(grafanaClient, desired, "", ""); err != nil {
+		glog.Errorf("Failed to list folders (%#v)", err)
+		raven.CaptureError(err, map[string]string{"operation": "GetFolders", "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+	}
+}
+
+// Walk the folders below a parent depth first and delete the orphaned ones.
+// Returns whether all folders below the parent are gone.
+func (npc *grafanaConfigController) pruneFolderTree(grafanaClient *grafana.Client, desired *desiredObjects, parentUID string, parentPath string) (bool, error) {
+	folders, err := grafanaClient.GetFolders(parentUID)
+	if err != nil {
+		return false, err
+	}
+	empty := true
+	for _, folder := range folders {
+		// grafana versions without nested folders ignore the parent
+		if folder.ParentUID != parentUID {
+			continue
+		}
+		path := folder.Title
+		if parentPath != "" {
+			path = parentPath + "/" + folder.Title
+		}
+		if !npc.pruneFolder(grafanaClient, desired, folder, path) {
+			empty = false
+		}
+	}
+	return empty, nil
+}
+
+// Delete a folder created by the operator that is no longer declared, unless
+// it still contains dashboards or subfolders. Returns whether the folder is
+// gone (or would be in a dry run).
+func (npc *grafanaConfigController) pruneFolder(grafanaClient *grafana.Client, desired *desiredObjects, folder grafana.Folder, path string) bool {
+	subfoldersGone := true
+	if npc.options.NestedFolders {
+		var err error
+		if subfoldersGone, err = npc.pruneFolderTree(grafanaClient, desired, folder.UID, path); err != nil {
+			glog.Errorf("Failed to list subfolders of Folder %s (%#v)", path, err)
+			raven.CaptureError(err, map[string]string{"operation": "GetFolders", "Folder.Name": path, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+			return false
+		}
+	}
+	if !strings.HasPrefix(folder.UID, ownedFolderUIDPrefix) || desired.folders[path] {
+		return false
+	}
+	// deleting a folder deletes everything below it
+	if !subfoldersGone {
+		glog.V(3).Infof("Keeping orphaned Folder %s which still contains subfolders", path)
+		return false
+	}
+	boards, err := grafanaClient.SearchDashboardsInFolder(folder.ID)
+	if err != nil {
+		glog.Errorf("Failed to list dashboards of Folder %s (%#v)", path, err)
+		raven.CaptureError(err, map[string]string{"operation": "SearchDashboardsInFolder", "Folder.Name": path, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+		return false
+	}
+	if len(boards) > 0 {
+		glog.V(3).Infof("Keeping orphaned Folder %s which still contains %d dashboards", path, len(boards))
+		return false
+	}
+	if npc.options.PruneDryRun {
+		glog.V(1).Infof("Would delete orphaned Folder %s (%s)", path, folder.UID)
+		return true
+	}
+	if _, err := grafanaClient.DeleteFolder(folder.UID); err != nil {
+		glog.Errorf("Failed to delete orphaned Folder %s (%s) (%#v)", path, folder.UID, err)
+		raven.CaptureError(err, map[string]string{"operation": "DeleteFolder", "Folder.Name": path, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+		return false
+	}
+	glog.V(1).Infof("Deleted orphaned Folder %s (%s)", path, folder.UID)
+	raven.Capture(&raven.Packet{Level: raven.INFO, Message: "Deleted orphaned Folder"}, map[string]string{"operation": "DeleteFolder", "Folder.Name": path, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+	prunedTotal.WithLabelValues(pruneKindFolder).Inc()
+	return true
+}
+
+func (npc *grafanaConfigController) pruneDatasources(grafanaClient *grafana.Client, desired *desiredObjects) {
+	datasources, err := grafanaClient.GetAllDatasources()
+	if err != nil {
+		glog.Errorf("Failed to list datasources (%#v)", err)
+		raven.CaptureError(err, map[string]string{"operation": "GetAllDatasources", "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+		return
+	}
+	for _, ds := range datasources {
+		owner, _ := ds.JSONDataValue(ownerJSONDataKey)
+		if owner != ownerName || desired.datasources[ds.Name] {
+			continue
+		}
+		if npc.options.PruneDryRun {
+			glog.V(1).Infof("Would delete orphaned Datasource %s", ds.Name)
+			continue
+		}
+		if _, err := grafanaClient.DeleteDatasource(ds.ID); err != nil {
+			glog.Errorf("Failed to delete orphaned Datasource %s (%#v)", ds.Name, err)
+			raven.CaptureError(err, map[string]string{"operation": "DeleteDatasource", "DataSource.Name": ds.Name, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+			continue
+		}
+		glog.V(1).Infof("Deleted orphaned Datasource %s", ds.Name)
+		npc.setSecretsHash(grafana.Datasource{UID: ds.UID, Name: ds.Name}, "")
+		raven.Capture(&raven.Packet{Level: raven.INFO, Message: "Deleted orphaned Data Source"}, map[string]string{"operation": "DeleteDatasource", "DataSource.Name": ds.Name, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+		prunedTotal.WithLabelValues(pruneKindDatasource).Inc()
+	}
+}
@@ -0,0 +1,175 @@
+package operator
+
+/*
+Copyright [2019] [autonubil System GmbH]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"reflect"
+
+	raven "github.com/getsentry/raven-go"
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"gitlab.autonubil.net/kubernetes/grafana-config-operator/pkg/apis/grafana/v1alpha1"
+)
+
+// Secrets referenced by GrafanaDatasources are fetched on demand and cached.
+// The cache is refreshed every --datasources.secret-refresh-interval, so only
+// get on the referenced Secrets is required instead of watching all Secrets
+// of the cluster.
+func (npc *grafanaConfigController) cachesSecrets() bool {
+	return npc.options.DatasourceCRD && npc.options.SecretRefreshInterval > 0
+}
+
+// Fetch the Secrets referenced by GrafanaDatasources again and re-apply the
+// datasources whose Secrets were created, rotated or deleted. Secrets that
+// are no longer referenced are dropped from the cache.
+func (npc *grafanaConfigController) refreshSecrets() {
+	if npc.informer.datasourceStore == nil {
+		return
+	}
+	referenced := make(map[string]bool)
+	for _, obj := range npc.informer.datasourceStore.List() {
+		datasource, ok := obj.(*v1alpha1.GrafanaDatasource)
+		if !ok {
+			continue
+		}
+		for _, name := range datasource.Spec.SecretNames() {
+			referenced[datasource.Namespace+"/"+name] = true
+		}
+	}
+
+	npc.secretCacheLock.Lock()
+	for key := range npc.secretCache {
+		if !referenced[key] {
+			delete(npc.secretCache, key)
+		}
+	}
+	npc.secretCacheLock.Unlock()
+
+	for key := range referenced {
+		npc.secretCacheLock.Lock()
+		cached, known := npc.secretCache[key]
+		npc.secretCacheLock.Unlock()
+		if !known {
+			// not resolved yet, the datasource reads it when it is applied
+			continue
+		}
+		namespace, name, _ := cache.SplitMetaNamespaceKey(key)
+		secret, err := npc.clientSet.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			secret, err = nil, nil
+		}
+		if err != nil {
+			glog.Warningf("Failed to refresh Secret %s (%v)", key, err)
+			raven.CaptureError(err, map[string]string{"operation": "refreshSecrets", "Secret": key})
+			continue
+		}
+		npc.secretCacheLock.Lock()
+		npc.secretCache[key] = secret
+		npc.secretCacheLock.Unlock()
+		if (cached == nil) != (secret == nil) || (secret != nil && !reflect.DeepEqual(cached.Data, secret.Data)) {
+			npc.handleSecretChange(namespace, name)
+		}
+	}
+}
+
+// Re-apply all objects that reference a created, rotated or deleted Secret
+func (npc *grafanaConfigController) handleSecretChange(namespace string, name string) {
+	if npc.informer.datasourceStore == nil {
+		return
+	}
+	for _, obj := range npc.informer.datasourceStore.List() {
+		datasource, ok := obj.(*v1alpha1.GrafanaDatasource)
+		if !ok || datasource.Namespace != namespace {
+			continue
+		}
+		for _, secretName := range datasource.Spec.SecretNames() {
+			if secretName == name {
+				glog.V(3).Infof("Secret %s/%s changed, requeuing GrafanaDatasource %s", namespace, name, datasource.Name)
+				npc.enqueueObject(npc.datasourceQueue, datasource)
+				break
+			}
+		}
+	}
+}
+
+// Get a Secret from the cache, or from the API if it was not fetched before
+// or Secrets are not cached.
+func (npc *grafanaConfigController) getSecret(namespace string, name string) (*corev1.Secret, error) {
+	key := namespace + "/" + name
+	if npc.cachesSecrets() {
+		npc.secretCacheLock.Lock()
+		secret, known := npc.secretCache[key]
+		npc.secretCacheLock.Unlock()
+		if known {
+			if secret == nil {
+				return nil, fmt.Errorf("secret %s not found", key)
+			}
+			return secret, nil
+		}
+	}
+	secret, err := npc.clientSet.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+	if npc.cachesSecrets() {
+		// missing Secrets are remembered as well, so their creation is noticed
+		npc.secretCacheLock.Lock()
+		if err != nil {
+			npc.secretCache[key] = nil
+		} else {
+			npc.secretCache[key] = secret
+		}
+		npc.secretCacheLock.Unlock()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("secret %s not found", key)
+	}
+	return secret, nil
+}
+
+// Resolve a value that is given inline or by a key of a Secret. Returns false
+// if an optional Secret or key does not exist.
+func (npc *grafanaConfigController) resolveSecretValue(namespace string, value *v1alpha1.SecretValue) (string, bool, error) {
+	if value == nil {
+		return "", false, nil
+	}
+	ref := value.SecretKeyRef
+	if ref == nil {
+		return value.Value, true, nil
+	}
+	optional := ref.Optional != nil && *ref.Optional
+	secret, err := npc.getSecret(namespace, ref.Name)
+	if err != nil {
+		if optional {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	data, found := secret.Data[ref.Key]
+	if !found {
+		if optional {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("secret %s/%s has no key %s", namespace, ref.Name, ref.Key)
+	}
+	return string(data), true, nil
+}
@@ -16,21 +16,68 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
+import (
+	"time"
+)
+
 // Define a type for the options of grafanaConfigOperator
 type GrafanaConfigOperatorOptions struct {
-	KubeConfig        string
-	Namespace         string
-	Autoconfigure     bool
-	PrometheusEnabled bool
-	GrafanaEndpoint   string
-	GrafanaAuth       string
-	DatasourceWatch   bool
-	DatasourceLabel   string
-	DashboardWatch    bool
-	DashboardLabel    string
-	DbaasFolder       bool
+	KubeConfig            string
+	Namespace             string
+	Autoconfigure         bool
+	PrometheusEnabled     bool
+	GrafanaEndpoint       string
+	GrafanaAuth           string
+	DatasourceWatch       bool
+	DatasourceLabel       string
+	DashboardWatch        bool
+	DashboardLabel        string
+	NotifierWatch         bool
+	NotifierLabel         string
+	AlertingWatch         bool
+	AlertingLabel         string
+	DbaasFolder           bool
+	Workers               int
+	MaxRetries            int
+	RetryBaseDelay        time.Duration
+	RetryMaxDelay         time.Duration
+	ResyncPeriod          time.Duration
+	DriftInterval         time.Duration
+	DriftCorrect          bool
+	Prune                 bool
+	PruneDryRun           bool
+	PruneInterval         time.Duration
+	FolderTemplate        string
+	NestedFolders         bool
+	Permissions           bool
+	PermissionsStrict     bool
+	PermissionsMaxLevel   string
+	PermissionsPrincipals string
+	PermissionsState      string
+	DatasourceState       string
+	DashboardCRD          bool
+	DashboardURLPrefixes  string
+	DatasourceCRD         bool
+	FolderCRD             bool
+	Instance              string
+	CrossNamespaceSecrets bool
+	EnvVariablePrefix     string
+	SecretRefreshInterval time.Duration
+	GrafanaTimeout        time.Duration
+	GrafanaRetries        int
+	GrafanaRetryBackoff   time.Duration
+	GrafanaCAFile         string
+	GrafanaCertFile       string
+	GrafanaKeyFile        string
+	GrafanaServerName     string
+	GrafanaInsecure       bool
+	GrafanaAuthFile       string
+	GrafanaAuthSecret     string
+	GrafanaAuthProxyUser  string
+	GrafanaProxyHeader    string
+	GrafanaOrgID          uint
 }
 
 func (opts *GrafanaConfigOperatorOptions) IsApiConfigured() bool {
-	return (opts.GrafanaAuth != "" && opts.GrafanaEndpoint != "")
+	return (opts.GrafanaAuth != "" || opts.GrafanaAuthFile != "" || opts.GrafanaAuthSecret != "" || opts.GrafanaAuthProxyUser != "") && opts.GrafanaEndpoint != ""
 }
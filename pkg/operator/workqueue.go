@@ -0,0 +1,204 @@
+package operator
+
+/*
+Copyright [2019] [autonubil System GmbH]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+
+	raven "github.com/getsentry/raven-go"
+	"github.com/golang/glog"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// Create the rate limiter of a workqueue. Failed keys are retried with
+// exponential backoff from the base up to the max delay, overall the queue is
+// limited like the default of client-go.
+func newRateLimiter(options *GrafanaControllerOptions) workqueue.RateLimiter {
+	return workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(options.RetryBaseDelay, options.RetryMaxDelay),
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(10), 100)},
+	)
+}
+
+// Add a ConfigMap to the workqueue. Multiple events for the same ConfigMap
+// are collapsed into a single work item.
+func (npc *grafanaConfigController) enqueue(configMap *corev1.ConfigMap) {
+	npc.enqueueObject(npc.queue, configMap)
+}
+
+// Add a custom resource or ConfigMap to a workqueue
+func (npc *grafanaConfigController) enqueueObject(queue workqueue.Interface, obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	queue.Add(key)
+}
+
+// Add a ConfigMap to the workqueue after the rate limiter allows it.
+func (npc *grafanaConfigController) enqueueRateLimited(configMap *corev1.ConfigMap) {
+	key, err := cache.MetaNamespaceKeyFunc(configMap)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	npc.queue.AddRateLimited(key)
+}
+
+// Remember the last state of a deleted ConfigMap until its objects have
+// been removed from grafana.
+func (npc *grafanaConfigController) addTombstone(configMap *corev1.ConfigMap) {
+	key, err := cache.MetaNamespaceKeyFunc(configMap)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	npc.tombstonesLock.Lock()
+	defer npc.tombstonesLock.Unlock()
+	npc.tombstones[key] = configMap
+}
+
+func (npc *grafanaConfigController) getTombstone(key string) (*corev1.ConfigMap, bool) {
+	npc.tombstonesLock.Lock()
+	defer npc.tombstonesLock.Unlock()
+	configMap, exists := npc.tombstones[key]
+	return configMap, exists
+}
+
+func (npc *grafanaConfigController) removeTombstone(key string) {
+	npc.tombstonesLock.Lock()
+	defer npc.tombstonesLock.Unlock()
+	delete(npc.tombstones, key)
+}
+
+// Process items from the workqueue until it is shut down.
+func (npc *grafanaConfigController) runWorker() {
+	for npc.processNextWorkItem(npc.queue, "Config Map", npc.syncConfigMap) {
+	}
+}
+
+// Process GrafanaDashboards from their workqueue until it is shut down.
+func (npc *grafanaConfigController) runDashboardWorker() {
+	for npc.processNextWorkItem(npc.dashboardQueue, "GrafanaDashboard", npc.syncGrafanaDashboard) {
+	}
+}
+
+// Process GrafanaDatasources from their workqueue until it is shut down.
+func (npc *grafanaConfigController) runDatasourceWorker() {
+	for npc.processNextWorkItem(npc.datasourceQueue, "GrafanaDatasource", npc.syncGrafanaDatasource) {
+	}
+}
+
+// Process GrafanaFolders from their workqueue until it is shut down.
+func (npc *grafanaConfigController) runFolderWorker() {
+	for npc.processNextWorkItem(npc.folderQueue, "GrafanaFolder", npc.syncGrafanaFolder) {
+	}
+}
+
+func (npc *grafanaConfigController) processNextWorkItem(queue workqueue.RateLimitingInterface, kind string, sync func(string) error) bool {
+	obj, shutdown := queue.Get()
+	if shutdown {
+		return false
+	}
+	defer queue.Done(obj)
+
+	key := obj.(string)
+	err := sync(key)
+	if err == nil {
+		queue.Forget(key)
+		return true
+	}
+
+	if queue.NumRequeues(key) < npc.options.MaxRetries {
+		glog.Warningf("Failed to process %s %s, will retry: %v", kind, key, err)
+		queue.AddRateLimited(key)
+		return true
+	}
+
+	// keep the key, a later retry may still succeed once grafana or the
+	// referenced objects are fixed
+	glog.Errorf("Failed to process %s %s after %d retries, will retry in %v: %v", kind, key, queue.NumRequeues(key), npc.options.RetryMaxDelay, err)
+	raven.CaptureError(err, map[string]string{"operation": "sync", "Kind": kind, "Key": key, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+	queue.Forget(key)
+	queue.AddAfter(key, npc.options.RetryMaxDelay)
+	return true
+}
+
+// Bring grafana in line with the current state of the ConfigMap identified by key.
+func (npc *grafanaConfigController) syncConfigMap(key string) error {
+	obj, exists, err := npc.informer.configmapStore.GetByKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to get Config Map %s from cache: %v", key, err)
+	}
+
+	if !exists {
+		configMap, found := npc.getTombstone(key)
+		if !found {
+			glog.V(4).Infof("Config Map %s is gone and has nothing left to delete", key)
+			return nil
+		}
+		if err := npc.processConfigMap(configMap, true); err != nil {
+			return err
+		}
+		npc.removeTombstone(key)
+		npc.removeLastApplied(key)
+		npc.removeAppliedPermissions(key)
+		npc.clearPendingDrift(key)
+		return nil
+	}
+
+	// recreated before the deletion was processed
+	npc.removeTombstone(key)
+
+	configMap := obj.(*corev1.ConfigMap)
+	previous, applied := npc.getLastApplied(key)
+	if !npc.isWatchedLabel(configMap) {
+		if !applied {
+			glog.V(12).Infof("Skipping non grafana labeled ConfigMap: %s/%s", configMap.Namespace, configMap.Name)
+			return nil
+		}
+		// the label was removed, so everything applied before has to go
+		glog.V(2).Infof("Config Map %s/%s is no longer labeled, deleting its objects", configMap.Namespace, configMap.Name)
+		if err := npc.processConfigMap(previous, true); err != nil {
+			return err
+		}
+		npc.removeLastApplied(key)
+		npc.removeAppliedPermissions(key)
+		npc.clearPendingDrift(key)
+		return nil
+	}
+
+	if err := npc.processConfigMap(configMap, false); err != nil {
+		return err
+	}
+	if applied {
+		if err := npc.deleteRemovedEntries(previous, configMap); err != nil {
+			return err
+		}
+	}
+	npc.setLastApplied(configMap)
+	npc.recordAppliedPermissions(configMap)
+	for kind, count := range npc.clearPendingDrift(key) {
+		driftCorrectedTotal.WithLabelValues(kind).Add(float64(count))
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package operator
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const testDatasourceLabel = "grafana_datasource"
+
+// A fake grafana that knows a single datasource named 'prometheus' and fails
+// every request while failing is set.
+type fakeGrafana struct {
+	*httptest.Server
+	mu       sync.Mutex
+	failing  bool
+	requests []string
+}
+
+func newFakeGrafana() *fakeGrafana {
+	f := &fakeGrafana{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+		failing := f.failing
+		f.mu.Unlock()
+		switch {
+		case failing:
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"message":"database is locked"}`))
+		case r.Method == "GET" && r.URL.Path == "/api/datasources/name/prometheus":
+			w.Write([]byte(`{"id":4,"name":"prometheus","type":"prometheus"}`))
+		case r.Method == "PUT" && r.URL.Path == "/api/datasources/4":
+			w.Write([]byte(`{"message":"Datasource updated","id":4,"name":"prometheus"}`))
+		case r.Method == "DELETE" && r.URL.Path == "/api/datasources/4":
+			w.Write([]byte(`{"message":"Data source deleted"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"not found"}`))
+		}
+	}))
+	return f
+}
+
+func (f *fakeGrafana) setFailing(failing bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failing = failing
+}
+
+func (f *fakeGrafana) received() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string{}, f.requests...)
+}
+
+func newTestController(endpoint string) *grafanaConfigController {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &grafanaConfigController{
+		informer: &grafanaConfigControllerInformer{
+			configmapStore: cache.NewStore(cache.MetaNamespaceKeyFunc),
+		},
+		queue:        workqueue.NewRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(0, 0)),
+		tombstones:   make(map[string]*corev1.ConfigMap),
+		lastApplied:  make(map[string]*corev1.ConfigMap),
+		secretHashes: make(map[string]string),
+		ctx:          ctx,
+		cancel:       cancel,
+		options: &GrafanaControllerOptions{
+			GrafanaEndpoint: endpoint,
+			DatasourceLabel: testDatasourceLabel,
+			MaxRetries:      3,
+			RetryMaxDelay:   10 * time.Millisecond,
+		},
+	}
+}
+
+func datasourceConfigMap() *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "monitoring",
+			Name:      "datasources",
+			Labels:    map[string]string{testDatasourceLabel: "1"},
+		},
+		Data: map[string]string{
+			"datasources.yaml": "apiVersion: 1\ndatasources:\n- name: prometheus\n  type: prometheus\n  url: http://prometheus:9090\n",
+		},
+	}
+}
+
+func TestSyncConfigMapDeleted(t *testing.T) {
+	f := newFakeGrafana()
+	defer f.Close()
+	npc := newTestController(f.URL)
+	defer npc.cancel()
+	configMap := datasourceConfigMap()
+	key := "monitoring/datasources"
+
+	// nothing known about the ConfigMap
+	if err := npc.syncConfigMap(key); err != nil {
+		t.Fatalf("unexpected error for an unknown Config Map: %v", err)
+	}
+	if requests := f.received(); len(requests) != 0 {
+		t.Fatalf("unexpected requests for an unknown Config Map: %v", requests)
+	}
+
+	// the deletion fails and is retried with the tombstone
+	npc.addTombstone(configMap)
+	npc.setLastApplied(configMap)
+	f.setFailing(true)
+	err := npc.syncConfigMap(key)
+	if err == nil || !strings.Contains(err.Error(), "database is locked") {
+		t.Fatalf("error = %v, want the error of grafana", err)
+	}
+	if _, found := npc.getTombstone(key); !found {
+		t.Fatal("the tombstone must be kept until the deletion succeeded")
+	}
+
+	// the deletion succeeds
+	f.setFailing(false)
+	if err := npc.syncConfigMap(key); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, found := npc.getTombstone(key); found {
+		t.Error("the tombstone must be removed once the deletion succeeded")
+	}
+	if _, found := npc.getLastApplied(key); found {
+		t.Error("the applied state must be forgotten once the deletion succeeded")
+	}
+	requests := f.received()
+	if last := requests[len(requests)-1]; last != "DELETE /api/datasources/4" {
+		t.Errorf("last request = %s, want the deletion of the datasource", last)
+	}
+
+	// nothing left to do
+	before := len(f.received())
+	if err := npc.syncConfigMap(key); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(f.received()) != before {
+		t.Error("a processed deletion must not be applied again")
+	}
+}
+
+func TestSyncConfigMapRecreated(t *testing.T) {
+	f := newFakeGrafana()
+	defer f.Close()
+	npc := newTestController(f.URL)
+	defer npc.cancel()
+	configMap := datasourceConfigMap()
+	key := "monitoring/datasources"
+
+	// deleted and created again before the deletion was processed
+	npc.addTombstone(configMap)
+	if err := npc.informer.configmapStore.Add(configMap); err != nil {
+		t.Fatal(err)
+	}
+	if err := npc.syncConfigMap(key); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, found := npc.getTombstone(key); found {
+		t.Error("the tombstone of a recreated Config Map must be dropped")
+	}
+	for _, request := range f.received() {
+		if strings.HasPrefix(request, "DELETE") {
+			t.Errorf("the datasource of a recreated Config Map was deleted: %s", request)
+		}
+	}
+	if _, found := npc.getLastApplied(key); !found {
+		t.Error("the applied state of the recreated Config Map must be recorded")
+	}
+}
+
+func TestSyncConfigMapNotLabeled(t *testing.T) {
+	f := newFakeGrafana()
+	defer f.Close()
+	npc := newTestController(f.URL)
+	defer npc.cancel()
+	configMap := datasourceConfigMap()
+	configMap.Labels = nil
+	if err := npc.informer.configmapStore.Add(configMap); err != nil {
+		t.Fatal(err)
+	}
+	if err := npc.syncConfigMap("monitoring/datasources"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if requests := f.received(); len(requests) != 0 {
+		t.Errorf("unexpected requests for a Config Map without label: %v", requests)
+	}
+}
+
+func TestProcessNextWorkItemRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		calls    int
+	}{
+		{name: "success", failures: 0, calls: 1},
+		{name: "success after retries", failures: 2, calls: 3},
+		{name: "delayed after max retries", failures: 10, calls: 4},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			npc := newTestController("http://grafana")
+			defer npc.cancel()
+			defer npc.queue.ShutDown()
+
+			calls := 0
+			sync := func(key string) error {
+				calls++
+				if key != "monitoring/datasources" {
+					t.Errorf("sync called with %s", key)
+				}
+				if calls <= test.failures {
+					return errors.New("temporary failure")
+				}
+				return nil
+			}
+			npc.queue.Add("monitoring/datasources")
+			for npc.queue.Len() > 0 {
+				npc.processNextWorkItem(npc.queue, "Config Map", sync)
+			}
+			if calls != test.calls {
+				t.Errorf("sync called %d times, want %d", calls, test.calls)
+			}
+			if requeues := npc.queue.NumRequeues("monitoring/datasources"); requeues != 0 {
+				t.Errorf("%d requeues left, want the key to be forgotten", requeues)
+			}
+			if test.calls > test.failures {
+				return
+			}
+			// the key is kept and added again after the max delay
+			go func() {
+				time.Sleep(time.Second)
+				npc.queue.ShutDown()
+			}()
+			if key, shutdown := npc.queue.Get(); shutdown || key != "monitoring/datasources" {
+				t.Error("the key was dropped, want it to be retried after the max delay")
+			}
+		})
+	}
+}
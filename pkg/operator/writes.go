@@ -0,0 +1,209 @@
+package operator
+
+/*
+Copyright [2019] [autonubil System GmbH]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+
+	raven "github.com/getsentry/raven-go"
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"gitlab.autonubil.net/kubernetes/grafana-config-operator/pkg/grafana"
+)
+
+const (
+	writeKindDashboard  = "dashboard"
+	writeKindDatasource = "datasource"
+
+	writeResultApplied = "applied"
+	writeResultSkipped = "skipped"
+
+	// Data key of the secret hashes in the state ConfigMap
+	secretHashesDataKey = "secretHashes"
+)
+
+// Check whether grafana already stores the board in the given folder. Saving
+// an unchanged dashboard would still add a version to its history. Returns the
+// id of the stored dashboard, which is needed to apply permissions.
+func dashboardUnchanged(grafanaClient *grafana.Client, board *grafana.Board, folderID uint) (uint, bool) {
+	if board.UID == "" {
+		return 0, false
+	}
+	live, meta, err := grafanaClient.GetRawDashboardByUID(board.UID)
+	if err != nil {
+		glog.V(4).Infof("No stored Dashboard %s to compare with (%v)", board.UID, err)
+		return 0, false
+	}
+	if meta.FolderID != folderID {
+		return 0, false
+	}
+	changed, err := grafana.DashboardDrifted(board, live)
+	if err != nil {
+		glog.Warningf("Failed to compare Dashboard %s with the stored one (%v)", board.UID, err)
+		return 0, false
+	}
+	if changed {
+		return 0, false
+	}
+	var stored struct {
+		ID uint `json:"id"`
+	}
+	if err := json.Unmarshal(live, &stored); err != nil || stored.ID == 0 {
+		return 0, false
+	}
+	return stored.ID, true
+}
+
+// Check whether grafana already stores the datasource. Datasources with
+// secrets to send are always written, as grafana does not return them.
+func datasourceUnchanged(desired grafana.Datasource, live grafana.Datasource) bool {
+	if desired.HasSecrets() {
+		return false
+	}
+	changed, err := grafana.DatasourceDrifted(desired, live)
+	if err != nil {
+		glog.Warningf("Failed to compare Datasource %s with the stored one (%v)", desired.Name, err)
+		return false
+	}
+	return !changed
+}
+
+// Key of a datasource in the secret hashes: its organization and uid, or its
+// name if no uid is declared. Organization 0 stands for the one of the
+// operator.
+func (npc *grafanaConfigController) secretsHashKey(orgID uint, uid string, name string) string {
+	if orgID == 0 {
+		orgID = npc.options.GrafanaOrgID
+	}
+	if uid != "" {
+		return fmt.Sprintf("%d/uid/%s", orgID, uid)
+	}
+	return fmt.Sprintf("%d/name/%s", orgID, name)
+}
+
+// Remember the hash of the secrets written with a datasource, an empty hash
+// forgets the datasource by its uid as well as by its name.
+func (npc *grafanaConfigController) setSecretsHash(ds grafana.Datasource, hash string) {
+	npc.secretHashesLock.Lock()
+	defer npc.secretHashesLock.Unlock()
+	changed := false
+	if hash == "" {
+		for _, key := range []string{npc.secretsHashKey(ds.OrgID, ds.UID, ds.Name), npc.secretsHashKey(ds.OrgID, "", ds.Name)} {
+			if _, found := npc.secretHashes[key]; found {
+				delete(npc.secretHashes, key)
+				changed = true
+			}
+		}
+	} else if key := npc.secretsHashKey(ds.OrgID, ds.UID, ds.Name); npc.secretHashes[key] != hash {
+		npc.secretHashes[key] = hash
+		changed = true
+	}
+	if !changed || npc.options.DatasourceState == "" {
+		return
+	}
+	if err := npc.saveSecretHashes(); err != nil {
+		glog.Errorf("Failed to record the secret hash of Datasource %s in %s (%v)", ds.Name, npc.options.DatasourceState, err)
+		raven.CaptureError(err, map[string]string{"operation": "saveSecretHashes", "DataSource.Name": ds.Name, "GrafanaEndpoint": npc.options.GrafanaEndpoint})
+	}
+}
+
+// Write all secret hashes to the state ConfigMap, which is created if it does
+// not exist yet. Must be called with the lock held.
+func (npc *grafanaConfigController) saveSecretHashes() error {
+	namespace, name, err := stateConfigMapRef(npc.options.DatasourceState, npc.namespace)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(npc.secretHashes)
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]interface{}{"data": map[string]string{secretHashesDataKey: string(raw)}})
+	if err != nil {
+		return err
+	}
+	configMaps := npc.clientSet.CoreV1().ConfigMaps(namespace)
+	_, err = configMaps.Patch(name, types.MergePatchType, patch)
+	if !apierrors.IsNotFound(err) {
+		return err
+	}
+	_, err = configMaps.Create(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Data:       map[string]string{secretHashesDataKey: string(raw)},
+	})
+	return err
+}
+
+// Load the secret hashes written before a restart from the state ConfigMap
+func (npc *grafanaConfigController) loadSecretHashes() error {
+	namespace, name, err := stateConfigMapRef(npc.options.DatasourceState, npc.namespace)
+	if err != nil {
+		return err
+	}
+	state, err := npc.clientSet.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	raw, found := state.Data[secretHashesDataKey]
+	if !found {
+		return nil
+	}
+	hashes := map[string]string{}
+	if err := json.Unmarshal([]byte(raw), &hashes); err != nil {
+		return fmt.Errorf("invalid secret hashes in %s/%s: %v", namespace, name, err)
+	}
+	npc.secretHashesLock.Lock()
+	defer npc.secretHashesLock.Unlock()
+	for key, hash := range hashes {
+		npc.secretHashes[key] = hash
+	}
+	glog.V(2).Infof("Loaded the secret hashes of %d Datasources from %s/%s", len(hashes), namespace, name)
+	return nil
+}
+
+// Drop the secrets of the desired datasource if grafana already stores them,
+// i.e. they were written before with the same hash and grafana still reports
+// all secureJsonData fields as set. Without --datasources.state-configmap the
+// hashes are kept only in memory, so secrets are sent once more after a
+// restart of the operator. Returns the hash to remember once the datasource
+// has been written.
+func (npc *grafanaConfigController) withoutAppliedSecrets(desired grafana.Datasource, live grafana.Datasource) (grafana.Datasource, string) {
+	hash := desired.SecretsHash()
+	if hash == "" {
+		return desired, hash
+	}
+	npc.secretHashesLock.Lock()
+	applied := npc.secretHashes[npc.secretsHashKey(desired.OrgID, desired.UID, desired.Name)] == hash
+	npc.secretHashesLock.Unlock()
+	if !applied {
+		return desired, hash
+	}
+	for key := range desired.SecureJSONData {
+		if !live.SecureJSONFields[key] {
+			return desired, hash
+		}
+	}
+	return desired.WithoutSecrets(), hash
+}
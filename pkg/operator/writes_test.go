@@ -0,0 +1,47 @@
+package operator
+
+import (
+	"testing"
+
+	"gitlab.autonubil.net/kubernetes/grafana-config-operator/pkg/grafana"
+)
+
+func TestWithoutAppliedSecrets(t *testing.T) {
+	password := "secret"
+	written := grafana.Datasource{Name: "loki", OrgID: 2, Password: &password}
+	live := grafana.Datasource{ID: 4, UID: "abc", Name: "loki", OrgID: 2}
+
+	tests := []struct {
+		name        string
+		desired     grafana.Datasource
+		wantSecrets bool
+	}{
+		{name: "unchanged", desired: written},
+		{name: "other organization", desired: grafana.Datasource{Name: "loki", OrgID: 3, Password: &password}, wantSecrets: true},
+		{name: "rotated", desired: grafana.Datasource{Name: "loki", OrgID: 2, Password: &live.Name}, wantSecrets: true},
+		{name: "declared uid", desired: grafana.Datasource{Name: "loki", UID: "abc", OrgID: 2, Password: &password}, wantSecrets: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			npc := newTestController("http://grafana")
+			defer npc.cancel()
+			npc.setSecretsHash(written, written.SecretsHash())
+
+			desired, hash := npc.withoutAppliedSecrets(test.desired, live)
+			if hash != test.desired.SecretsHash() {
+				t.Errorf("hash = %s, want the one of the desired secrets", hash)
+			}
+			if desired.HasSecrets() != test.wantSecrets {
+				t.Errorf("secrets sent: %t, want %t", desired.HasSecrets(), test.wantSecrets)
+			}
+		})
+	}
+
+	npc := newTestController("http://grafana")
+	defer npc.cancel()
+	npc.setSecretsHash(written, written.SecretsHash())
+	npc.setSecretsHash(grafana.Datasource{Name: "loki", UID: live.UID, OrgID: 2}, "")
+	if len(npc.secretHashes) != 0 {
+		t.Errorf("hashes left after deleting the datasource: %v", npc.secretHashes)
+	}
+}